@@ -0,0 +1,489 @@
+package jmespath
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/JimWen/fastjson"
+)
+
+// argType is a bitmask of types accepted by a function parameter.
+type argType int
+
+const (
+	argNumber argType = 1 << iota
+	argString
+	argBoolean
+	argArray
+	argObject
+	argNull
+	argExpref
+
+	// argArrayNumber is an array of numbers.
+	argArrayNumber
+
+	// argArrayString is an array of strings.
+	argArrayString
+
+	argAny = argNumber | argString | argBoolean | argArray | argObject | argNull
+)
+
+func (t argType) String() string {
+	if t == argAny {
+		return "any"
+	}
+	names := []string{"number", "string", "boolean", "array", "object", "null", "expression", "array[number]", "array[string]"}
+	var a []string
+	for i, name := range names {
+		if t&(1<<i) != 0 {
+			a = append(a, name)
+		}
+	}
+	return strings.Join(a, " or ")
+}
+
+// function is a built-in function.
+type function struct {
+	params []argType
+
+	// variadic is set if the last parameter may be repeated.
+	variadic bool
+
+	// call is called with the evaluated arguments. refs contains expressions
+	// passed to expression parameters, while the corresponding args are nil.
+	call func(ev *evaluator, args []*fastjson.Value, refs []node) (*fastjson.Value, error)
+}
+
+func (f *function) checkArity(n int) error {
+	if f.variadic {
+		if n < len(f.params) {
+			return fmt.Errorf("invalid arity: expecting at least %d arguments, got %d", len(f.params), n)
+		}
+		return nil
+	}
+	if n != len(f.params) {
+		return fmt.Errorf("invalid arity: expecting %d arguments, got %d", len(f.params), n)
+	}
+	return nil
+}
+
+// functions contains the built-in functions by name.
+var functions = map[string]*function{
+	"abs":         {params: []argType{argNumber}, call: fnAbs},
+	"avg":         {params: []argType{argArrayNumber}, call: fnAvg},
+	"ceil":        {params: []argType{argNumber}, call: fnCeil},
+	"contains":    {params: []argType{argArray | argString, argAny}, call: fnContains},
+	"ends_with":   {params: []argType{argString, argString}, call: fnEndsWith},
+	"floor":       {params: []argType{argNumber}, call: fnFloor},
+	"join":        {params: []argType{argString, argArrayString}, call: fnJoin},
+	"keys":        {params: []argType{argObject}, call: fnKeys},
+	"length":      {params: []argType{argString | argArray | argObject}, call: fnLength},
+	"map":         {params: []argType{argExpref, argArray}, call: fnMap},
+	"max":         {params: []argType{argArrayNumber | argArrayString}, call: fnMax},
+	"max_by":      {params: []argType{argArray, argExpref}, call: fnMaxBy},
+	"merge":       {params: []argType{argObject}, variadic: true, call: fnMerge},
+	"min":         {params: []argType{argArrayNumber | argArrayString}, call: fnMin},
+	"min_by":      {params: []argType{argArray, argExpref}, call: fnMinBy},
+	"not_null":    {params: []argType{argAny}, variadic: true, call: fnNotNull},
+	"reverse":     {params: []argType{argString | argArray}, call: fnReverse},
+	"sort":        {params: []argType{argArrayNumber | argArrayString}, call: fnSort},
+	"sort_by":     {params: []argType{argArray, argExpref}, call: fnSortBy},
+	"starts_with": {params: []argType{argString, argString}, call: fnStartsWith},
+	"sum":         {params: []argType{argArrayNumber}, call: fnSum},
+	"to_array":    {params: []argType{argAny}, call: fnToArray},
+	"to_number":   {params: []argType{argAny}, call: fnToNumber},
+	"to_string":   {params: []argType{argAny}, call: fnToString},
+	"type":        {params: []argType{argAny}, call: fnType},
+	"values":      {params: []argType{argObject}, call: fnValues},
+}
+
+// functionNode is a function call.
+type functionNode struct {
+	name string
+	f    *function
+	args []node
+}
+
+func (x *functionNode) eval(ev *evaluator, v *fastjson.Value) (*fastjson.Value, error) {
+	args := make([]*fastjson.Value, len(x.args))
+	var refs []node
+	for i, arg := range x.args {
+		t := x.f.params[len(x.f.params)-1]
+		if i < len(x.f.params) {
+			t = x.f.params[i]
+		}
+
+		if ref, ok := arg.(exprefNode); ok {
+			if t&argExpref == 0 {
+				return nil, x.invalidType(i, t, "expression")
+			}
+			if refs == nil {
+				refs = make([]node, len(x.args))
+			}
+			refs[i] = ref.x
+			continue
+		}
+		if t&argExpref != 0 {
+			return nil, x.invalidType(i, t, "value")
+		}
+
+		r, err := ev.eval(arg, v)
+		if err != nil {
+			return nil, err
+		}
+		if !matchType(r, t) {
+			return nil, x.invalidType(i, t, typeName(r))
+		}
+		args[i] = r
+	}
+	return x.f.call(ev, args, refs)
+}
+
+func (x *functionNode) invalidType(i int, expected argType, got string) error {
+	return errorf(ErrInvalidType, "invalid type of argument %d for %s(): expecting %s, got %s", i+1, x.name, expected, got)
+}
+
+// matchType returns true if v matches t.
+func matchType(v *fastjson.Value, t argType) bool {
+	var vt argType
+	switch typeName(v) {
+	case "number":
+		vt = argNumber
+	case "string":
+		vt = argString
+	case "boolean":
+		vt = argBoolean
+	case "object":
+		vt = argObject
+	case "null":
+		vt = argNull
+	case "array":
+		if t&argArray != 0 {
+			return true
+		}
+		if t&argArrayNumber != 0 && allOfType(v.GetArray(), fastjson.TypeNumber) {
+			return true
+		}
+		return t&argArrayString != 0 && allOfType(v.GetArray(), fastjson.TypeString)
+	}
+	return t&vt != 0
+}
+
+func allOfType(a []*fastjson.Value, t fastjson.Type) bool {
+	for _, v := range a {
+		if v.Type() != t {
+			return false
+		}
+	}
+	return true
+}
+
+// typeName returns JMESPath type of v.
+func typeName(v *fastjson.Value) string {
+	if v == nil {
+		return "null"
+	}
+	switch v.Type() {
+	case fastjson.TypeTrue, fastjson.TypeFalse:
+		return "boolean"
+	default:
+		return v.Type().String()
+	}
+}
+
+func fnAbs(ev *evaluator, args []*fastjson.Value, refs []node) (*fastjson.Value, error) {
+	return ev.a.NewNumberFloat64(math.Abs(args[0].GetFloat64())), nil
+}
+
+func fnAvg(ev *evaluator, args []*fastjson.Value, refs []node) (*fastjson.Value, error) {
+	a := args[0].GetArray()
+	if len(a) == 0 {
+		return nil, nil
+	}
+	return ev.a.NewNumberFloat64(sum(a) / float64(len(a))), nil
+}
+
+func fnCeil(ev *evaluator, args []*fastjson.Value, refs []node) (*fastjson.Value, error) {
+	return ev.a.NewNumberFloat64(math.Ceil(args[0].GetFloat64())), nil
+}
+
+func fnContains(ev *evaluator, args []*fastjson.Value, refs []node) (*fastjson.Value, error) {
+	subject, search := args[0], args[1]
+	if subject.Type() == fastjson.TypeString {
+		ok := search != nil && search.Type() == fastjson.TypeString && bytes.Contains(subject.GetStringBytes(), search.GetStringBytes())
+		return ev.newBool(ok), nil
+	}
+	for _, item := range subject.GetArray() {
+		if equal(item, search) {
+			return ev.newBool(true), nil
+		}
+	}
+	return ev.newBool(false), nil
+}
+
+func fnEndsWith(ev *evaluator, args []*fastjson.Value, refs []node) (*fastjson.Value, error) {
+	return ev.newBool(bytes.HasSuffix(args[0].GetStringBytes(), args[1].GetStringBytes())), nil
+}
+
+func fnFloor(ev *evaluator, args []*fastjson.Value, refs []node) (*fastjson.Value, error) {
+	return ev.a.NewNumberFloat64(math.Floor(args[0].GetFloat64())), nil
+}
+
+func fnJoin(ev *evaluator, args []*fastjson.Value, refs []node) (*fastjson.Value, error) {
+	glue := args[0].GetStringBytes()
+	var b []byte
+	for i, item := range args[1].GetArray() {
+		if i > 0 {
+			b = append(b, glue...)
+		}
+		b = append(b, item.GetStringBytes()...)
+	}
+	return ev.a.NewStringBytes(b), nil
+}
+
+func fnKeys(ev *evaluator, args []*fastjson.Value, refs []node) (*fastjson.Value, error) {
+	var keys []*fastjson.Value
+	args[0].GetObject().Visit(func(key []byte, v *fastjson.Value) {
+		keys = append(keys, ev.a.NewStringBytes(key))
+	})
+	return ev.newArray(keys), nil
+}
+
+func fnLength(ev *evaluator, args []*fastjson.Value, refs []node) (*fastjson.Value, error) {
+	v := args[0]
+	n := 0
+	switch v.Type() {
+	case fastjson.TypeString:
+		n = utf8.RuneCount(v.GetStringBytes())
+	case fastjson.TypeArray:
+		n = len(v.GetArray())
+	default:
+		n = v.GetObject().Len()
+	}
+	return ev.a.NewNumberInt(n), nil
+}
+
+func fnMap(ev *evaluator, args []*fastjson.Value, refs []node) (*fastjson.Value, error) {
+	a := args[1].GetArray()
+	res := make([]*fastjson.Value, len(a))
+	for i, item := range a {
+		r, err := ev.eval(refs[0], item)
+		if err != nil {
+			return nil, err
+		}
+		res[i] = r
+	}
+	return ev.newArray(res), nil
+}
+
+func fnMax(ev *evaluator, args []*fastjson.Value, refs []node) (*fastjson.Value, error) {
+	return extremum(args[0].GetArray(), 1), nil
+}
+
+func fnMin(ev *evaluator, args []*fastjson.Value, refs []node) (*fastjson.Value, error) {
+	return extremum(args[0].GetArray(), -1), nil
+}
+
+// extremum returns the item of a, which compares to all the other items
+// with the given sign. a must contain either numbers or strings.
+func extremum(a []*fastjson.Value, sign int) *fastjson.Value {
+	var res *fastjson.Value
+	for _, item := range a {
+		if res == nil || compare(item, res)*sign > 0 {
+			res = item
+		}
+	}
+	return res
+}
+
+func fnMaxBy(ev *evaluator, args []*fastjson.Value, refs []node) (*fastjson.Value, error) {
+	return extremumBy(ev, "max_by", args[0].GetArray(), refs[1], 1)
+}
+
+func fnMinBy(ev *evaluator, args []*fastjson.Value, refs []node) (*fastjson.Value, error) {
+	return extremumBy(ev, "min_by", args[0].GetArray(), refs[1], -1)
+}
+
+func extremumBy(ev *evaluator, name string, a []*fastjson.Value, ref node, sign int) (*fastjson.Value, error) {
+	keys, err := sortKeys(ev, name, a, ref)
+	if err != nil {
+		return nil, err
+	}
+	var res *fastjson.Value
+	var resKey *fastjson.Value
+	for i, item := range a {
+		if res == nil || compare(keys[i], resKey)*sign > 0 {
+			res, resKey = item, keys[i]
+		}
+	}
+	return res, nil
+}
+
+// sortKeys evaluates ref over a items. The results must be either numbers or strings.
+func sortKeys(ev *evaluator, name string, a []*fastjson.Value, ref node) ([]*fastjson.Value, error) {
+	keys := make([]*fastjson.Value, len(a))
+	for i, item := range a {
+		k, err := ev.eval(ref, item)
+		if err != nil {
+			return nil, err
+		}
+		t := typeName(k)
+		if t != "number" && t != "string" || i > 0 && t != typeName(keys[0]) {
+			return nil, errorf(ErrInvalidType, "invalid type of expression result for %s(): expecting numbers or strings, got %s", name, t)
+		}
+		keys[i] = k
+	}
+	return keys, nil
+}
+
+// compare compares two numbers or two strings.
+func compare(a, b *fastjson.Value) int {
+	if a.Type() == fastjson.TypeString {
+		return bytes.Compare(a.GetStringBytes(), b.GetStringBytes())
+	}
+	x, y := a.GetFloat64(), b.GetFloat64()
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func fnMerge(ev *evaluator, args []*fastjson.Value, refs []node) (*fastjson.Value, error) {
+	obj := ev.a.NewObject()
+	for _, arg := range args {
+		arg.GetObject().Visit(func(key []byte, v *fastjson.Value) {
+			obj.Set(string(key), v)
+		})
+	}
+	return obj, nil
+}
+
+func fnNotNull(ev *evaluator, args []*fastjson.Value, refs []node) (*fastjson.Value, error) {
+	for _, arg := range args {
+		if arg != nil {
+			return arg, nil
+		}
+	}
+	return nil, nil
+}
+
+func fnReverse(ev *evaluator, args []*fastjson.Value, refs []node) (*fastjson.Value, error) {
+	v := args[0]
+	if v.Type() == fastjson.TypeString {
+		s := v.GetStringBytes()
+		b := make([]byte, 0, len(s))
+		for len(s) > 0 {
+			_, size := utf8.DecodeLastRune(s)
+			b = append(b, s[len(s)-size:]...)
+			s = s[:len(s)-size]
+		}
+		return ev.a.NewStringBytes(b), nil
+	}
+	a := v.GetArray()
+	res := make([]*fastjson.Value, len(a))
+	for i, item := range a {
+		res[len(a)-1-i] = item
+	}
+	return ev.newArray(res), nil
+}
+
+func fnSort(ev *evaluator, args []*fastjson.Value, refs []node) (*fastjson.Value, error) {
+	a := append([]*fastjson.Value(nil), args[0].GetArray()...)
+	sort.SliceStable(a, func(i, j int) bool {
+		return compare(a[i], a[j]) < 0
+	})
+	return ev.newArray(a), nil
+}
+
+func fnSortBy(ev *evaluator, args []*fastjson.Value, refs []node) (*fastjson.Value, error) {
+	a := args[0].GetArray()
+	keys, err := sortKeys(ev, "sort_by", a, refs[1])
+	if err != nil {
+		return nil, err
+	}
+	idxs := make([]int, len(a))
+	for i := range idxs {
+		idxs[i] = i
+	}
+	sort.SliceStable(idxs, func(i, j int) bool {
+		return compare(keys[idxs[i]], keys[idxs[j]]) < 0
+	})
+	res := make([]*fastjson.Value, len(a))
+	for i, idx := range idxs {
+		res[i] = a[idx]
+	}
+	return ev.newArray(res), nil
+}
+
+func fnStartsWith(ev *evaluator, args []*fastjson.Value, refs []node) (*fastjson.Value, error) {
+	return ev.newBool(bytes.HasPrefix(args[0].GetStringBytes(), args[1].GetStringBytes())), nil
+}
+
+func fnSum(ev *evaluator, args []*fastjson.Value, refs []node) (*fastjson.Value, error) {
+	return ev.a.NewNumberFloat64(sum(args[0].GetArray())), nil
+}
+
+func sum(a []*fastjson.Value) float64 {
+	n := 0.0
+	for _, item := range a {
+		n += item.GetFloat64()
+	}
+	return n
+}
+
+func fnToArray(ev *evaluator, args []*fastjson.Value, refs []node) (*fastjson.Value, error) {
+	if v := args[0]; v != nil && v.Type() == fastjson.TypeArray {
+		return v, nil
+	}
+	return ev.newArray(args[:1]), nil
+}
+
+func fnToNumber(ev *evaluator, args []*fastjson.Value, refs []node) (*fastjson.Value, error) {
+	v := args[0]
+	switch typeName(v) {
+	case "number":
+		return v, nil
+	case "string":
+		s := v.GetStringBytes()
+		if len(bytes.TrimSpace(s)) != len(s) || fastjson.ValidateBytes(s) != nil {
+			return nil, nil
+		}
+		if n, err := fastjson.ParseBytes(s); err != nil || n.Type() != fastjson.TypeNumber {
+			return nil, nil
+		}
+		return ev.a.NewNumberBytes(s), nil
+	default:
+		return nil, nil
+	}
+}
+
+func fnToString(ev *evaluator, args []*fastjson.Value, refs []node) (*fastjson.Value, error) {
+	v := args[0]
+	if v != nil && v.Type() == fastjson.TypeString {
+		return v, nil
+	}
+	if v == nil {
+		return ev.a.NewString("null"), nil
+	}
+	return ev.a.NewStringBytes(v.MarshalTo(nil)), nil
+}
+
+func fnType(ev *evaluator, args []*fastjson.Value, refs []node) (*fastjson.Value, error) {
+	return ev.a.NewString(typeName(args[0])), nil
+}
+
+func fnValues(ev *evaluator, args []*fastjson.Value, refs []node) (*fastjson.Value, error) {
+	var values []*fastjson.Value
+	args[0].GetObject().Visit(func(key []byte, v *fastjson.Value) {
+		values = append(values, v)
+	})
+	return ev.newArray(values), nil
+}
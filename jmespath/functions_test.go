@@ -0,0 +1,100 @@
+package jmespath
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/JimWen/fastjson"
+)
+
+func TestFunctions(t *testing.T) {
+	v := fastjson.MustParse(`{
+		"n": -1.5,
+		"nums": [3, 1, 2],
+		"strs": ["b", "c", "a"],
+		"s": "héllo",
+		"obj": {"x": 1, "y": 2},
+		"people": [{"name": "b", "age": 30}, {"name": "a", "age": 30}, {"name": "c", "age": 10}]
+	}`)
+
+	f := func(expr, resultExpected string) {
+		t.Helper()
+		var a fastjson.Arena
+		res, err := Search(expr, &a, v)
+		if err != nil {
+			t.Fatalf("unexpected error when evaluating %q: %s", expr, err)
+		}
+		if result := res.String(); result != resultExpected {
+			t.Fatalf("unexpected result for %q; got %s; want %s", expr, result, resultExpected)
+		}
+	}
+
+	f(`abs(n)`, `1.5`)
+	f(`ceil(n)`, `-1`)
+	f(`floor(n)`, `-2`)
+	f(`avg(nums)`, `2`)
+	f(`avg(obj.missing || `+"`[]`"+`)`, `null`)
+	f(`sum(nums)`, `6`)
+	f(`max(nums)`, `3`)
+	f(`min(strs)`, `"a"`)
+	f(`sort(nums)`, `[1,2,3]`)
+	f(`sort(strs)`, `["a","b","c"]`)
+	f(`length(s)`, `5`)
+	f(`reverse(s)`, `"olléh"`)
+	f(`reverse(nums)`, `[2,1,3]`)
+	f(`contains(s, 'll')`, `true`)
+	f(`contains(nums, `+"`2`"+`)`, `true`)
+	f(`starts_with(s, 'hé')`, `true`)
+	f(`ends_with(s, 'x')`, `false`)
+	f(`join('-', strs)`, `"b-c-a"`)
+	f(`keys(obj)`, `["x","y"]`)
+	f(`values(obj)`, `[1,2]`)
+	f(`merge(obj, {y: 'z'})`, `{"x":1,"y":"z"}`)
+	f(`not_null(missing, n)`, `-1.5`)
+	f(`to_array(n)`, `[-1.5]`)
+	f(`to_number('12.5e1')`, `12.5e1`)
+	f(`to_number(' 1')`, `null`)
+	f(`to_string(nums)`, `"[3,1,2]"`)
+	f(`type(obj)`, `"object"`)
+	f(`map(&age, people)`, `[30,30,10]`)
+	f(`sort_by(people, &age)[].name`, `["c","b","a"]`)
+	f(`max_by(people, &age).name`, `"b"`)
+	f(`min_by(people, &name).name`, `"a"`)
+}
+
+func TestFunctionsInvalidArity(t *testing.T) {
+	f := func(expr string) {
+		t.Helper()
+		_, err := Compile(expr)
+		var se *SyntaxError
+		if !errors.As(err, &se) {
+			t.Fatalf("expecting SyntaxError for %q; got %v", expr, err)
+		}
+	}
+
+	f(`abs()`)
+	f(`abs(1, 2)`)
+	f(`merge()`)
+	f(`unknown(@)`)
+}
+
+func TestFunctionsInvalidType(t *testing.T) {
+	v := fastjson.MustParse(`{"a": [1, "x"], "b": [{"k": 1}, {"k": "x"}]}`)
+
+	f := func(expr, errExpected string) {
+		t.Helper()
+		var a fastjson.Arena
+		_, err := Search(expr, &a, v)
+		if !errors.Is(err, ErrInvalidType) {
+			t.Fatalf("expecting ErrInvalidType for %q; got %v", expr, err)
+		}
+		if s := err.Error(); s != errExpected {
+			t.Fatalf("unexpected error for %q; got %q; want %q", expr, s, errExpected)
+		}
+	}
+
+	f(`sum(a)`, `invalid type of argument 1 for sum(): expecting array[number], got array`)
+	f(`length(@.missing)`, `invalid type of argument 1 for length(): expecting string or array or object, got null`)
+	f(`map(a, &@)`, `invalid type of argument 1 for map(): expecting expression, got value`)
+	f(`sort_by(b, &k)`, `invalid type of expression result for sort_by(): expecting numbers or strings, got string`)
+}
@@ -0,0 +1,466 @@
+package jmespath
+
+import (
+	"bytes"
+
+	"github.com/JimWen/fastjson"
+)
+
+// node is a node of the compiled expression tree.
+//
+// eval returns nil for JMESPath null.
+type node interface {
+	eval(ev *evaluator, v *fastjson.Value) (*fastjson.Value, error)
+}
+
+// evaluator holds the state of a single Expr.Search call.
+type evaluator struct {
+	a *fastjson.Arena
+}
+
+func (ev *evaluator) eval(x node, v *fastjson.Value) (*fastjson.Value, error) {
+	return x.eval(ev, normalize(v))
+}
+
+// newArray returns an array holding items. nil items are stored as null.
+func (ev *evaluator) newArray(items []*fastjson.Value) *fastjson.Value {
+	arr := ev.a.NewArray()
+	for i, item := range items {
+		if item == nil {
+			item = ev.a.NewNull()
+		}
+		arr.SetArrayItem(i, item)
+	}
+	return arr
+}
+
+func (ev *evaluator) newBool(b bool) *fastjson.Value {
+	if b {
+		return ev.a.NewTrue()
+	}
+	return ev.a.NewFalse()
+}
+
+// normalize returns nil for JSON null, so nil is the only null representation
+// during the evaluation.
+func normalize(v *fastjson.Value) *fastjson.Value {
+	if v == nil || v.Type() == fastjson.TypeNull {
+		return nil
+	}
+	return v
+}
+
+// isTrue returns JMESPath truthiness of v.
+//
+// Empty arrays, empty objects, empty strings, false and null are false.
+func isTrue(v *fastjson.Value) bool {
+	if v == nil {
+		return false
+	}
+	switch v.Type() {
+	case fastjson.TypeArray:
+		return len(v.GetArray()) > 0
+	case fastjson.TypeObject:
+		return v.GetObject().Len() > 0
+	case fastjson.TypeString:
+		return len(v.GetStringBytes()) > 0
+	case fastjson.TypeFalse, fastjson.TypeNull:
+		return false
+	default:
+		return true
+	}
+}
+
+// equal returns true if a and b hold equal JSON values.
+//
+// Numbers are compared by their values, while object members are compared
+// regardless of their order.
+func equal(a, b *fastjson.Value) bool {
+	a, b = normalize(a), normalize(b)
+	if a == nil || b == nil {
+		return a == b
+	}
+	t := a.Type()
+	if t != b.Type() {
+		return false
+	}
+	switch t {
+	case fastjson.TypeNumber:
+		return a.GetFloat64() == b.GetFloat64()
+	case fastjson.TypeString:
+		return bytes.Equal(a.GetStringBytes(), b.GetStringBytes())
+	case fastjson.TypeArray:
+		x, y := a.GetArray(), b.GetArray()
+		if len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !equal(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	case fastjson.TypeObject:
+		x, y := a.GetObject(), b.GetObject()
+		if x.Len() != y.Len() {
+			return false
+		}
+		ok := true
+		x.Visit(func(key []byte, v *fastjson.Value) {
+			if ok {
+				w := y.Get(string(key))
+				ok = w != nil && equal(v, w)
+			}
+		})
+		return ok
+	default:
+		return true
+	}
+}
+
+// currentNode is `@`, which evaluates to the current value.
+type currentNode struct{}
+
+func (currentNode) eval(ev *evaluator, v *fastjson.Value) (*fastjson.Value, error) {
+	return v, nil
+}
+
+type literalNode struct {
+	v *fastjson.Value
+}
+
+func (x literalNode) eval(ev *evaluator, v *fastjson.Value) (*fastjson.Value, error) {
+	return x.v, nil
+}
+
+type fieldNode struct {
+	name string
+}
+
+func (x fieldNode) eval(ev *evaluator, v *fastjson.Value) (*fastjson.Value, error) {
+	if v == nil || v.Type() != fastjson.TypeObject {
+		return nil, nil
+	}
+	return normalize(v.GetObject().Get(x.name)), nil
+}
+
+type indexNode struct {
+	i int
+}
+
+func (x indexNode) eval(ev *evaluator, v *fastjson.Value) (*fastjson.Value, error) {
+	if v == nil || v.Type() != fastjson.TypeArray {
+		return nil, nil
+	}
+	a := v.GetArray()
+	i := x.i
+	if i < 0 {
+		i += len(a)
+	}
+	if i < 0 || i >= len(a) {
+		return nil, nil
+	}
+	return normalize(a[i]), nil
+}
+
+// sliceNode is `[start:stop:step]`. nil bounds are omitted.
+type sliceNode struct {
+	start, stop, step *int
+}
+
+func (x sliceNode) eval(ev *evaluator, v *fastjson.Value) (*fastjson.Value, error) {
+	if v == nil || v.Type() != fastjson.TypeArray {
+		return nil, nil
+	}
+	a := v.GetArray()
+	step := 1
+	if x.step != nil {
+		step = *x.step
+	}
+	start, stop := sliceBounds(len(a), x.start, x.stop, step)
+
+	var items []*fastjson.Value
+	if step > 0 {
+		for i := start; i < stop; i += step {
+			items = append(items, a[i])
+		}
+	} else {
+		for i := start; i > stop; i += step {
+			items = append(items, a[i])
+		}
+	}
+	return ev.newArray(items), nil
+}
+
+// sliceBounds returns the normalized start and stop of the slice over
+// an array with the given length.
+func sliceBounds(length int, start, stop *int, step int) (int, int) {
+	bound := func(p *int, dflt int) int {
+		if p == nil {
+			return dflt
+		}
+		n := *p
+		if n < 0 {
+			n += length
+			if n < 0 {
+				if step < 0 {
+					return -1
+				}
+				return 0
+			}
+		} else if n >= length {
+			if step < 0 {
+				return length - 1
+			}
+			return length
+		}
+		return n
+	}
+	if step < 0 {
+		return bound(start, length-1), bound(stop, -1)
+	}
+	return bound(start, 0), bound(stop, length)
+}
+
+// subexprNode evaluates right over the result of left, i.e. `a.b` or `a[0]`.
+type subexprNode struct {
+	left, right node
+}
+
+func (x subexprNode) eval(ev *evaluator, v *fastjson.Value) (*fastjson.Value, error) {
+	l, err := ev.eval(x.left, v)
+	if err != nil {
+		return nil, err
+	}
+	return ev.eval(x.right, l)
+}
+
+// pipeNode is `a | b`. Unlike subexprNode, it stops projections.
+type pipeNode struct {
+	left, right node
+}
+
+func (x pipeNode) eval(ev *evaluator, v *fastjson.Value) (*fastjson.Value, error) {
+	l, err := ev.eval(x.left, v)
+	if err != nil {
+		return nil, err
+	}
+	return ev.eval(x.right, l)
+}
+
+// projectionNode evaluates right over every item of the array returned by left.
+//
+// null results are omitted.
+type projectionNode struct {
+	left, right node
+}
+
+func (x projectionNode) eval(ev *evaluator, v *fastjson.Value) (*fastjson.Value, error) {
+	l, err := ev.eval(x.left, v)
+	if err != nil || l == nil || l.Type() != fastjson.TypeArray {
+		return nil, err
+	}
+	return ev.project(l.GetArray(), nil, x.right)
+}
+
+// project evaluates right over items, which match cond if it isn't nil.
+func (ev *evaluator) project(items []*fastjson.Value, cond, right node) (*fastjson.Value, error) {
+	res := make([]*fastjson.Value, 0, len(items))
+	for _, item := range items {
+		if cond != nil {
+			ok, err := ev.eval(cond, item)
+			if err != nil {
+				return nil, err
+			}
+			if !isTrue(ok) {
+				continue
+			}
+		}
+		r, err := ev.eval(right, item)
+		if err != nil {
+			return nil, err
+		}
+		if r != nil {
+			res = append(res, r)
+		}
+	}
+	return ev.newArray(res), nil
+}
+
+// valueProjectionNode is `*`, which projects right onto the values of the object
+// returned by left.
+type valueProjectionNode struct {
+	left, right node
+}
+
+func (x valueProjectionNode) eval(ev *evaluator, v *fastjson.Value) (*fastjson.Value, error) {
+	l, err := ev.eval(x.left, v)
+	if err != nil || l == nil || l.Type() != fastjson.TypeObject {
+		return nil, err
+	}
+	var items []*fastjson.Value
+	l.GetObject().Visit(func(key []byte, v *fastjson.Value) {
+		items = append(items, v)
+	})
+	return ev.project(items, nil, x.right)
+}
+
+// filterProjectionNode is `[?cond]`, which projects right onto the items
+// of the array returned by left matching cond.
+type filterProjectionNode struct {
+	left, cond, right node
+}
+
+func (x filterProjectionNode) eval(ev *evaluator, v *fastjson.Value) (*fastjson.Value, error) {
+	l, err := ev.eval(x.left, v)
+	if err != nil || l == nil || l.Type() != fastjson.TypeArray {
+		return nil, err
+	}
+	return ev.project(l.GetArray(), x.cond, x.right)
+}
+
+// flattenNode is `[]`, which merges nested arrays of x result into a single array.
+type flattenNode struct {
+	x node
+}
+
+func (x flattenNode) eval(ev *evaluator, v *fastjson.Value) (*fastjson.Value, error) {
+	l, err := ev.eval(x.x, v)
+	if err != nil || l == nil || l.Type() != fastjson.TypeArray {
+		return nil, err
+	}
+	var items []*fastjson.Value
+	for _, item := range l.GetArray() {
+		if item.Type() == fastjson.TypeArray {
+			items = append(items, item.GetArray()...)
+		} else {
+			items = append(items, item)
+		}
+	}
+	return ev.newArray(items), nil
+}
+
+type multiSelectListNode struct {
+	items []node
+}
+
+func (x multiSelectListNode) eval(ev *evaluator, v *fastjson.Value) (*fastjson.Value, error) {
+	if v == nil {
+		return nil, nil
+	}
+	items := make([]*fastjson.Value, len(x.items))
+	for i, item := range x.items {
+		r, err := ev.eval(item, v)
+		if err != nil {
+			return nil, err
+		}
+		items[i] = r
+	}
+	return ev.newArray(items), nil
+}
+
+type multiSelectHashNode struct {
+	keys   []string
+	values []node
+}
+
+func (x multiSelectHashNode) eval(ev *evaluator, v *fastjson.Value) (*fastjson.Value, error) {
+	if v == nil {
+		return nil, nil
+	}
+	obj := ev.a.NewObject()
+	for i, key := range x.keys {
+		r, err := ev.eval(x.values[i], v)
+		if err != nil {
+			return nil, err
+		}
+		obj.Set(key, r)
+	}
+	return obj, nil
+}
+
+// orNode is `a || b`, which returns a if it is true, otherwise b.
+type orNode struct {
+	left, right node
+}
+
+func (x orNode) eval(ev *evaluator, v *fastjson.Value) (*fastjson.Value, error) {
+	l, err := ev.eval(x.left, v)
+	if err != nil || isTrue(l) {
+		return l, err
+	}
+	return ev.eval(x.right, v)
+}
+
+// andNode is `a && b`, which returns a if it is false, otherwise b.
+type andNode struct {
+	left, right node
+}
+
+func (x andNode) eval(ev *evaluator, v *fastjson.Value) (*fastjson.Value, error) {
+	l, err := ev.eval(x.left, v)
+	if err != nil || !isTrue(l) {
+		return l, err
+	}
+	return ev.eval(x.right, v)
+}
+
+type notNode struct {
+	x node
+}
+
+func (x notNode) eval(ev *evaluator, v *fastjson.Value) (*fastjson.Value, error) {
+	r, err := ev.eval(x.x, v)
+	if err != nil {
+		return nil, err
+	}
+	return ev.newBool(!isTrue(r)), nil
+}
+
+// comparatorNode compares left and right results.
+//
+// Ordering comparisons return null unless both sides are numbers.
+type comparatorNode struct {
+	op          tokenType
+	left, right node
+}
+
+func (x comparatorNode) eval(ev *evaluator, v *fastjson.Value) (*fastjson.Value, error) {
+	l, err := ev.eval(x.left, v)
+	if err != nil {
+		return nil, err
+	}
+	r, err := ev.eval(x.right, v)
+	if err != nil {
+		return nil, err
+	}
+	switch x.op {
+	case tEQ:
+		return ev.newBool(equal(l, r)), nil
+	case tNE:
+		return ev.newBool(!equal(l, r)), nil
+	}
+	if l == nil || r == nil || l.Type() != fastjson.TypeNumber || r.Type() != fastjson.TypeNumber {
+		return nil, nil
+	}
+	a, b := l.GetFloat64(), r.GetFloat64()
+	switch x.op {
+	case tLT:
+		return ev.newBool(a < b), nil
+	case tLTE:
+		return ev.newBool(a <= b), nil
+	case tGT:
+		return ev.newBool(a > b), nil
+	default:
+		return ev.newBool(a >= b), nil
+	}
+}
+
+// exprefNode is `&x`, which passes x to functions such as sort_by.
+type exprefNode struct {
+	x node
+}
+
+func (x exprefNode) eval(ev *evaluator, v *fastjson.Value) (*fastjson.Value, error) {
+	return nil, errorf(ErrInvalidType, "expression reference may be used only as a function argument")
+}
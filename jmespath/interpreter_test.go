@@ -0,0 +1,101 @@
+package jmespath
+
+import (
+	"testing"
+
+	"github.com/JimWen/fastjson"
+)
+
+func TestInterpreter(t *testing.T) {
+	v := fastjson.MustParse(`{
+		"a": {"b": [{"c": 1}, {"c": 2, "d": null}, {"c": 3}]},
+		"m": [[1, 2], 3, [4, [5]]],
+		"o": {"x": {"n": 1}, "y": {"n": 2}},
+		"e": [],
+		"s": ""
+	}`)
+
+	f := func(expr, resultExpected string) {
+		t.Helper()
+		var a fastjson.Arena
+		res, err := Search(expr, &a, v)
+		if err != nil {
+			t.Fatalf("unexpected error when evaluating %q: %s", expr, err)
+		}
+		if result := res.String(); result != resultExpected {
+			t.Fatalf("unexpected result for %q; got %s; want %s", expr, result, resultExpected)
+		}
+	}
+
+	// Sub-expressions and indexes.
+	f(`a.b[1].c`, `2`)
+	f(`a.b[-1].c`, `3`)
+	f(`a.b[5]`, `null`)
+	f(`a.b[1].d`, `null`)
+	f(`a.b.c`, `null`)
+
+	// Slices.
+	f(`a.b[1:].c`, `[2,3]`)
+	f(`a.b[::-1].c`, `[3,2,1]`)
+	f(`a.b[-2:-1].c`, `[2]`)
+	f(`a.b[10:]`, `[]`)
+
+	// Projections.
+	f(`a.b[*].c`, `[1,2,3]`)
+	f(`a.b[*].d`, `[]`)
+	f(`o.*.n`, `[1,2]`)
+	f(`a.b[?c > `+"`1`"+`].c`, `[2,3]`)
+	f(`a.b[?c == `+"`2`"+`] | [0].c`, `2`)
+	f(`a.b[*].c | [0]`, `1`)
+	f(`m[]`, `[1,2,3,4,[5]]`)
+	f(`m[][]`, `[1,2,3,4,5]`)
+
+	// Multiselects.
+	f(`a.b[0].[c, d]`, `[1,null]`)
+	f(`a.b[*].{c: c}`, `[{"c":1},{"c":2},{"c":3}]`)
+	f(`missing.[a]`, `null`)
+
+	// Logical operators.
+	f(`e || s || 'x'`, `"x"`)
+	f(`a && 'y'`, `"y"`)
+	f(`!e`, `true`)
+	f(`a.b[0].c < 'x'`, `null`)
+	f(`o.x == {n: `+"`1.0`"+`}`, `true`)
+}
+
+func TestEqual(t *testing.T) {
+	f := func(a, b string, resultExpected bool) {
+		t.Helper()
+		if result := equal(fastjson.MustParse(a), fastjson.MustParse(b)); result != resultExpected {
+			t.Fatalf("unexpected equal(%s, %s); got %v; want %v", a, b, result, resultExpected)
+		}
+	}
+
+	f(`1`, `1.0`, true)
+	f(`1`, `"1"`, false)
+	f(`null`, `null`, true)
+	f(`[1, [2]]`, `[1, [2]]`, true)
+	f(`[1, 2]`, `[2, 1]`, false)
+	f(`{"a": 1, "b": 2}`, `{"b": 2, "a": 1}`, true)
+	f(`{"a": 1}`, `{"a": 1, "b": 2}`, false)
+	f(`{"a": null}`, `{"b": null}`, false)
+}
+
+func TestIsTrue(t *testing.T) {
+	f := func(s string, resultExpected bool) {
+		t.Helper()
+		if result := isTrue(fastjson.MustParse(s)); result != resultExpected {
+			t.Fatalf("unexpected isTrue(%s); got %v; want %v", s, result, resultExpected)
+		}
+	}
+
+	f(`null`, false)
+	f(`false`, false)
+	f(`""`, false)
+	f(`[]`, false)
+	f(`{}`, false)
+	f(`0`, true)
+	f(`" "`, true)
+	f(`[null]`, true)
+	f(`{"a": null}`, true)
+}
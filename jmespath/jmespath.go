@@ -0,0 +1,160 @@
+// Package jmespath implements JMESPath queries over fastjson values.
+//
+// See https://jmespath.org/specification.html for the query language.
+//
+// Expressions are compiled once with Compile and may be evaluated
+// over many documents with Expr.Search. New values built by the evaluation,
+// such as projection results and multiselect hashes, are allocated
+// in the given fastjson.Arena, so the Arena may be reset after the results
+// are no longer needed.
+package jmespath
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/JimWen/fastjson"
+)
+
+// Expr is a compiled JMESPath expression.
+//
+// Expr may be evaluated from concurrent goroutines.
+type Expr struct {
+	expr string
+	root node
+}
+
+// Compile compiles the JMESPath expression.
+func Compile(expr string) (*Expr, error) {
+	tokens, err := tokenize(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{
+		expr:   expr,
+		tokens: tokens,
+	}
+	root, err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+	return &Expr{
+		expr: expr,
+		root: root,
+	}, nil
+}
+
+// MustCompile is like Compile, but panics if the expression cannot be compiled.
+func MustCompile(expr string) *Expr {
+	e, err := Compile(expr)
+	if err != nil {
+		panic(err)
+	}
+	return e
+}
+
+// String returns the source expression of e.
+func (e *Expr) String() string {
+	return e.expr
+}
+
+// Search evaluates e over v.
+//
+// New values are allocated in a, so the result is valid until a is reset.
+// The result may also refer to v items, so v mustn't be modified while
+// the result is in use. JMESPath null is returned as fastjson null value.
+//
+// An error is returned if a function is called with invalid arguments.
+func (e *Expr) Search(a *fastjson.Arena, v *fastjson.Value) (*fastjson.Value, error) {
+	ev := &evaluator{
+		a: a,
+	}
+	res, err := ev.eval(e.root, v)
+	if err != nil {
+		return nil, err
+	}
+	if res == nil {
+		return a.NewNull(), nil
+	}
+	return res, nil
+}
+
+// Search compiles expr and evaluates it over v.
+//
+// Use Compile and Expr.Search for evaluating the same expression many times.
+func Search(expr string, a *fastjson.Arena, v *fastjson.Value) (*fastjson.Value, error) {
+	e, err := Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	return e.Search(a, v)
+}
+
+// SyntaxError is returned by Compile for malformed expressions.
+type SyntaxError struct {
+	// Expression is the expression, which failed to compile.
+	Expression string
+
+	// Offset is the byte offset in Expression where the error has been detected.
+	Offset int
+
+	// Msg describes the error.
+	Msg string
+}
+
+// Error implements error interface.
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("cannot compile JMESPath %q at offset %d: %s", e.Expression, e.Offset, e.Msg)
+}
+
+// Caret returns Expression with a caret pointing to the error location
+// on the next line followed by the error message.
+func (e *SyntaxError) Caret() string {
+	offset := e.Offset
+	if offset > len(e.Expression) {
+		offset = len(e.Expression)
+	}
+	return e.Expression + "\n" + strings.Repeat(" ", utf8.RuneCountInString(e.Expression[:offset])) + "^ " + e.Msg
+}
+
+func newSyntaxError(expr string, offset int, format string, args ...interface{}) *SyntaxError {
+	return &SyntaxError{
+		Expression: expr,
+		Offset:     offset,
+		Msg:        fmt.Sprintf(format, args...),
+	}
+}
+
+// ErrInvalidType is returned by Expr.Search when a function is called
+// with an argument of invalid type, i.e. abs('foo') or sort_by() with
+// an expression returning both numbers and strings.
+//
+// The returned errors wrap ErrInvalidType, so they may be checked with errors.Is.
+var ErrInvalidType = errors.New("invalid type")
+
+// evalError is an error detected during the evaluation.
+//
+// It keeps the detailed message, while errors.Is reports the kind of the error.
+type evalError struct {
+	msg  string
+	kind error
+}
+
+// Error implements error interface.
+func (e *evalError) Error() string {
+	return e.msg
+}
+
+// Unwrap returns the kind of the error.
+func (e *evalError) Unwrap() error {
+	return e.kind
+}
+
+func errorf(kind error, format string, args ...interface{}) error {
+	return &evalError{
+		msg:  fmt.Sprintf(format, args...),
+		kind: kind,
+	}
+}
@@ -0,0 +1,175 @@
+package jmespath
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/JimWen/fastjson"
+)
+
+func TestCompliance(t *testing.T) {
+	files, err := filepath.Glob("testdata/compliance/*.json")
+	if err != nil {
+		t.Fatalf("cannot list compliance suites: %s", err)
+	}
+	if len(files) == 0 {
+		t.Fatalf("missing compliance suites")
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("cannot read compliance suite: %s", err)
+		}
+		var p fastjson.Parser
+		suites, err := p.ParseBytes(data)
+		if err != nil {
+			t.Fatalf("cannot parse compliance suite %s: %s", file, err)
+		}
+		name := strings.TrimSuffix(filepath.Base(file), ".json")
+		for i, suite := range suites.GetArray() {
+			given := suite.Get("given")
+			for j, tc := range suite.GetArray("cases") {
+				testComplianceCase(t, name, i, j, given, tc)
+			}
+		}
+	}
+}
+
+func testComplianceCase(t *testing.T, name string, i, j int, given, tc *fastjson.Value) {
+	t.Helper()
+
+	expr := string(tc.GetStringBytes("expression"))
+	var a fastjson.Arena
+	e, err := Compile(expr)
+	if kind := tc.GetStringBytes("error"); kind != nil {
+		if err == nil {
+			_, err = e.Search(&a, given)
+		}
+		if err == nil {
+			t.Errorf("%s[%d][%d]: expecting %s error for %q", name, i, j, kind, expr)
+		}
+		return
+	}
+	if err != nil {
+		t.Errorf("%s[%d][%d]: unexpected error when compiling %q: %s", name, i, j, expr, err)
+		return
+	}
+	res, err := e.Search(&a, given)
+	if err != nil {
+		t.Errorf("%s[%d][%d]: unexpected error when evaluating %q: %s", name, i, j, expr, err)
+		return
+	}
+	if expected := tc.Get("result"); !equal(res, expected) {
+		t.Errorf("%s[%d][%d]: unexpected result for %q; got %s; want %s", name, i, j, expr, res, expected)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	v := fastjson.MustParse(`{"people":[{"name":"b","age":30},{"name":"a","age":50},{"name":"c","age":40}]}`)
+
+	f := func(expr, resultExpected string) {
+		t.Helper()
+		var a fastjson.Arena
+		res, err := Search(expr, &a, v)
+		if err != nil {
+			t.Fatalf("unexpected error when evaluating %q: %s", expr, err)
+		}
+		if result := res.String(); result != resultExpected {
+			t.Fatalf("unexpected result for %q; got %s; want %s", expr, result, resultExpected)
+		}
+	}
+
+	f(`people[*].name`, `["b","a","c"]`)
+	f(`people[?age > `+"`35`"+`].name | [0]`, `"a"`)
+	f(`sort_by(people, &age)[].name`, `["b","c","a"]`)
+	f(`max_by(people, &age).name`, `"a"`)
+	f(`join(', ', people[].name)`, `"b, a, c"`)
+	f(`{names: people[].name, count: length(people)}`, `{"names":["b","a","c"],"count":3}`)
+	f(`missing`, `null`)
+}
+
+func TestExprSearchConcurrent(t *testing.T) {
+	e := MustCompile(`items[?n > ` + "`1`" + `].n | sum(@)`)
+	v := fastjson.MustParse(`{"items":[{"n":1},{"n":2},{"n":3}]}`)
+
+	ch := make(chan error, 4)
+	for i := 0; i < cap(ch); i++ {
+		go func() {
+			var a fastjson.Arena
+			for j := 0; j < 100; j++ {
+				res, err := e.Search(&a, v)
+				if err != nil {
+					ch <- err
+					return
+				}
+				if s := res.String(); s != "5" {
+					ch <- errors.New("unexpected result " + s)
+					return
+				}
+				a.Reset()
+			}
+			ch <- nil
+		}()
+	}
+	for i := 0; i < cap(ch); i++ {
+		if err := <-ch; err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+}
+
+func TestExprString(t *testing.T) {
+	e := MustCompile(`foo.bar`)
+	if s := e.String(); s != "foo.bar" {
+		t.Fatalf("unexpected String(); got %q; want %q", s, "foo.bar")
+	}
+}
+
+func TestMustCompilePanic(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatalf("expecting panic")
+		}
+	}()
+	MustCompile(`foo.`)
+}
+
+func TestSyntaxError(t *testing.T) {
+	_, err := Compile(`foo.[`)
+	var se *SyntaxError
+	if !errors.As(err, &se) {
+		t.Fatalf("expecting SyntaxError; got %v", err)
+	}
+	if se.Expression != "foo.[" || se.Offset != 5 {
+		t.Fatalf("unexpected SyntaxError: %+v", se)
+	}
+	caretExpected := "foo.[\n     ^ " + se.Msg
+	if caret := se.Caret(); caret != caretExpected {
+		t.Fatalf("unexpected Caret(); got\n%s\nwant\n%s", caret, caretExpected)
+	}
+	if s := se.Error(); !strings.HasPrefix(s, `cannot compile JMESPath "foo.[" at offset 5: `) {
+		t.Fatalf("unexpected Error(): %s", s)
+	}
+}
+
+func TestErrInvalidType(t *testing.T) {
+	v := fastjson.MustParse(`{"a":"foo","b":[1,"x"]}`)
+
+	f := func(expr string) {
+		t.Helper()
+		var a fastjson.Arena
+		_, err := Search(expr, &a, v)
+		if !errors.Is(err, ErrInvalidType) {
+			t.Fatalf("expecting ErrInvalidType for %q; got %v", expr, err)
+		}
+	}
+
+	f(`abs(a)`)
+	f(`sort(b)`)
+	f(`sort_by(b, &@)`)
+	f(`length(&a)`)
+	f(`&a`)
+}
@@ -0,0 +1,45 @@
+package jmespath
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/JimWen/fastjson"
+)
+
+func BenchmarkSearch(b *testing.B) {
+	data, err := os.ReadFile("../testdata/twitter.json")
+	if err != nil {
+		b.Fatalf("cannot read fixture: %s", err)
+	}
+	v, err := fastjson.ParseBytes(data)
+	if err != nil {
+		b.Fatalf("cannot parse fixture: %s", err)
+	}
+	for _, expr := range []string{
+		`search_metadata.count`,
+		`statuses[*].user.screen_name`,
+		`statuses[?retweet_count > ` + "`0`" + `].id_str`,
+		`sort_by(statuses, &user.followers_count)[-1].user.name`,
+		`statuses[*].{id: id_str, tags: length(entities.hashtags)}`,
+	} {
+		b.Run(expr, func(b *testing.B) {
+			benchmarkSearch(b, expr, v)
+		})
+	}
+}
+
+func benchmarkSearch(b *testing.B, expr string, v *fastjson.Value) {
+	e := MustCompile(expr)
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		var a fastjson.Arena
+		for pb.Next() {
+			if _, err := e.Search(&a, v); err != nil {
+				panic(fmt.Errorf("unexpected error for %s: %s", expr, err))
+			}
+			a.Reset()
+		}
+	})
+}
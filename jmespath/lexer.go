@@ -0,0 +1,272 @@
+package jmespath
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/JimWen/fastjson"
+)
+
+type tokenType int
+
+const (
+	tEOF tokenType = iota
+	tUnquotedIdentifier
+	tQuotedIdentifier
+	tRawString
+	tLiteral
+	tNumber
+	tDot
+	tStar
+	tFlatten
+	tFilter
+	tLbracket
+	tRbracket
+	tLbrace
+	tRbrace
+	tLparen
+	tRparen
+	tComma
+	tColon
+	tPipe
+	tOr
+	tAnd
+	tNot
+	tExpref
+	tCurrent
+	tEQ
+	tNE
+	tLT
+	tLTE
+	tGT
+	tGTE
+)
+
+var tokenNames = [...]string{
+	tEOF:                "end of expression",
+	tUnquotedIdentifier: "identifier",
+	tQuotedIdentifier:   "quoted identifier",
+	tRawString:          "raw string",
+	tLiteral:            "literal",
+	tNumber:             "number",
+	tDot:                "'.'",
+	tStar:               "'*'",
+	tFlatten:            "'[]'",
+	tFilter:             "'[?'",
+	tLbracket:           "'['",
+	tRbracket:           "']'",
+	tLbrace:             "'{'",
+	tRbrace:             "'}'",
+	tLparen:             "'('",
+	tRparen:             "')'",
+	tComma:              "','",
+	tColon:              "':'",
+	tPipe:               "'|'",
+	tOr:                 "'||'",
+	tAnd:                "'&&'",
+	tNot:                "'!'",
+	tExpref:             "'&'",
+	tCurrent:            "'@'",
+	tEQ:                 "'=='",
+	tNE:                 "'!='",
+	tLT:                 "'<'",
+	tLTE:                "'<='",
+	tGT:                 "'>'",
+	tGTE:                "'>='",
+}
+
+func (t tokenType) String() string {
+	return tokenNames[t]
+}
+
+// token is a lexical token of JMESPath expression.
+type token struct {
+	typ tokenType
+
+	// s is the identifier name, the raw string, or the number text.
+	s string
+
+	// v is the parsed value of tLiteral.
+	v *fastjson.Value
+
+	// n is the value of tNumber.
+	n int
+
+	// pos is the byte offset of the token in the expression.
+	pos int
+}
+
+// simpleTokens maps single-char tokens to their types.
+var simpleTokens = map[byte]tokenType{
+	'.': tDot,
+	'*': tStar,
+	']': tRbracket,
+	'{': tLbrace,
+	'}': tRbrace,
+	'(': tLparen,
+	')': tRparen,
+	',': tComma,
+	':': tColon,
+	'@': tCurrent,
+}
+
+// tokenize splits the expression s into tokens.
+//
+// The returned tokens always end with tEOF.
+func tokenize(s string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(s) {
+		c := s[i]
+		if c == ' ' || c == '\t' || c == '\n' || c == '\r' {
+			i++
+			continue
+		}
+		t := token{
+			pos: i,
+		}
+		if typ, ok := simpleTokens[c]; ok {
+			t.typ = typ
+			tokens = append(tokens, t)
+			i++
+			continue
+		}
+
+		var err error
+		switch {
+		case isIdentStart(c):
+			n := i + 1
+			for n < len(s) && isIdentChar(s[n]) {
+				n++
+			}
+			t.typ = tUnquotedIdentifier
+			t.s = s[i:n]
+			i = n
+		case c == '-' || c >= '0' && c <= '9':
+			n := i + 1
+			for n < len(s) && s[n] >= '0' && s[n] <= '9' {
+				n++
+			}
+			t.typ = tNumber
+			if t.n, err = strconv.Atoi(s[i:n]); err != nil {
+				return nil, newSyntaxError(s, i, "invalid number %q", s[i:n])
+			}
+			i = n
+		case c == '"':
+			n, err := quotedEnd(s, i, '"')
+			if err != nil {
+				return nil, err
+			}
+			t.typ = tQuotedIdentifier
+			if t.s, err = parseJSONString(s[i:n]); err != nil {
+				return nil, newSyntaxError(s, i, "invalid quoted identifier: %s", err)
+			}
+			i = n
+		case c == '\'':
+			n, err := quotedEnd(s, i, '\'')
+			if err != nil {
+				return nil, err
+			}
+			t.typ = tRawString
+			t.s = strings.ReplaceAll(s[i+1:n-1], `\'`, `'`)
+			i = n
+		case c == '`':
+			n, err := quotedEnd(s, i, '`')
+			if err != nil {
+				return nil, err
+			}
+			t.typ = tLiteral
+			if t.v, err = parseLiteral(strings.ReplaceAll(s[i+1:n-1], "\\`", "`")); err != nil {
+				return nil, newSyntaxError(s, i, "invalid JSON literal: %s", err)
+			}
+			i = n
+		case c == '[':
+			t.typ = tLbracket
+			i++
+			if i < len(s) && s[i] == ']' {
+				t.typ = tFlatten
+				i++
+			} else if i < len(s) && s[i] == '?' {
+				t.typ = tFilter
+				i++
+			}
+		case c == '|':
+			t.typ, i = either(s, i, '|', tOr, tPipe)
+		case c == '&':
+			t.typ, i = either(s, i, '&', tAnd, tExpref)
+		case c == '!':
+			t.typ, i = either(s, i, '=', tNE, tNot)
+		case c == '<':
+			t.typ, i = either(s, i, '=', tLTE, tLT)
+		case c == '>':
+			t.typ, i = either(s, i, '=', tGTE, tGT)
+		case c == '=' && i+1 < len(s) && s[i+1] == '=':
+			t.typ = tEQ
+			i += 2
+		default:
+			return nil, newSyntaxError(s, i, "unexpected character %q", c)
+		}
+		tokens = append(tokens, t)
+	}
+	return append(tokens, token{typ: tEOF, pos: len(s)}), nil
+}
+
+// either returns ifNext if the char following s[i] is next, otherwise it returns typ.
+//
+// The offset of the char following the token is returned as well.
+func either(s string, i int, next byte, ifNext, typ tokenType) (tokenType, int) {
+	if i+1 < len(s) && s[i+1] == next {
+		return ifNext, i + 2
+	}
+	return typ, i + 1
+}
+
+// quotedEnd returns the offset following the closing quote for the string
+// starting with the quote at s[i].
+func quotedEnd(s string, i int, quote byte) (int, error) {
+	for n := i + 1; n < len(s); n++ {
+		switch s[n] {
+		case '\\':
+			n++
+		case quote:
+			return n + 1, nil
+		}
+	}
+	return 0, newSyntaxError(s, i, "unterminated %c", quote)
+}
+
+// parseJSONString returns the value of JSON string s including quotes.
+func parseJSONString(s string) (string, error) {
+	if err := fastjson.Validate(s); err != nil {
+		return "", err
+	}
+	v, err := fastjson.Parse(s)
+	if err != nil {
+		return "", err
+	}
+	return v.ToString()
+}
+
+// parseLiteral parses the contents of JSON literal, i.e. `{"a": 1}`.
+//
+// Literals, which aren't valid JSON, are treated as strings for backwards
+// compatibility with older JMESPath versions, i.e. `foo` is "foo".
+func parseLiteral(s string) (*fastjson.Value, error) {
+	s = strings.TrimSpace(s)
+	if fastjson.Validate(s) == nil {
+		return fastjson.Parse(s)
+	}
+	q := `"` + s + `"`
+	if err := fastjson.Validate(q); err != nil {
+		return nil, err
+	}
+	return fastjson.Parse(q)
+}
+
+func isIdentStart(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_'
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || c >= '0' && c <= '9'
+}
@@ -0,0 +1,79 @@
+package jmespath
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	f := func(s string, typesExpected ...tokenType) {
+		t.Helper()
+		tokens, err := tokenize(s)
+		if err != nil {
+			t.Fatalf("unexpected error when tokenizing %q: %s", s, err)
+		}
+		typesExpected = append(typesExpected, tEOF)
+		if len(tokens) != len(typesExpected) {
+			t.Fatalf("unexpected number of tokens for %q; got %d; want %d", s, len(tokens), len(typesExpected))
+		}
+		for i, tok := range tokens {
+			if tok.typ != typesExpected[i] {
+				t.Fatalf("unexpected token #%d for %q; got %s; want %s", i, s, tok.typ, typesExpected[i])
+			}
+		}
+	}
+
+	f(``)
+	f(`foo.bar`, tUnquotedIdentifier, tDot, tUnquotedIdentifier)
+	f(`"foo bar"`, tQuotedIdentifier)
+	f(`a[] | b[?c >= 'x']`, tUnquotedIdentifier, tFlatten, tPipe, tUnquotedIdentifier, tFilter, tUnquotedIdentifier, tGTE, tRawString, tRbracket)
+	f(`a[-1:2]`, tUnquotedIdentifier, tLbracket, tNumber, tColon, tNumber, tRbracket)
+	f("!a || b && `true` != @", tNot, tUnquotedIdentifier, tOr, tUnquotedIdentifier, tAnd, tLiteral, tNE, tCurrent)
+	f(`sort_by(a, &b)`, tUnquotedIdentifier, tLparen, tUnquotedIdentifier, tComma, tExpref, tUnquotedIdentifier, tRparen)
+	f(`{a: b}.*`, tLbrace, tUnquotedIdentifier, tColon, tUnquotedIdentifier, tRbrace, tDot, tStar)
+	f(`a < b == c > d <= e`, tUnquotedIdentifier, tLT, tUnquotedIdentifier, tEQ, tUnquotedIdentifier, tGT, tUnquotedIdentifier, tLTE, tUnquotedIdentifier)
+}
+
+func TestTokenizeValues(t *testing.T) {
+	tokens, err := tokenize("\"a\\u0062\" 'it\\'s' `{\"x\": [1]}` `legacy` -12")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if s := tokens[0].s; s != "ab" {
+		t.Fatalf("unexpected quoted identifier; got %q; want %q", s, "ab")
+	}
+	if s := tokens[1].s; s != "it's" {
+		t.Fatalf("unexpected raw string; got %q; want %q", s, "it's")
+	}
+	if s := tokens[2].v.String(); s != `{"x":[1]}` {
+		t.Fatalf("unexpected literal; got %s; want %s", s, `{"x":[1]}`)
+	}
+	if s := tokens[3].v.String(); s != `"legacy"` {
+		t.Fatalf("unexpected legacy literal; got %s; want %s", s, `"legacy"`)
+	}
+	if n := tokens[4].n; n != -12 {
+		t.Fatalf("unexpected number; got %d; want %d", n, -12)
+	}
+}
+
+func TestTokenizeError(t *testing.T) {
+	f := func(s string, offsetExpected int) {
+		t.Helper()
+		_, err := tokenize(s)
+		var se *SyntaxError
+		if !errors.As(err, &se) {
+			t.Fatalf("expecting SyntaxError for %q; got %v", s, err)
+		}
+		if se.Offset != offsetExpected {
+			t.Fatalf("unexpected offset for %q; got %d; want %d", s, se.Offset, offsetExpected)
+		}
+	}
+
+	f(`a.#`, 2)
+	f(`a = b`, 2)
+	f(`"foo`, 0)
+	f(`a.'foo`, 2)
+	f("`\"x`", 0)
+	f(`"\x"`, 0)
+	f(`-`, 0)
+}
@@ -0,0 +1,437 @@
+package jmespath
+
+import (
+	"github.com/JimWen/fastjson"
+)
+
+// bindingPowers contains left binding powers of tokens for Pratt parsing.
+//
+// Tokens with zero binding power terminate expressions.
+var bindingPowers = [tGTE + 1]int{
+	tPipe:     1,
+	tOr:       2,
+	tAnd:      3,
+	tEQ:       5,
+	tNE:       5,
+	tLT:       5,
+	tLTE:      5,
+	tGT:       5,
+	tGTE:      5,
+	tFlatten:  9,
+	tStar:     20,
+	tFilter:   21,
+	tDot:      40,
+	tNot:      45,
+	tLbrace:   50,
+	tLbracket: 55,
+	tLparen:   60,
+}
+
+// projectionStop is the binding power, which stops projections.
+//
+// Tokens binding weaker than projectionStop, such as `|` and comparators,
+// are applied to the whole projection result instead of its items.
+const projectionStop = 10
+
+// maxNesting is the maximum nesting depth of expressions.
+const maxNesting = 300
+
+// parser is Pratt parser for JMESPath expressions.
+type parser struct {
+	expr   string
+	tokens []token
+	pos    int
+	depth  int
+
+	// a holds raw string literals. It is never reset, so the literals
+	// remain valid during the compiled expression lifetime.
+	a fastjson.Arena
+}
+
+func (p *parser) parse() (node, error) {
+	x, err := p.parseExpression(0)
+	if err != nil {
+		return nil, err
+	}
+	if t := p.current(); t.typ != tEOF {
+		return nil, p.unexpected(t)
+	}
+	return x, nil
+}
+
+func (p *parser) current() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) lookahead(n int) tokenType {
+	if p.pos+n >= len(p.tokens) {
+		return tEOF
+	}
+	return p.tokens[p.pos+n].typ
+}
+
+func (p *parser) advance() token {
+	t := p.tokens[p.pos]
+	if t.typ != tEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) match(typ tokenType) error {
+	t := p.current()
+	if t.typ != typ {
+		return p.errorf(t, "expecting %s, found %s", typ, t.typ)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *parser) errorf(t token, format string, args ...interface{}) error {
+	return newSyntaxError(p.expr, t.pos, format, args...)
+}
+
+func (p *parser) unexpected(t token) error {
+	return p.errorf(t, "unexpected %s", t.typ)
+}
+
+func (p *parser) parseExpression(bp int) (node, error) {
+	p.depth++
+	defer func() {
+		p.depth--
+	}()
+	if p.depth > maxNesting {
+		return nil, p.errorf(p.current(), "expression nesting exceeds %d", maxNesting)
+	}
+
+	left, err := p.nud(p.advance())
+	if err != nil {
+		return nil, err
+	}
+	for bp < bindingPowers[p.current().typ] {
+		if left, err = p.led(p.advance(), left); err != nil {
+			return nil, err
+		}
+	}
+	return left, nil
+}
+
+// nud parses the expression starting with t.
+func (p *parser) nud(t token) (node, error) {
+	switch t.typ {
+	case tLiteral:
+		return literalNode{v: normalize(t.v)}, nil
+	case tRawString:
+		return literalNode{v: p.a.NewString(t.s)}, nil
+	case tUnquotedIdentifier:
+		return fieldNode{name: t.s}, nil
+	case tQuotedIdentifier:
+		if p.current().typ == tLparen {
+			return nil, p.errorf(t, "quoted identifier cannot be used as a function name")
+		}
+		return fieldNode{name: t.s}, nil
+	case tStar:
+		if p.current().typ == tRbracket {
+			return valueProjectionNode{left: currentNode{}, right: currentNode{}}, nil
+		}
+		right, err := p.parseProjectionRHS(bindingPowers[tStar])
+		if err != nil {
+			return nil, err
+		}
+		return valueProjectionNode{left: currentNode{}, right: right}, nil
+	case tFilter:
+		return p.parseFilter(currentNode{})
+	case tLbrace:
+		return p.parseMultiSelectHash()
+	case tFlatten:
+		right, err := p.parseProjectionRHS(bindingPowers[tFlatten])
+		if err != nil {
+			return nil, err
+		}
+		return projectionNode{left: flattenNode{x: currentNode{}}, right: right}, nil
+	case tLbracket:
+		switch typ := p.current().typ; {
+		case typ == tNumber || typ == tColon:
+			return p.parseIndexExpression(currentNode{})
+		case typ == tStar && p.lookahead(1) == tRbracket:
+			p.pos += 2
+			right, err := p.parseProjectionRHS(bindingPowers[tStar])
+			if err != nil {
+				return nil, err
+			}
+			return projectionNode{left: currentNode{}, right: right}, nil
+		default:
+			return p.parseMultiSelectList()
+		}
+	case tCurrent:
+		return currentNode{}, nil
+	case tExpref:
+		x, err := p.parseExpression(bindingPowers[tExpref])
+		if err != nil {
+			return nil, err
+		}
+		return exprefNode{x: x}, nil
+	case tNot:
+		x, err := p.parseExpression(bindingPowers[tNot])
+		if err != nil {
+			return nil, err
+		}
+		return notNode{x: x}, nil
+	case tLparen:
+		x, err := p.parseExpression(0)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.match(tRparen); err != nil {
+			return nil, err
+		}
+		return x, nil
+	case tEOF:
+		return nil, p.errorf(t, "incomplete expression")
+	default:
+		return nil, p.unexpected(t)
+	}
+}
+
+// led parses the expression continuing left with t.
+func (p *parser) led(t token, left node) (node, error) {
+	switch t.typ {
+	case tDot:
+		if p.current().typ == tStar {
+			p.pos++
+			right, err := p.parseProjectionRHS(bindingPowers[tDot])
+			if err != nil {
+				return nil, err
+			}
+			return valueProjectionNode{left: left, right: right}, nil
+		}
+		right, err := p.parseDotRHS(bindingPowers[tDot])
+		if err != nil {
+			return nil, err
+		}
+		return subexprNode{left: left, right: right}, nil
+	case tPipe:
+		right, err := p.parseExpression(bindingPowers[tPipe])
+		if err != nil {
+			return nil, err
+		}
+		return pipeNode{left: left, right: right}, nil
+	case tOr:
+		right, err := p.parseExpression(bindingPowers[tOr])
+		if err != nil {
+			return nil, err
+		}
+		return orNode{left: left, right: right}, nil
+	case tAnd:
+		right, err := p.parseExpression(bindingPowers[tAnd])
+		if err != nil {
+			return nil, err
+		}
+		return andNode{left: left, right: right}, nil
+	case tLparen:
+		f, ok := left.(fieldNode)
+		if !ok {
+			return nil, p.errorf(t, "function name must be an identifier")
+		}
+		return p.parseFunction(f.name, t)
+	case tFilter:
+		return p.parseFilter(left)
+	case tFlatten:
+		right, err := p.parseProjectionRHS(bindingPowers[tFlatten])
+		if err != nil {
+			return nil, err
+		}
+		return projectionNode{left: flattenNode{x: left}, right: right}, nil
+	case tEQ, tNE, tLT, tLTE, tGT, tGTE:
+		right, err := p.parseExpression(bindingPowers[t.typ])
+		if err != nil {
+			return nil, err
+		}
+		return comparatorNode{op: t.typ, left: left, right: right}, nil
+	case tLbracket:
+		if typ := p.current().typ; typ == tNumber || typ == tColon {
+			return p.parseIndexExpression(left)
+		}
+		if err := p.match(tStar); err != nil {
+			return nil, err
+		}
+		if err := p.match(tRbracket); err != nil {
+			return nil, err
+		}
+		right, err := p.parseProjectionRHS(bindingPowers[tStar])
+		if err != nil {
+			return nil, err
+		}
+		return projectionNode{left: left, right: right}, nil
+	default:
+		return nil, p.unexpected(t)
+	}
+}
+
+// parseIndexExpression parses `[n]` or `[start:stop:step]` applied to left.
+//
+// The opening bracket has been already consumed.
+func (p *parser) parseIndexExpression(left node) (node, error) {
+	if p.lookahead(0) == tColon || p.lookahead(1) == tColon {
+		return p.parseSlice(left)
+	}
+	t := p.advance()
+	if err := p.match(tRbracket); err != nil {
+		return nil, err
+	}
+	return subexprNode{left: left, right: indexNode{i: t.n}}, nil
+}
+
+// parseSlice parses `[start:stop:step]`, which projects the rest
+// of the expression onto the sliced items.
+func (p *parser) parseSlice(left node) (node, error) {
+	var s sliceNode
+	parts := [3]**int{&s.start, &s.stop, &s.step}
+	i := 0
+	for t := p.current(); t.typ != tRbracket; t = p.current() {
+		switch {
+		case t.typ == tColon && i < len(parts)-1:
+			i++
+		case t.typ == tNumber && *parts[i] == nil:
+			if i == 2 && t.n == 0 {
+				return nil, p.errorf(t, "slice step cannot be 0")
+			}
+			n := t.n
+			*parts[i] = &n
+		default:
+			return nil, p.unexpected(t)
+		}
+		p.pos++
+	}
+	p.pos++
+
+	right, err := p.parseProjectionRHS(bindingPowers[tStar])
+	if err != nil {
+		return nil, err
+	}
+	return projectionNode{left: subexprNode{left: left, right: s}, right: right}, nil
+}
+
+// parseFilter parses `[?cond]` applied to left.
+func (p *parser) parseFilter(left node) (node, error) {
+	cond, err := p.parseExpression(0)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.match(tRbracket); err != nil {
+		return nil, err
+	}
+	var right node = currentNode{}
+	if p.current().typ != tFlatten {
+		if right, err = p.parseProjectionRHS(bindingPowers[tFilter]); err != nil {
+			return nil, err
+		}
+	}
+	return filterProjectionNode{left: left, cond: cond, right: right}, nil
+}
+
+// parseDotRHS parses the expression following `.`.
+func (p *parser) parseDotRHS(bp int) (node, error) {
+	switch t := p.current(); t.typ {
+	case tUnquotedIdentifier, tQuotedIdentifier, tStar:
+		return p.parseExpression(bp)
+	case tLbracket:
+		p.pos++
+		return p.parseMultiSelectList()
+	case tLbrace:
+		p.pos++
+		return p.parseMultiSelectHash()
+	default:
+		return nil, p.errorf(t, "expecting identifier, '[' or '{', found %s", t.typ)
+	}
+}
+
+// parseProjectionRHS parses the expression applied to every projected item.
+func (p *parser) parseProjectionRHS(bp int) (node, error) {
+	switch t := p.current(); {
+	case bindingPowers[t.typ] < projectionStop:
+		return currentNode{}, nil
+	case t.typ == tLbracket, t.typ == tFilter:
+		return p.parseExpression(bp)
+	case t.typ == tDot:
+		p.pos++
+		return p.parseDotRHS(bp)
+	default:
+		return nil, p.unexpected(t)
+	}
+}
+
+// parseMultiSelectList parses `[a, b]`. The opening bracket has been already consumed.
+func (p *parser) parseMultiSelectList() (node, error) {
+	var items []node
+	for {
+		x, err := p.parseExpression(0)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, x)
+		if p.current().typ == tRbracket {
+			p.pos++
+			return multiSelectListNode{items: items}, nil
+		}
+		if err := p.match(tComma); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// parseMultiSelectHash parses `{a: b, c: d}`. The opening brace has been already consumed.
+func (p *parser) parseMultiSelectHash() (node, error) {
+	var h multiSelectHashNode
+	for {
+		t := p.advance()
+		if t.typ != tUnquotedIdentifier && t.typ != tQuotedIdentifier {
+			return nil, p.errorf(t, "expecting identifier, found %s", t.typ)
+		}
+		if err := p.match(tColon); err != nil {
+			return nil, err
+		}
+		x, err := p.parseExpression(0)
+		if err != nil {
+			return nil, err
+		}
+		h.keys = append(h.keys, t.s)
+		h.values = append(h.values, x)
+		if p.current().typ == tRbrace {
+			p.pos++
+			return h, nil
+		}
+		if err := p.match(tComma); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// parseFunction parses arguments of the function with the given name.
+//
+// The opening parenthesis t has been already consumed.
+func (p *parser) parseFunction(name string, t token) (node, error) {
+	var args []node
+	for p.current().typ != tRparen {
+		if len(args) > 0 {
+			if err := p.match(tComma); err != nil {
+				return nil, err
+			}
+		}
+		x, err := p.parseExpression(0)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, x)
+	}
+	p.pos++
+
+	f, ok := functions[name]
+	if !ok {
+		return nil, p.errorf(t, "unknown function %s()", name)
+	}
+	if err := f.checkArity(len(args)); err != nil {
+		return nil, p.errorf(t, "%s", err)
+	}
+	return &functionNode{name: name, f: f, args: args}, nil
+}
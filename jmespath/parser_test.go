@@ -0,0 +1,47 @@
+package jmespath
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseError(t *testing.T) {
+	f := func(expr string, offsetExpected int) {
+		t.Helper()
+		_, err := Compile(expr)
+		var se *SyntaxError
+		if !errors.As(err, &se) {
+			t.Fatalf("expecting SyntaxError for %q; got %v", expr, err)
+		}
+		if se.Offset != offsetExpected {
+			t.Fatalf("unexpected offset for %q; got %d; want %d (%s)", expr, se.Offset, offsetExpected, se.Msg)
+		}
+	}
+
+	f(`foo.`, 4)
+	f(`foo bar`, 4)
+	f(`foo[`, 4)
+	f(`foo[::0]`, 6)
+	f(`foo[1 2]`, 6)
+	f(`foo[1:2:3:4]`, 9)
+	f(`foo[1:2`, 7)
+	f(`{a b}`, 3)
+	f(`[a, ]`, 4)
+	f(`a | | b`, 4)
+	f(`abs(a b)`, 6)
+	f(`foo(@)`, 3)
+	f(`a.[b`, 4)
+}
+
+func TestParseNesting(t *testing.T) {
+	expr := strings.Repeat("[", maxNesting+1) + "a" + strings.Repeat("]", maxNesting+1)
+	if _, err := Compile(expr); err == nil {
+		t.Fatalf("expecting error for too deep nesting")
+	}
+
+	expr = strings.Repeat("[", 10) + "a" + strings.Repeat("]", 10)
+	if _, err := Compile(expr); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
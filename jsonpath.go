@@ -5,88 +5,101 @@ import (
 	"errors"
 	"fmt"
 	"github.com/JimWen/fastjson/fastfloat"
-	"go/token"
-	"go/types"
 	"regexp"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
-var ErrGetFromNullObj = errors.New("get attribute from null object")
+var ErrGetFromNullObj error = &lookupError{msg: "get attribute from null object", kind: ErrTypeMismatch}
 
 // 操作符参数
 type Param struct {
-	p       string
-	isField bool // 是否是json字段 否则为常量
+	p        string
+	isField  bool       // 是否是json字段 否则为常量
+	quoted   bool       // 常量是否为引号包围的字符串
+	fromRoot bool       // 字段是否从$根节点开始取值
+	steps    []step     // 字段在Compile时预解析得到的取值路径
+	v        *Value     // 常量在Compile时预解析得到的值
+	fn       *funcExpr  // 函数调用在Compile时预解析得到的表达式
+	arith    *arithExpr // 算术表达式 如@.price * @.qty
+	name     string     // 变量占位符$$name的变量名 其值在Bind时写入v
+	fnVars   []string   // fn参数中$$name占位符的变量名 Bind时以其值重新编译fn
+	fnBound  bool       // fn参数中的占位符是否已绑定
+	pos      int        // 操作数在过滤三元组中的字节偏移 用于报告编译错误
 }
 
 // 过滤操作对应的计算三元组
 type FilterTuple struct {
-	lp Param
-	op string
-	rp Param
+	lp  Param
+	op  string
+	rp  Param
+	reg *regexp.Regexp // op为=~时在Compile时预编译的正则
 }
 
 // 逻辑表达式串联的计算三元组
 type FilterTupleGroup struct {
-	tuples  []FilterTuple
-	logics  []string
-	mustOne bool
+	tuples []FilterTuple // 表达式中的所有三元组 按出现顺序排列
+	expr   *filterExpr   // 由三元组通过&& || !及括号组成的逻辑表达式
+	text   string        // 表达式的原始文本
 }
 
+// 过滤逻辑表达式的语法树节点
+type filterExpr struct {
+	logic string        // &&, || 或 ! 为空时表示叶子节点
+	args  []*filterExpr // logic的操作数
+	tuple int           // 叶子节点对应的三元组下标
+}
+
+// JsonPathLookupRaw与JsonPathLookup相同 但返回转换后的Go值
+// jpath的编译结果缓存在DefaultPathCache中
 func JsonPathLookupRaw(obj *Value, jpath string) (interface{}, error) {
-	c, err := Compile(jpath)
-	if err != nil {
-		return nil, err
-	}
+	return defaultPathCache.LookupRaw(obj, jpath)
+}
 
-	v, err := c.Lookup(obj)
-	if err != nil {
-		return nil, err
+// 将v转换为对应的Go值
+func raw_value(v *Value) interface{} {
+	if v == nil {
+		return nil
 	}
-
 	switch v.t {
 	case TypeObject:
-		return v.o, nil
+		return v.o
 	case TypeArray:
-		return v.a, nil
+		return v.a
 	case TypeString:
-		return v.s, nil
+		return v.s
 	case typeRawString:
-		return v.s, nil
+		return v.s
 	case TypeNumber:
-		return fastfloat.ParseBestEffort(v.s), nil
+		return fastfloat.ParseBestEffort(v.s)
 	case TypeTrue:
-		return true, nil
+		return true
 	case TypeFalse:
-		return false, nil
+		return false
 	case TypeNull:
-		return nil, nil
+		return nil
 	}
 
-	return nil, nil
+	return nil
 }
 
+// JsonPathLookup编译jpath并在obj上执行查找
+// jpath的编译结果缓存在DefaultPathCache中
 func JsonPathLookup(obj *Value, jpath string) (*Value, error) {
-	c, err := Compile(jpath)
-	if err != nil {
-		return nil, err
-	}
-	return c.Lookup(obj)
+	return defaultPathCache.Lookup(obj, jpath)
 }
 
+// JsonPathExists返回jpath在obj中是否存在 jpath非法时返回false
+// jpath的编译结果缓存在DefaultPathCache中
 func JsonPathExists(obj *Value, jpath string) bool {
-	c, err := Compile(jpath)
-	if err != nil {
-		return false
-	}
-
-	return c.Exists(obj)
+	return defaultPathCache.Exists(obj, jpath)
 }
 
 type Compiled struct {
 	path  string
 	steps []step
+	query *rfcQuery // CompileRFC9535编译得到的标准查询
 }
 
 type step struct {
@@ -104,33 +117,58 @@ func MustCompile(jpath string) *Compiled {
 }
 
 func Compile(jpath string) (*Compiled, error) {
-	tokens, err := tokenize(jpath, false)
+	tokens, offsets, err := tokenize_pos(jpath, false)
 	if err != nil {
 		return nil, err
 	}
-	if tokens[0] != "@" && tokens[0] != "$" {
-		return nil, fmt.Errorf("$ or @ should in front of path")
+	if len(tokens) == 0 || tokens[0] != "@" && tokens[0] != "$" {
+		return nil, newPathSyntaxError(jpath, 0, "'$' or '@'", "")
 	}
-	tokens = tokens[1:]
+	tokens, offsets = tokens[1:], offsets[1:]
 	res := Compiled{
 		path:  jpath,
 		steps: make([]step, len(tokens)),
 	}
 	for i, token := range tokens {
+		// 错误位置为token内的偏移时 换算为jpath中的偏移
 		op, key, args, err := parse_token(token)
 		if err != nil {
-			return nil, err
+			return nil, toPathSyntaxError(jpath, offsets[i], err)
+		}
+		if op == "filter" {
+			// filter在Compile时一次性解析 Lookup时不再重复解析
+			if args, err = compile_filter(token, args); err != nil {
+				return nil, toPathSyntaxError(jpath, offsets[i], err)
+			}
 		}
 		res.steps[i] = step{op, key, args}
 	}
 	return &res, nil
 }
 
+// 将filter的原始文本解析为FilterTupleGroup
+func compile_filter(token string, args interface{}) (*FilterTupleGroup, error) {
+	filter, ok := args.(string)
+	if !ok || len(filter) == 0 {
+		return nil, newPathSyntaxError(token, strings.IndexByte(token, '['), "filter expression in the form of [?(...)]", "")
+	}
+
+	filterGroup, err := parse_filter_group(filter)
+	if err != nil {
+		return nil, toPathSyntaxError(token, strings.Index(token, filter), err)
+	}
+	return &filterGroup, nil
+}
+
 func (c *Compiled) String() string {
 	return fmt.Sprintf("Compiled lookup: %s", c.path)
 }
 
 func (c *Compiled) Exists(root *Value) bool {
+	if c.query != nil {
+		return len(c.query.selectNodes(root, node{v: root}, false, nil)) > 0
+	}
+
 	v, err := c.Lookup(root)
 	if err != nil {
 		return false
@@ -139,123 +177,327 @@ func (c *Compiled) Exists(root *Value) bool {
 	return v.Exists() && !v.Empty()
 }
 
+// Lookup returns the value matched by c in root.
+//
+// An array holding all the matched values is returned if c may match
+// multiple values, i.e. it contains wildcards, ranges, filters over arrays
+// or descendant steps. The array is empty if nothing is matched. Paths
+// compiled with CompileRFC9535 always return such an array.
+//
+// Otherwise the single matched value is returned. An error wrapping
+// ErrPathNotFound is returned if it is missing, i.e. a filter over
+// an object doesn't match the object.
 func (c *Compiled) Lookup(root *Value) (*Value, error) {
-	var err error
+	if c.query != nil {
+		return c.query.lookup(root), nil
+	}
 
-	obj := root
-	for _, s := range c.steps {
-		// "key", "idx"
-		switch s.op {
-		case "key":
-			// 支持$.key1.key2
-			if len(s.key) > 0 {
-				obj, err = get_key(obj, s.key)
-				if err != nil {
-					return nil, err
+	nodes, multi, err := c.lookup_nodes(root, false)
+	if err != nil {
+		return nil, err
+	}
+	if multi {
+		res := make([]*Value, len(nodes))
+		for i, n := range nodes {
+			res[i] = n.v
+		}
+		return &Value{a: res, t: TypeArray}, nil
+	}
+	if len(nodes) == 0 {
+		return nil, notFoundErrorf("path not found: %s", c)
+	}
+	return nodes[0].v, nil
+}
+
+// 依次执行所有step 返回命中的节点以及结果是否为多值
+// paths为true时记录每个节点在文档中的位置
+func (c *Compiled) lookup_nodes(root *Value, paths bool) ([]node, bool, error) {
+	return lookup_steps(c.steps, []node{{v: root}}, root, false, paths, nil)
+}
+
+// 从nodes开始依次执行steps multi表示nodes是否已经是多值结果
+// lim不为nil时限制访问的节点数 递归深度及最后一个step选取的结果数 超出时返回LimitError
+func lookup_steps(steps []step, nodes []node, root *Value, multi, paths bool, lim *evalLimiter) ([]node, bool, error) {
+	for i := 0; i < len(steps); i++ {
+		s := steps[i]
+		scan := false
+		if s.op == "scan" {
+			// 递归下降`..` 展开为当前节点及其所有后代 再对每个节点执行下一个step
+			all := make([]node, 0, len(nodes))
+			for _, n := range nodes {
+				all = walk_descendants(all, n, paths, lim)
+			}
+			if lim.exceeded() {
+				return nil, false, lim.err
+			}
+			multi = true
+			if i+1 == len(steps) {
+				// 末尾的`..*` 选取所有后代
+				res := make([]node, 0, len(all))
+				for _, n := range all {
+					ns := children(n, paths)
+					if !lim.visit(len(ns)) || !lim.results(len(res)+len(ns)) {
+						return nil, false, lim.err
+					}
+					res = append(res, ns...)
 				}
+				nodes = res
+				break
 			}
+			nodes = all
+			scan = true
+			i++
+			s = steps[i]
+		}
 
-			// 如下支持 ['key1', 'key2'] or key3['key1', 'key2'] 计算
-			if s.args == nil {
-				continue
+		res := make([]node, 0, len(nodes))
+		for _, n := range nodes {
+			ns, more, err := apply_step(n, root, s, !multi, scan, paths, lim)
+			if err != nil {
+				return nil, false, err
+			}
+			if !lim.visit(len(ns)) {
+				return nil, false, lim.err
 			}
+			if i+1 == len(steps) && !lim.results(len(res)+len(ns)) {
+				return nil, false, lim.err
+			}
+			if more {
+				multi = true
+			}
+			res = append(res, ns...)
+		}
+		nodes = res
 
-			if len(s.args.([]string)) > 1 {
-				res := &Value{a: make([]*Value, 0), t: TypeArray}
-				for _, x := range s.args.([]string) {
-					tmp, err := get_key(obj, x)
-					if err != nil {
-						return nil, err
-					}
-					res.a = append(res.a, tmp)
-				}
-				obj = res
-			} else if len(s.args.([]string)) == 1 {
-				obj, err = get_key(obj, s.args.([]string)[0])
+		if !multi && len(nodes) == 0 {
+			return nil, false, nil
+		}
+	}
+	return nodes, multi, nil
+}
+
+// 在单个节点上执行step 返回命中的节点以及结果是否为多值
+// strict为true时 key/idx不存在等查找失败直接返回错误 否则跳过该节点
+// scan为true表示处于递归下降中 此时key只作用于对象 filter作用于对象和数组的子节点
+func apply_step(obj node, root *Value, s step, strict, scan, paths bool, lim *evalLimiter) ([]node, bool, error) {
+	nodes := []node{obj}
+	multi := false
+	if len(s.key) > 0 {
+		var err error
+		nodes, multi, err = select_key(obj, s.key, strict, scan, paths)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	strict = strict && !multi
+
+	var res []node
+	switch s.op {
+	case "key":
+		// 支持$.key1.key2
+		if s.args == nil {
+			return nodes, multi, nil
+		}
+
+		// 如下支持 ['key1', 'key2'] or key3['key1', 'key2'] 计算
+		keys := s.args.([]string)
+		if len(keys) == 0 {
+			return nil, false, fmt.Errorf("cannot index on empty key slice")
+		}
+		if len(keys) > 1 {
+			multi = true
+			strict = false
+		}
+		for _, n := range nodes {
+			for _, k := range keys {
+				ns, more, err := select_key(n, k, strict, scan, paths)
 				if err != nil {
-					return nil, err
+					return nil, false, err
 				}
-			} else {
-				return nil, fmt.Errorf("cannot index on empty key slice")
-			}
-		case "idx":
-			if len(s.key) > 0 {
-				// no key `$[0].test`
-				obj, err = get_key(obj, s.key)
-				if err != nil {
-					return nil, err
+				if more {
+					multi = true
 				}
+				res = append(res, ns...)
 			}
-
-			if len(s.args.([]int)) > 1 {
-				res := &Value{a: make([]*Value, 0), t: TypeArray}
-				for _, x := range s.args.([]int) {
-					//fmt.Println("idx ---- ", x)
-					tmp, err := get_idx(obj, x)
-					if err != nil {
-						return nil, err
+		}
+	case "idx":
+		idxs := s.args.([]int)
+		if len(idxs) == 0 {
+			return nil, false, fmt.Errorf("cannot index on empty index slice")
+		}
+		if len(idxs) > 1 {
+			multi = true
+		}
+		for _, n := range nodes {
+			for _, idx := range idxs {
+				if _, err := get_idx(n.v, idx); err != nil {
+					if strict {
+						return nil, false, err
 					}
-					res.a = append(res.a, tmp)
+					continue
 				}
-				obj = res
-			} else if len(s.args.([]int)) == 1 {
-				//fmt.Println("idx ----------------3")
-				obj, err = get_idx(obj, s.args.([]int)[0])
-				if err != nil {
-					return nil, err
+				if idx < 0 {
+					idx += len(n.v.a)
 				}
-			} else {
-				//fmt.Println("idx ----------------4")
-				return nil, fmt.Errorf("cannot index on empty index slice")
+				res = append(res, n.element(idx, paths))
 			}
-		case "range":
-			if len(s.key) > 0 {
-				// no key `$[:1].test`
-				obj, err = get_key(obj, s.key)
-				if err != nil {
-					return nil, err
-				}
+		}
+	case "range":
+		var frm, to, stp interface{}
+		switch argsv := s.args.(type) {
+		case [2]interface{}:
+			frm, to = argsv[0], argsv[1]
+		case [3]interface{}:
+			frm, to, stp = argsv[0], argsv[1], argsv[2]
+		default:
+			return nil, false, fmt.Errorf("range args length should be 2 or 3")
+		}
+		multi = true
+		for _, n := range nodes {
+			if frm == nil && to == nil && stp == nil && n.v.t == TypeObject {
+				// [*] 按文档顺序选取对象的所有成员值
+				res = append(res, children(n, paths)...)
+				continue
 			}
-			if argsv, ok := s.args.([2]interface{}); ok == true {
-				obj, err = get_range(obj, argsv[0], argsv[1])
-				if err != nil {
-					return nil, err
+			idxs, err := get_range_idxs(n.v, frm, to, stp)
+			if err != nil {
+				if strict {
+					return nil, false, err
 				}
-			} else {
-				return nil, fmt.Errorf("range args length should be 2")
+				continue
 			}
-		case "filter":
-			obj, err = get_key(obj, s.key)
-			if err != nil {
-				return nil, err
+			for _, i := range idxs {
+				res = append(res, n.element(i, paths))
+			}
+		}
+	case "filter":
+		for _, n := range nodes {
+			if !strict && n.v.t != TypeArray && n.v.t != TypeObject {
+				continue
 			}
 
-			isArr, ret, err := get_filtered(obj, root, s.args.(string))
+			isArr, ret, err := get_filtered(n, root, s.args.(*FilterTupleGroup), scan, paths, lim)
 			if err != nil {
-				return nil, err
+				return nil, false, err
 			}
-
 			if isArr {
-				obj = &Value{a: ret, t: TypeArray}
-			} else {
-				if len(ret) == 0 {
-					return nil, nil
-				}
+				multi = true
+			}
+			res = append(res, ret...)
+		}
+	default:
+		return nil, false, fmt.Errorf("expression don't support in filter")
+	}
+
+	return res, multi, nil
+}
 
-				obj = ret[0]
+// 按key选取子节点 非递归下降时数组会对每个元素分别取key
+func select_key(obj node, key string, strict, scan, paths bool) ([]node, bool, error) {
+	switch obj.v.t {
+	case TypeObject:
+		v := obj.v.Get(key)
+		if v == nil {
+			if strict {
+				return nil, false, notFoundErrorf("key error: %s not found in object", key)
 			}
-		default:
-			return nil, fmt.Errorf("expression don't support in filter")
+			return nil, false, nil
+		}
+		return []node{obj.member(key, v, paths)}, false, nil
+	case TypeArray:
+		if scan {
+			return nil, false, nil
+		}
+		res := make([]node, 0, len(obj.v.a))
+		for i, v := range obj.v.a {
+			if x := v.Get(key); x != nil {
+				res = append(res, obj.element(i, paths).member(key, x, paths))
+			}
+		}
+		return res, true, nil
+	default:
+		if strict {
+			return nil, false, typeMismatchErrorf("fail to exec get_key:%s, object is not map", key)
+		}
+		return nil, false, nil
+	}
+}
+
+// 返回对象的所有成员值或数组的所有元素 其他类型返回nil
+func children(obj node, paths bool) []node {
+	switch obj.v.t {
+	case TypeObject:
+		if paths {
+			obj.v.o.unescapeKeys()
+		}
+		res := make([]node, len(obj.v.o.kvs))
+		for i, kv := range obj.v.o.kvs {
+			res[i] = obj.member(kv.k, kv.v, paths)
+		}
+		return res
+	case TypeArray:
+		res := make([]node, len(obj.v.a))
+		for i := range obj.v.a {
+			res[i] = obj.element(i, paths)
+		}
+		return res
+	default:
+		return nil
+	}
+}
+
+// 按文档顺序将obj及其所有后代追加到dst
+// lim超出限制时停止遍历 调用方需检查lim.exceeded()
+func walk_descendants(dst []node, obj node, paths bool, lim *evalLimiter) []node {
+	if !lim.visit(1) {
+		return dst
+	}
+	dst = append(dst, obj)
+	switch obj.v.t {
+	case TypeObject:
+		if len(obj.v.o.kvs) == 0 || !lim.descend() {
+			return dst
+		}
+		if paths {
+			obj.v.o.unescapeKeys()
+		}
+		for _, kv := range obj.v.o.kvs {
+			dst = walk_descendants(dst, obj.member(kv.k, kv.v, paths), paths, lim)
+		}
+		lim.ascend()
+	case TypeArray:
+		if len(obj.v.a) == 0 || !lim.descend() {
+			return dst
+		}
+		for i := range obj.v.a {
+			dst = walk_descendants(dst, obj.element(i, paths), paths, lim)
 		}
+		lim.ascend()
 	}
-	return obj, nil
+	return dst
 }
 
 func tokenize(query string, isFilter bool) ([]string, error) {
+	tokens, _, err := tokenize_pos(query, isFilter)
+	return tokens, err
+}
+
+// 与tokenize相同 同时返回每个token在query中的字节偏移
+func tokenize_pos(query string, isFilter bool) ([]string, []int, error) {
 	tokens := []string{}
+	offsets := []int{}
 	//	token_start := false
 	//	token_end := false
 	token := ""
+	token_start := 0
+	emit := func(t string, offset int) {
+		tokens = append(tokens, t)
+		offsets = append(offsets, offset)
+	}
+	// 方括号内需要跳过引号包围的字符串及嵌套的方括号 如 [?(match(@.id, '[a-z]+'))]
+	depth := 0
+	var quote rune
+	escaped := false
 
 	// fmt.Println("-------------------------------------------------- start")
 	for idx, x := range query {
@@ -263,11 +505,12 @@ func tokenize(query string, isFilter bool) ([]string, error) {
 		// //fmt.Printf("idx: %d, x: %s, token: %s, tokens: %v\n", idx, string(x), token, tokens)
 		if idx == 0 {
 			if token == "$" || token == "@" {
-				tokens = append(tokens, token[:])
+				emit(token[:], 0)
 				token = ""
+				token_start = idx + 1
 			} else if !isFilter {
 				// 对于filter 不强制要求必须$/@开头 默认字段取@含义
-				return nil, fmt.Errorf("should start with '$'")
+				return nil, nil, newPathSyntaxError(query, 0, "'$' or '@'", "")
 			}
 
 			continue
@@ -275,33 +518,63 @@ func tokenize(query string, isFilter bool) ([]string, error) {
 		if token == "." {
 			continue
 		} else if token == ".." {
+			if len(tokens) == 0 {
+				// filter中省略@的字段不能以..开头 如?(..b)
+				return nil, nil, newPathSyntaxError(query, 0, "'@', '$' or member name", "")
+			}
 			if tokens[len(tokens)-1] != "*" {
-				tokens = append(tokens, "*")
+				emit("*", idx-1)
 			}
 			token = "."
+			token_start = idx
 			continue
 		} else {
 			// fmt.Println("else: ", string(x), token)
 			if strings.Contains(token, "[") {
 				// fmt.Println(" contains [ ")
-				if x == ']' && !strings.HasSuffix(token, "\\]") {
+				switch {
+				case escaped:
+					escaped = false
+				case x == '\\':
+					escaped = true
+				case quote != 0:
+					if x == quote {
+						quote = 0
+					}
+				case x == '\'' || x == '"':
+					quote = x
+				case x == '[':
+					depth++
+				case x == ']':
+					depth--
+					if depth > 0 {
+						continue
+					}
 					if token[0] == '.' {
-						tokens = append(tokens, token[1:])
-					} else {
-						tokens = append(tokens, token[:])
+						token = token[1:]
+						token_start++
+					}
+					if strings.HasPrefix(token, "*[") {
+						// `*[...]` 先选取所有子节点 再对每个子节点执行方括号
+						emit("[*]", token_start)
+						token = token[1:]
+						token_start++
 					}
+					emit(token[:], token_start)
 					token = ""
+					token_start = idx + 1
 					continue
 				}
 			} else {
 				// fmt.Println(" doesn't contains [ ")
 				if x == '.' {
 					if token[0] == '.' {
-						tokens = append(tokens, token[1:len(token)-1])
+						emit(wildcard_token(token[1:len(token)-1]), token_start+1)
 					} else {
-						tokens = append(tokens, token[:len(token)-1])
+						emit(wildcard_token(token[:len(token)-1]), token_start)
 					}
 					token = "."
+					token_start = idx
 					continue
 				}
 			}
@@ -310,22 +583,26 @@ func tokenize(query string, isFilter bool) ([]string, error) {
 	if len(token) > 0 {
 		if token[0] == '.' {
 			token = token[1:]
-			if token != "*" {
-				tokens = append(tokens, token[:])
-			} else if tokens[len(tokens)-1] != "*" {
-				tokens = append(tokens, token[:])
-			}
-		} else {
-			if token != "*" {
-				tokens = append(tokens, token[:])
-			} else if tokens[len(tokens)-1] != "*" {
-				tokens = append(tokens, token[:])
-			}
+			token_start++
+		}
+		if token != "*" {
+			emit(token[:], token_start)
+		} else if len(tokens) == 0 || tokens[len(tokens)-1] != "*" {
+			// 末尾的`..*`由scan处理 `.*`等同于`[*]`
+			emit(wildcard_token(token), token_start)
 		}
 	}
 	// fmt.Println("finished tokens: ", tokens)
 	// fmt.Println("================================================= done ")
-	return tokens, nil
+	return tokens, offsets, nil
+}
+
+// `.*`选取对象或数组的所有子节点 与`[*]`含义相同 避免与scan token混淆
+func wildcard_token(token string) string {
+	if token == "*" {
+		return "[*]"
+	}
+	return token
 }
 
 /*
@@ -345,14 +622,21 @@ func parse_token(token string) (op string, key string, args interface{}, err err
 	} else {
 		key = token[:bracket_idx]
 		tail := token[bracket_idx:]
-		if len(tail) < 3 {
-			err = fmt.Errorf("len(tail) should >=3, %v", tail)
+		if len(tail) < 3 || tail[len(tail)-1] != ']' {
+			err = newPathSyntaxError(token, bracket_idx+1, "index, range, member name or filter", "")
 			return
 		}
 		tail = tail[1 : len(tail)-1]
 
 		//fmt.Println(key, tail)
-		if strings.Contains(tail, "?") {
+		if t := strings.TrimLeft(tail, " "); len(t) > 0 && (t[0] == '\'' || t[0] == '"') {
+			// 引号包围的key 可包含任意字符及JSON转义 如['a.b', "x-y"]
+			op = "key"
+			if args, err = parse_quoted_keys(tail); err != nil {
+				err = toPathSyntaxError(token, bracket_idx+1, err)
+			}
+			return
+		} else if strings.Contains(tail, "?") {
 			// filter -------------------------------------------------
 			op = "filter"
 			if strings.HasPrefix(tail, "?(") && strings.HasSuffix(tail, ")") {
@@ -361,34 +645,49 @@ func parse_token(token string) (op string, key string, args interface{}, err err
 			return
 		} else if strings.Contains(tail, ":") {
 			// range ----------------------------------------------
+			// [from:to] 或 [from:to:step] 其中to包含在结果中
 			op = "range"
 			tails := strings.Split(tail, ":")
-			if len(tails) != 2 {
-				err = fmt.Errorf("only support one range(from, to): %v", tails)
+			// 每段在token中的偏移 用于报告错误位置
+			offs := make([]int, len(tails))
+			off := bracket_idx + 1
+			for i, x := range tails {
+				offs[i] = off + len(x) - len(strings.TrimLeft(x, " "))
+				off += len(x) + 1
+			}
+			if len(tails) != 2 && len(tails) != 3 {
+				err = newPathSyntaxError(token, offs[3]-1, "']'", "")
 				return
 			}
-			var frm interface{}
-			var to interface{}
-			if frm, err = strconv.Atoi(strings.Trim(tails[0], " ")); err != nil {
-				if strings.Trim(tails[0], " ") == "" {
-					err = nil
+			bounds := make([]interface{}, len(tails))
+			for i, x := range tails {
+				x = strings.Trim(x, " ")
+				if x == "" {
+					continue
 				}
-				frm = nil
-			}
-			if to, err = strconv.Atoi(strings.Trim(tails[1], " ")); err != nil {
-				if strings.Trim(tails[1], " ") == "" {
-					err = nil
+				if bounds[i], err = strconv.Atoi(x); err != nil {
+					err = newPathSyntaxError(token, offs[i], "integer", "")
+					return
 				}
-				to = nil
 			}
-			args = [2]interface{}{frm, to}
+			if len(bounds) == 2 {
+				args = [2]interface{}{bounds[0], bounds[1]}
+				return
+			}
+			if bounds[2] == 0 {
+				err = newPathSyntaxError(token, offs[2], "non-zero range step", "")
+				return
+			}
+			args = [3]interface{}{bounds[0], bounds[1], bounds[2]}
 			return
 		} else if tail == "*" {
 			op = "range"
 			args = [2]interface{}{nil, nil}
 			return
 		} else {
-			op, args, err = parse_bracket_token(tail)
+			if op, args, err = parse_bracket_token(tail); err != nil {
+				err = toPathSyntaxError(token, bracket_idx+1, err)
+			}
 		}
 	}
 
@@ -401,7 +700,7 @@ func parse_bracket_token(token string) (op string, args interface{}, err error)
 	hasKey := false
 	hasOp := false
 	hasLogic := false
-	for _, v := range token {
+	for i, v := range token {
 		switch v {
 		// 字符串引号
 		case '\'':
@@ -418,7 +717,7 @@ func parse_bracket_token(token string) (op string, args interface{}, err error)
 		default:
 			// 判断除了数字 逗号 26字母全部不合符
 			if (v < '0' || v > '9') && (v < 'a' || v > 'z') && (v < 'A' && v > 'Z') && v != ',' && v != '@' && v != '$' && v != '.' {
-				return "", "", fmt.Errorf("invalid token: %v", token)
+				return "", "", newPathSyntaxError(token, i, "index, member name or filter", "")
 			}
 		}
 	}
@@ -449,12 +748,14 @@ func parse_bracket_token(token string) (op string, args interface{}, err error)
 	// 2.全部是数字，类似123 => idx
 	res := []int{}
 
+	off := 0
 	for _, x := range strings.Split(token, ",") {
 		if i, err := strconv.Atoi(strings.Trim(x, " ")); err == nil {
 			res = append(res, i)
 		} else {
-			return "", nil, err
+			return "", nil, newPathSyntaxError(token, off+len(x)-len(strings.TrimLeft(x, " ")), "integer index", "")
 		}
+		off += len(x) + 1
 	}
 
 	op = "idx"
@@ -463,45 +764,96 @@ func parse_bracket_token(token string) (op string, args interface{}, err error)
 	return op, args, nil
 }
 
+// 解析逗号分隔的单引号或双引号字符串 支持\' \" \\ \uXXXX等转义
+func parse_quoted_keys(s string) ([]string, error) {
+	p := &rfcParser{s: s}
+	var keys []string
+	for {
+		p.skipBlank()
+		if c := p.peek(); c != '\'' && c != '"' {
+			return nil, p.expected("quoted member name")
+		}
+		key, err := p.parseStringLiteral()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+		p.skipBlank()
+		if p.eof() {
+			return keys, nil
+		}
+		if p.peek() != ',' {
+			return nil, p.expected("',' or ']'")
+		}
+		p.pos++
+	}
+}
+
 func filter_get_from_explicit_path(obj *Value, path string) (*Value, error) {
-	steps, err := tokenize(path, true)
-	//fmt.Println("f: steps: ", steps, err)
-	//fmt.Println(path, steps)
+	steps, err := compile_filter_path(path)
 	if err != nil {
 		return nil, err
 	}
+	return filter_get_from_steps(obj, steps)
+}
 
-	if steps[0] == "@" || steps[0] == "$" {
-		steps = steps[1:]
+// 将filter中的字段路径解析为step 只支持key和单个idx
+func compile_filter_path(path string) ([]step, error) {
+	tokens, offsets, err := tokenize_pos(path, true)
+	if err != nil {
+		return nil, err
 	}
 
-	xobj := obj
-	//fmt.Println("f: xobj", xobj)
-	for _, s := range steps {
-		op, key, args, err := parse_token(s)
-		// "key", "idx"
+	if len(tokens) > 0 && (tokens[0] == "@" || tokens[0] == "$") {
+		tokens, offsets = tokens[1:], offsets[1:]
+	}
+
+	steps := make([]step, len(tokens))
+	for i, token := range tokens {
+		op, key, args, err := parse_token(token)
+		if err != nil {
+			return nil, toPathSyntaxError(path, offsets[i], err)
+		}
 		switch op {
 		case "key":
-			xobj, err = get_key(xobj, key)
-			if err != nil {
-				return nil, err
+			if args != nil && len(args.([]string)) != 1 {
+				return nil, newPathSyntaxError(path, offsets[i], "", "don't support multiple key in filter")
 			}
-
 		case "idx":
 			if len(args.([]int)) != 1 {
-				return nil, fmt.Errorf("don't support multiple index in filter")
+				return nil, newPathSyntaxError(path, offsets[i], "", "don't support multiple index in filter")
 			}
-			xobj, err = get_key(xobj, key)
+		default:
+			return nil, newPathSyntaxError(path, offsets[i], "", "expression don't support in filter")
+		}
+		steps[i] = step{op, key, args}
+	}
+
+	return steps, nil
+}
+
+func filter_get_from_steps(obj *Value, steps []step) (*Value, error) {
+	var err error
+
+	xobj := obj
+	for _, s := range steps {
+		// "key", "idx"
+		xobj, err = get_key(xobj, s.key)
+		if err != nil {
+			return nil, err
+		}
+		if s.op == "key" && s.args != nil {
+			// 引号包围的key 如@['a.b']
+			xobj, err = get_key(xobj, s.args.([]string)[0])
 			if err != nil {
 				return nil, err
 			}
-			xobj, err = get_idx(xobj, args.([]int)[0])
+		}
+		if s.op == "idx" {
+			xobj, err = get_idx(xobj, s.args.([]int)[0])
 			if err != nil {
 				return nil, err
 			}
-
-		default:
-			return nil, fmt.Errorf("expression don't support in filter")
 		}
 	}
 
@@ -524,311 +876,797 @@ func get_key(obj *Value, key string) (*Value, error) {
 		// in which case we can save having to iterate the map keys to work out if the
 		// key exists
 		if !obj.Exists(key) {
-			return nil, fmt.Errorf("key error: %s not found in object", key)
+			return nil, notFoundErrorf("key error: %s not found in object", key)
 		}
 
 		return obj.Get(key), nil
 
-	case TypeArray:
-		// slice we should get from all objects in it.
-		res := &Value{a: make([]*Value, 0), t: TypeArray}
-		for _, v := range obj.a {
-			res.a = append(res.a, v.Get(key))
-		}
-		return res, nil
-
 	default:
-		return nil, fmt.Errorf("fail to exec get_key:%s, object is not map", key)
+		// 数组等非对象类型没有成员 因此filter中的@.key视为不存在
+		return nil, typeMismatchErrorf("fail to exec get_key:%s, object is not map", key)
 	}
 }
 
 func get_idx(obj *Value, idx int) (*Value, error) {
 	switch obj.t {
 	case TypeArray:
-		length := len(obj.a)
-
-		if idx >= 0 {
-			if idx >= length {
-				return nil, fmt.Errorf("index out of range: len: %v, idx: %v", length, idx)
-			}
-			return obj.a[idx], nil
-		} else {
-			// < 0
-			_idx := length + idx
-			if _idx < 0 {
-				return nil, fmt.Errorf("index out of range: len: %v, idx: %v", length, idx)
-			}
-			return obj.a[_idx], nil
+		i, err := normalize_idx(len(obj.a), idx)
+		if err != nil {
+			return nil, err
 		}
+		return obj.a[i], nil
 
 	default:
-		return nil, fmt.Errorf("fail to exec get_idx:%d, object is not Slice", idx)
+		return nil, typeMismatchErrorf("fail to exec get_idx:%d, object is not Slice", idx)
+	}
+}
+
+// 将idx转换为长度为length的数组中的下标 负数表示从末尾开始计数
+func normalize_idx(length, idx int) (int, error) {
+	if idx >= 0 {
+		if idx >= length {
+			return 0, notFoundErrorf("index out of range: len: %v, idx: %v", length, idx)
+		}
+		return idx, nil
+	} else {
+		// < 0
+		_idx := length + idx
+		if _idx < 0 {
+			return 0, notFoundErrorf("index out of range: len: %v, idx: %v", length, idx)
+		}
+		return _idx, nil
 	}
 }
 
 func get_range(obj *Value, frm, to interface{}) (*Value, error) {
+	idxs, err := get_range_idxs(obj, frm, to, nil)
+	if err != nil {
+		return nil, err
+	}
+	res := &Value{a: make([]*Value, len(idxs)), t: TypeArray}
+	for i, idx := range idxs {
+		res.a[i] = obj.a[idx]
+	}
+	return res, nil
+}
+
+// 计算range [frm:to:step]在数组中按顺序选取的下标 to包含在结果中
+// 负数下标从数组末尾开始计算 超出数组范围的下标截断到数组边界
+// step默认为1 为负数时逆序选取 此时frm默认为最后一个元素 to默认为第一个元素
+func get_range_idxs(obj *Value, frm, to, step interface{}) ([]int, error) {
 	switch obj.t {
 	case TypeArray:
-		length := len(obj.a)
+		return range_idxs(len(obj.a), frm, to, step)
+
+	default:
+		return nil, typeMismatchErrorf("fail to exec get_idx:from %v to %v, object is not Slice", frm, to)
+	}
+}
+
+// 返回长度为length的数组中[frm:to:step]范围内的下标
+func range_idxs(length int, frm, to, step interface{}) ([]int, error) {
+	_step := 1
+	if sv, ok := step.(int); ok {
+		_step = sv
+	}
+	if _step == 0 {
+		return nil, fmt.Errorf("range step cannot be zero")
+	}
 
-		_frm := 0
-		_to := length
-		if frm == nil {
-			frm = 0
+	_frm, _to := 0, length-1
+	if _step < 0 {
+		_frm, _to = length-1, 0
+	}
+	if fv, ok := frm.(int); ok {
+		_frm = fv
+		if fv < 0 {
+			_frm = length + fv
 		}
-		if to == nil {
-			to = length - 1
+	}
+	if tv, ok := to.(int); ok {
+		_to = tv
+		if tv < 0 {
+			_to = length + tv
 		}
+	}
 
-		if fv, ok := frm.(int); ok == true {
-			if fv < 0 {
-				_frm = length + fv
-			} else {
-				_frm = fv
-			}
+	var res []int
+	if _step > 0 {
+		if _frm < 0 {
+			_frm = 0
 		}
-
-		if tv, ok := to.(int); ok == true {
-			if tv < 0 {
-				_to = length + tv + 1
-			} else {
-				_to = tv + 1
+		if _to > length-1 {
+			_to = length - 1
+		}
+		for i := _frm; i <= _to; i += _step {
+			res = append(res, i)
+			if _to-i < _step {
+				// 避免i += _step溢出
+				break
 			}
 		}
-
-		if _frm < 0 || _frm >= length {
-			return nil, fmt.Errorf("index [from] out of range: len: %v, from: %v", length, frm)
+	} else {
+		if _frm > length-1 {
+			_frm = length - 1
 		}
-		if _to < 0 || _to > length {
-			return nil, fmt.Errorf("index [to] out of range: len: %v, to: %v", length, to)
+		if _to < 0 {
+			_to = 0
+		}
+		for i := _frm; i >= _to; i += _step {
+			res = append(res, i)
 		}
-
-		//fmt.Println("_frm, _to: ", _frm, _to)
-		return &Value{a: obj.a[_frm:_to], t: TypeArray}, nil
-
-	default:
-		return nil, fmt.Errorf("fail to exec get_idx:from %v to %v, object is not Slice", frm, to)
 	}
+	return res, nil
 }
 
+// 编译=~右边/pattern/flags形式的正则 flags支持i m s 对应RE2的同名flag
+// 编译结果缓存在受RegexpLimits限制的缓存中
 func regFilterCompile(rule string) (*regexp.Regexp, error) {
-	runes := []rune(rule)
-	if len(runes) <= 2 {
+	if len(rule) <= 2 {
 		return nil, errors.New("empty rule")
 	}
 
-	if runes[0] != '/' || runes[len(runes)-1] != '/' {
-		return nil, errors.New("invalid syntax. should be in `/pattern/` form")
+	n := strings.LastIndexByte(rule, '/')
+	if rule[0] != '/' || n <= 0 {
+		return nil, errors.New("invalid syntax. should be in `/pattern/flags` form")
+	}
+	pattern, flags := rule[1:n], rule[n+1:]
+	for i := 0; i < len(flags); i++ {
+		if strings.IndexByte("ims", flags[i]) < 0 {
+			return nil, fmt.Errorf("unsupported regexp flag %q in %s, only i, m and s are supported", flags[i], rule)
+		}
 	}
-	runes = runes[1 : len(runes)-1]
-	return regexp.Compile(string(runes))
+	return regexps.compile(rule, pattern, func() string {
+		if len(flags) == 0 {
+			return pattern
+		}
+		return "(?" + flags + ")" + pattern
+	})
 }
 
-func get_filtered(obj, root *Value, filter string) (bool, []*Value, error) {
-	filterGroup, err := parse_filter_group(filter)
-	if err != nil {
-		return true, nil, err
-	}
-
-	res := make([]*Value, 0)
-
-	switch obj.t {
-	case TypeArray:
-		if filterGroup.mustOne || len(filterGroup.tuples) == 1 {
-			if filterGroup.tuples[0].op == "=~" {
-				// regexp
-				pat, err := regFilterCompile(filterGroup.tuples[0].rp.p)
-				if err != nil {
-					return true, nil, err
-				}
+// 数组对每个元素进行过滤 对象则过滤其自身 返回结果是否为多值
+// scan为true时对象与数组一样 对其所有成员值进行过滤
+func get_filtered(obj node, root *Value, filterGroup *FilterTupleGroup, scan, paths bool, lim *evalLimiter) (bool, []node, error) {
+	res := make([]node, 0)
 
-				for _, tmp := range obj.a {
-					ok, err := eval_reg_filter(tmp, root, filterGroup.tuples[0].lp, pat)
-					if err != nil {
-						return true, nil, err
-					}
-					if ok == true {
-						res = append(res, tmp)
-					}
-				}
-			} else {
-				for _, tmp := range obj.a {
-					ok, err := eval_filter(tmp, root, filterGroup.tuples[0])
-					if err != nil {
-						return true, nil, err
-					}
-					if ok == true {
-						res = append(res, tmp)
-					}
-				}
+	switch {
+	case obj.v.t == TypeArray, scan && obj.v.t == TypeObject:
+		for _, tmp := range children(obj, paths) {
+			if !lim.visit(1) {
+				return true, nil, lim.err
 			}
-		} else {
-			for _, tmp := range obj.a {
-				ok, err := eval_filter_group(tmp, root, filterGroup)
-				if err != nil {
-					return true, nil, err
-				}
-				if ok == true {
-					res = append(res, tmp)
-				}
+			ok, err := eval_filter_group(tmp.v, root, filterGroup, lim)
+			if err != nil {
+				return true, nil, err
+			}
+			if ok == true {
+				res = append(res, tmp)
 			}
 		}
 
 		return true, res, nil
 
-	case TypeObject:
-		if filterGroup.mustOne || len(filterGroup.tuples) == 1 {
-			if filterGroup.tuples[0].op == "=~" {
-
-				// regexp
-				pat, err := regFilterCompile(filterGroup.tuples[0].rp.p)
-				if err != nil {
-					return false, nil, err
-				}
-
-				ok, err := eval_reg_filter(obj, root, filterGroup.tuples[0].lp, pat)
-				if err != nil {
-					return false, nil, err
-				}
-				if ok == true {
-					res = append(res, obj)
-				}
-			} else {
-				ok, err := eval_filter(obj, root, filterGroup.tuples[0])
-				if err != nil {
-					return false, nil, err
-				}
-				if ok == true {
-					res = append(res, obj)
-				}
-			}
-		} else {
-			ok, err := eval_filter_group(obj, root, filterGroup)
-			if err != nil {
-				return false, nil, err
-			}
-
-			if ok == true {
-				res = append(res, obj)
-			}
+	case obj.v.t == TypeObject:
+		if !lim.visit(1) {
+			return false, nil, lim.err
+		}
+		ok, err := eval_filter_group(obj.v, root, filterGroup, lim)
+		if err != nil {
+			return false, nil, err
+		}
+		if ok == true {
+			res = append(res, obj)
 		}
 
 		return false, res, nil
 
 	default:
-		return true, nil, fmt.Errorf("don't support filter on this type: %v", obj.t)
+		return true, nil, typeMismatchErrorf("don't support filter on this type: %v", obj.v.t)
 	}
 }
 
+// 将filter解析为逻辑表达式 ||优先级最低 &&次之 !及括号最高
+// 如 !(@.a =~ /x/) && (@.b || @.c > 3)
 func parse_filter_group(filter_group string) (ret FilterTupleGroup, err error) {
-	// Split the string by logical operators
-	var splits []string
+	p := &filterParser{s: filter_group, group: &ret}
+	if ret.expr, err = p.parseOr(); err != nil {
+		return FilterTupleGroup{}, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.s) {
+		return FilterTupleGroup{}, newPathSyntaxError(p.s, p.pos, "'&&', '||' or end of filter", "")
+	}
+	ret.text = filter_group
+	return ret, nil
+}
+
+// filter逻辑表达式的递归下降解析器 叶子三元组交由parse_filter解析
+type filterParser struct {
+	s     string
+	pos   int
+	group *FilterTupleGroup
+}
 
-	// TODO 可以改成扫描字符串解析的方式 更高效
-	s := filter_group
+func (p *filterParser) skipSpace() {
+	for p.pos < len(p.s) && p.s[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+func (p *filterParser) parseOr() (*filterExpr, error) {
+	return p.parseLogic("||", p.parseAnd)
+}
+
+func (p *filterParser) parseAnd() (*filterExpr, error) {
+	return p.parseLogic("&&", p.parseUnary)
+}
+
+// 解析由logic连接的一个或多个操作数
+func (p *filterParser) parseLogic(logic string, parseArg func() (*filterExpr, error)) (*filterExpr, error) {
+	x, err := parseArg()
+	if err != nil {
+		return nil, err
+	}
+	args := []*filterExpr{x}
 	for {
-		i := strings.IndexAny(s, "||&&")
-		if i == -1 {
-			splits = append(splits, s)
+		p.skipSpace()
+		if !strings.HasPrefix(p.s[p.pos:], logic) {
 			break
 		}
-		splits = append(splits, s[:i])
-		splits = append(splits, string(s[i:i+2]))
-		s = s[i+2:]
+		p.pos += len(logic)
+		if x, err = parseArg(); err != nil {
+			return nil, err
+		}
+		args = append(args, x)
 	}
+	if len(args) == 1 {
+		return x, nil
+	}
+	return &filterExpr{logic: logic, args: args}, nil
+}
 
-	for _, part := range splits {
-		if part == "||" || part == "&&" {
-			// If the part is a logical operator, add it to the logics slice
-			ret.logics = append(ret.logics, part)
-		} else {
-			filter, err := parse_filter(strings.Trim(part, " "))
-			if err != nil {
-				return FilterTupleGroup{}, err
+func (p *filterParser) parseUnary() (*filterExpr, error) {
+	p.skipSpace()
+	if p.pos >= len(p.s) {
+		return nil, newPathSyntaxError(p.s, p.pos, "operand", "")
+	}
+	switch p.s[p.pos] {
+	case '!':
+		p.pos++
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &filterExpr{logic: "!", args: []*filterExpr{x}}, nil
+	case '(':
+		if p.arithGroup() {
+			return p.parseTuple()
+		}
+		p.pos++
+		x, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if p.pos >= len(p.s) || p.s[p.pos] != ')' {
+			return nil, newPathSyntaxError(p.s, p.pos, "')'", "")
+		}
+		p.pos++
+		return x, nil
+	default:
+		return p.parseTuple()
+	}
+}
+
+// 判断当前位置的括号是否属于算术表达式 如(@.a + @.b) * 2 > 10
+// 此时括号后紧跟运算符 而逻辑分组的括号后只能是&& ||或)
+func (p *filterParser) arithGroup() bool {
+	depth := 0
+	var quote byte
+	for i := p.pos; i < len(p.s); i++ {
+		c := p.s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				tail := strings.TrimLeft(p.s[i+1:], " ")
+				return len(tail) > 0 && tail[0] != ')' && !strings.HasPrefix(tail, "&&") && !strings.HasPrefix(tail, "||")
 			}
+		}
+	}
+	return false
+}
 
-			if filter.op == "=~" || filter.op == "exists" {
-				ret.mustOne = true
+// 截取到顶层的&& || 或未匹配的)为止作为三元组
+// 跳过引号包围的字符串 =~之后的/正则/ 以及函数调用的括号
+func (p *filterParser) parseTuple() (*filterExpr, error) {
+	start := p.pos
+	depth := 0
+	var quote byte
+	regex := false
+	matchOp := false
+	i := p.pos
+loop:
+	for ; i < len(p.s); i++ {
+		c := p.s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case regex:
+			if c == '\\' {
+				i++
+			} else if c == '/' {
+				regex = false
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '/' && matchOp:
+			regex = true
+			matchOp = false
+		case strings.HasPrefix(p.s[i:], "=~"):
+			matchOp = true
+			i++
+		case c == '(':
+			depth++
+		case c == ')':
+			if depth == 0 {
+				break loop
 			}
-			ret.tuples = append(ret.tuples, filter)
+			depth--
+		case depth == 0 && (strings.HasPrefix(p.s[i:], "&&") || strings.HasPrefix(p.s[i:], "||")):
+			break loop
+		}
+	}
+	if i > len(p.s) {
+		i = len(p.s)
+	}
+	p.pos = i
 
-			if ret.mustOne && len(ret.tuples) > 1 {
-				return FilterTupleGroup{}, errors.New("don't support multiple regex/exists filter yet ")
+	text := strings.Trim(p.s[start:i], " ")
+	if len(text) == 0 {
+		return nil, newPathSyntaxError(p.s, start, "operand", "")
+	}
+	start += strings.Index(p.s[start:], text)
+	filter, err := parse_filter(text)
+	if err == nil {
+		err = compile_filter_tuple(text, &filter)
+	}
+	if err != nil {
+		// 函数调用及字段路径的错误位置相对于其自身 换算为filter中的偏移
+		if se, ok := err.(*PathSyntaxError); ok {
+			if se.Path == text && se.Offset == len(text) {
+				// 三元组末尾的错误指向其后的&& ||或)
+				return nil, newPathSyntaxError(p.s, p.pos, se.Expected, se.Msg)
+			}
+			if n := strings.Index(text, se.Path); n > 0 {
+				start += n
 			}
 		}
+		return nil, toPathSyntaxError(p.s, start, err)
 	}
+	p.group.tuples = append(p.group.tuples, filter)
+	return &filterExpr{tuple: len(p.group.tuples) - 1}, nil
+}
 
-	return ret, nil
+// 预解析过滤三元组中的字段路径 并预编译正则
+// text为三元组的原始文本 错误位置为其中的偏移
+func compile_filter_tuple(text string, filter *FilterTuple) (err error) {
+	switch {
+	case filter.op == "exists":
+	case filter.op == "=~":
+		if filter.reg, err = regFilterCompile(filter.rp.p); err != nil {
+			return toPathSyntaxError(text, filter.rp.pos, err)
+		}
+	case !is_filter_op(filter.op):
+		return newPathSyntaxError(text, 0, "", fmt.Sprintf("invalid filter operator: %v", filter.op))
+	}
+
+	if err = compile_param(&filter.lp); err != nil {
+		return param_error(text, &filter.lp, err)
+	}
+	if filter.op == "exists" && filter.lp.arith != nil {
+		return newPathSyntaxError(text, filter.lp.pos, "", "result of arithmetic expression must be compared")
+	}
+	if filter.op == "exists" && filter.lp.name != "" {
+		// 占位符的值是常量 单独作为条件没有意义
+		return newPathSyntaxError(text, filter.lp.pos, "", fmt.Sprintf("$$%s must be compared", filter.lp.name))
+	}
+	if filter.op != "=~" && filter.op != "exists" {
+		if !filter.rp.quoted && (strings.HasPrefix(filter.rp.p, "@") || strings.HasPrefix(filter.rp.p, "$")) {
+			filter.rp.isField = true
+		}
+		if err = compile_param(&filter.rp); err != nil {
+			return param_error(text, &filter.rp, err)
+		}
+	}
+
+	// 右值为常量时在Compile时检查其类型
+	if rp := filter.rp; !rp.isField && rp.fn == nil && rp.arith == nil && rp.name == "" {
+		expected := ""
+		switch filter.op {
+		case "in", "nin", "subsetof", "anyof", "noneof":
+			if rp.v.t != TypeArray {
+				expected = "array"
+			}
+		case "size":
+			if rp.v.t != TypeNumber {
+				expected = "number"
+			}
+		case "empty":
+			if rp.v.t != TypeTrue && rp.v.t != TypeFalse {
+				expected = "true or false"
+			}
+		}
+		if expected != "" {
+			return newPathSyntaxError(text, rp.pos, fmt.Sprintf("%s as right operand of %s", expected, filter.op), "")
+		}
+	}
+
+	// 函数调用的参数个数及类型已在解析时检查 这里检查结果类型
+	for _, p := range []*Param{&filter.lp, &filter.rp} {
+		fn := p.fn
+		if fn == nil {
+			continue
+		}
+		if filter.op == "exists" {
+			if fn.fn.Result == FuncTypeValue {
+				return newPathSyntaxError(text, p.pos, "", fmt.Sprintf("result of %s() must be compared", fn.name))
+			}
+		} else if fn.fn.Result != FuncTypeValue {
+			return newPathSyntaxError(text, p.pos, "", fmt.Sprintf("result of %s() cannot be compared", fn.name))
+		}
+	}
+	return nil
+}
+
+// 将操作数p编译时的错误换算为三元组text中的位置
+func param_error(text string, p *Param, err error) error {
+	if se, ok := err.(*PathSyntaxError); ok {
+		if se.Path == text {
+			return err
+		}
+		if n := strings.Index(p.p, se.Path); n >= 0 {
+			return toPathSyntaxError(text, p.pos+n, err)
+		}
+	}
+	return toPathSyntaxError(text, p.pos, err)
+}
+
+func compile_param(p *Param) (err error) {
+	if p.arith != nil {
+		// 算术表达式的操作数已在解析时预编译
+		return nil
+	}
+	if !p.quoted && strings.HasPrefix(p.p, "$$") {
+		p.isField = false
+		p.name, err = parseVarName(p.p)
+		return err
+	}
+	if !p.quoted && is_func_call(p.p) {
+		p.fn, p.fnVars, err = compile_func_call(p.p, nil)
+		return err
+	}
+	if !p.isField {
+		if !p.quoted && strings.HasPrefix(p.p, "[") {
+			p.v, err = parse_filter_array(p.p)
+			return err
+		}
+		p.v = filter_const(*p)
+		return nil
+	}
+	p.fromRoot = strings.HasPrefix(p.p, "$")
+	p.steps, err = compile_filter_path(p.p)
+	return err
+}
+
+// 解析数组常量 元素可以是单引号或双引号包围的字符串以及其他JSON值 如['a', "b", 1]
+func parse_filter_array(s string) (*Value, error) {
+	// 单引号字符串转为JSON字符串后按JSON解析
+	b := make([]byte, 0, len(s))
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote == 0:
+			if c == '\'' || c == '"' {
+				quote = c
+				c = '"'
+			}
+			b = append(b, c)
+		case c == '\\' && i+1 < len(s):
+			i++
+			if s[i] == '\'' {
+				b = append(b, '\'')
+			} else {
+				b = append(b, c, s[i])
+			}
+		case c == quote:
+			quote = 0
+			b = append(b, '"')
+		case c == '"':
+			b = append(b, '\\', '"')
+		default:
+			b = append(b, c)
+		}
+	}
+
+	v, err := ParseBytes(b)
+	if err != nil {
+		return nil, fmt.Errorf("invalid array in filter: %v, %v", s, err)
+	}
+	if v.t != TypeArray {
+		return nil, fmt.Errorf("invalid array in filter: %v", s)
+	}
+	return v, nil
+}
+
+// 形如name(...)的函数调用
+func is_func_call(s string) bool {
+	i := strings.IndexByte(s, '(')
+	return i > 0 && isFunctionName(s[:i]) && strings.HasSuffix(s, ")")
+}
+
+// 函数调用按RFC 9535语法解析 参数为@/$开头的路径 字符串 数字等字面量或嵌套的函数调用
+// 参数中可以使用$$name占位符 返回其变量名 values非nil时占位符替换为其中的值
+func compile_func_call(s string, values map[string]*Value) (*funcExpr, []string, error) {
+	p := &rfcParser{s: s, vars: &filterVars{values: values}}
+	x, err := p.parsePrimary()
+	if err != nil {
+		return nil, nil, err
+	}
+	if !p.eof() {
+		return nil, nil, p.errorf("unexpected %q", s[p.pos:])
+	}
+	return x.(*funcExpr), p.vars.names, nil
 }
 
 // @.isbn                 => @.isbn, exists, nil
 // @.price < 10           => @.price, <, 10
 // @.price <= $.expensive => @.price, <=, $.expensive
 // @.author =~ /.*REES/i  => @.author, match, /.*REES/i
-// TODO 这里默认强制左边是字段 右边是字符串 可以有更优的判断实现方式
+// @.price * @.qty > 100  => @.price * @.qty, >, 100
+// 两边均可以是字段 常量或以空格分隔的算术表达式 左边未加@/$前缀的非常量默认为字段
 func parse_filter(filter string) (ret FilterTuple, err error) {
-	tmp := ""
+	words, err := split_filter_words(filter)
+	if err != nil || len(words) == 0 {
+		return ret, err
+	}
 
-	stage := 0
-	str_embrace := false
-	for idx, c := range filter {
-		switch c {
-		case '\'':
-			if str_embrace == false {
-				str_embrace = true
-			} else {
-				switch stage {
-				case 0:
-					ret.lp.p = tmp
-					ret.lp.isField = true
-				case 1:
-					ret.op = tmp
-				case 2:
-					ret.rp.p = tmp
-					ret.rp.isField = false
+	n := operand_words(words)
+	if ret.lp, err = parse_filter_operand(filter, words[:n], true); err != nil {
+		return ret, err
+	}
+	ret.lp.pos = words[0].pos
+	words = words[n:]
+	if len(words) == 0 {
+		ret.op = "exists"
+		return ret, nil
+	}
+	if words[0].quoted || !is_filter_op(words[0].s) {
+		return ret, newPathSyntaxError(filter, words[0].pos, "comparison operator", "")
+	}
+	ret.op = words[0].s
+	words = words[1:]
+	if len(words) == 0 {
+		return ret, newPathSyntaxError(filter, len(filter), "right operand", "")
+	}
+	if ret.op == "=~" {
+		// 正则中可以包含空格
+		ret.rp.p = strings.TrimRight(filter[words[0].pos:], " ")
+		ret.rp.pos = words[0].pos
+		return ret, nil
+	}
+
+	n = operand_words(words)
+	if n < len(words) {
+		return ret, newPathSyntaxError(filter, words[n].pos, "'&&', '||' or end of filter", "")
+	}
+	ret.rp, err = parse_filter_operand(filter, words, false)
+	ret.rp.pos = words[0].pos
+	return ret, err
+}
+
+// 判断op是否为filter支持的比较或集合运算符
+func is_filter_op(op string) bool {
+	switch op {
+	case "<", "<=", "==", "!=", ">=", ">", "=~":
+		return true
+	case "in", "nin", "contains", "subsetof", "anyof", "noneof", "size", "empty":
+		return true
+	default:
+		return false
+	}
+}
+
+// filter中以空格分隔的词
+type filter_word struct {
+	s      string
+	pos    int  // 词在filter中的起始偏移
+	end    int  // 词在filter中的结束偏移
+	quoted bool // 是否为单引号包围的字符串 s不含引号
+}
+
+// 将filter按空格切分为词 单引号字符串 函数调用 数组常量 括号包围的算术表达式
+// 以及字段路径中的方括号作为整体 其中的空格不作为分隔
+func split_filter_words(filter string) ([]filter_word, error) {
+	var words []filter_word
+	i := 0
+	for i < len(filter) {
+		if filter[i] == ' ' {
+			i++
+			continue
+		}
+		start := i
+		if filter[i] == '\'' {
+			// 单引号字符串 与双引号字符串一样支持JSON转义 另外\'转义为'
+			var b []byte
+			for i++; i < len(filter) && filter[i] != '\''; i++ {
+				if filter[i] == '\\' && i+1 < len(filter) {
+					i++
+					if filter[i] != '\'' {
+						b = append(b, '\\')
+					}
 				}
-				tmp = ""
+				b = append(b, filter[i])
+			}
+			if i >= len(filter) {
+				return nil, newPathSyntaxError(filter, start, "", "unclosed string")
+			}
+			i++
+			words = append(words, filter_word{s: unescapeStringBestEffort(string(b)), pos: start, end: i, quoted: true})
+			continue
+		}
+
+		if isFilterOpChar(filter[i]) {
+			// 比较运算符可以不以空格分隔 如@.type=='x'
+			for i < len(filter) && isFilterOpChar(filter[i]) {
+				i++
+			}
+			words = append(words, filter_word{s: filter[start:i], pos: start, end: i})
+			if filter[start:i] == "=~" {
+				// =~之后为/正则/ 其中可以包含引号 空格及运算符 整体作为一个词
+				rest := strings.Trim(filter[i:], " ")
+				if len(rest) > 0 {
+					pos := strings.Index(filter[i:], rest) + i
+					words = append(words, filter_word{s: rest, pos: pos, end: pos + len(rest)})
+				}
+				break
 			}
-		case ' ':
-			if str_embrace == true {
-				tmp += string(c)
+			continue
+		}
+
+		depth := 0
+		var quote byte
+		for ; i < len(filter); i++ {
+			c := filter[i]
+			if quote != 0 {
+				if c == '\\' {
+					i++
+				} else if c == quote {
+					quote = 0
+				}
 				continue
 			}
-			switch stage {
-			case 0:
-				ret.lp.p = tmp
-				ret.lp.isField = true
-			case 1:
-				ret.op = tmp
-			case 2:
-				ret.rp.p = tmp
-				ret.rp.isField = false
+			if depth == 0 && (c == ' ' || isFilterOpChar(c)) {
+				break
+			}
+			switch c {
+			case '\'', '"':
+				quote = c
+			case '(':
+				if depth > 0 || i == start || isFunctionName(filter[start:i]) {
+					depth++
+				}
+			case '[':
+				depth++
+			case ')', ']':
+				if depth > 0 {
+					depth--
+				}
 			}
-			tmp = ""
+		}
+		if i > len(filter) {
+			i = len(filter)
+		}
+		words = append(words, filter_word{s: filter[start:i], pos: start, end: i})
+	}
+	return words, nil
+}
 
-			stage += 1
-			if stage > 2 {
-				return ret, errors.New(fmt.Sprintf("invalid char at %d: `%c`", idx, c))
+// 比较运算符 == != < <= > >= =~ 中的字符
+func isFilterOpChar(c byte) bool {
+	return c == '=' || c == '!' || c == '<' || c == '>' || c == '~'
+}
+
+// 返回words开头由算术运算符连接的操作数所占的词数
+func operand_words(words []filter_word) int {
+	n := 1
+	for n+1 < len(words) && isArithOp(words[n]) {
+		n += 2
+	}
+	return n
+}
+
+// 将words解析为比较运算的操作数 多个词时为算术表达式
+func parse_filter_operand(filter string, words []filter_word, left bool) (Param, error) {
+	if len(words) == 1 && !isArithGroup(words[0]) {
+		w := words[0]
+		p := Param{p: w.s, quoted: w.quoted}
+		if left {
+			p.isField = !w.quoted && !is_filter_literal(w.s)
+		}
+		if !w.quoted && (p.isField || strings.HasPrefix(w.s, "@") || strings.HasPrefix(w.s, "$")) {
+			// 未以空格分隔的算术运算符会被当作字段名的一部分 如@.price*@.qty
+			if n := arith_op_in_path(w.s); n >= 0 {
+				return Param{}, newPathSyntaxError(filter, w.pos+n, "", "arithmetic operators must be separated by spaces")
 			}
-		default:
-			tmp += string(c)
 		}
+		return p, nil
+	}
+	x, err := parseArith(filter, words)
+	if err != nil {
+		return Param{}, err
 	}
-	if tmp != "" {
-		switch stage {
-		case 0:
-			ret.lp.p = tmp
-			ret.lp.isField = true
-			ret.op = "exists"
-		case 1:
-			ret.op = tmp
-		case 2:
-			ret.rp.p = tmp
-			ret.rp.isField = false
+	return Param{p: filter[words[0].pos:words[len(words)-1].end], arith: x}, nil
+}
+
+// 返回字段路径s中方括号及引号之外的算术运算符的偏移 不存在时返回-1
+// -可以出现在字段名中 仅当其后紧跟@或$时视为运算符
+func arith_op_in_path(s string) int {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '[' || c == '(':
+			depth++
+		case c == ']' || c == ')':
+			depth--
+		case depth > 0:
+		case c == '*' && i > 0 && s[i-1] == '.':
+			// 通配符 如@.*
+		case c == '+' || c == '*' || c == '/' || c == '%':
+			return i
+		case c == '-' && i+1 < len(s) && (s[i+1] == '@' || s[i+1] == '$'):
+			return i
 		}
-		tmp = ""
 	}
-	return ret, err
+	return -1
+}
+
+// 判断s是否为filter中的常量 即数字 true false null 双引号字符串或数组
+func is_filter_literal(s string) bool {
+	switch s {
+	case "true", "false", "null":
+		return true
+	}
+	if strings.HasPrefix(s, "\"") || strings.HasPrefix(s, "[") {
+		return true
+	}
+	tail, err := validateNumber(s)
+	return err == nil && len(tail) == 0
 }
 
 func parse_filter_v1(filter string) (lp string, op string, rp string, err error) {
@@ -870,117 +1708,250 @@ func parse_filter_v1(filter string) (lp string, op string, rp string, err error)
 	return lp, op, rp, err
 }
 
-func eval_reg_filter(obj, root *Value, lp Param, pat *regexp.Regexp) (res bool, err error) {
+func eval_reg_filter(obj, root *Value, lp Param, pat *regexp.Regexp, lim *evalLimiter) (res bool, err error) {
 	if pat == nil {
 		return false, errors.New("nil pat")
 	}
-	lp_v, err := get_lp_v(obj, root, lp)
-	if err != nil {
+	// 字段不存在或不是字符串时匹配结果为false 与比较运算保持一致 以便与!及其他条件组合
+	lp_v, err := get_lp_v(obj, root, lp, lim)
+	if isUnboundVar(err) {
 		return false, err
 	}
-	switch lp_v.Type() {
-	case TypeString:
-		return pat.MatchString(lp_v.s), nil
-	default:
-		return false, errors.New("only string can match with regular expression")
+	if err != nil || lp_v == nil || lp_v.Type() != TypeString {
+		return false, nil
 	}
+	return pat.MatchString(lp_v.s), nil
 }
 
-func get_lp_v(obj, root *Value, lp Param) (*Value, error) {
+func get_lp_v(obj, root *Value, lp Param, lim *evalLimiter) (*Value, error) {
 	var lp_v *Value
-	if strings.HasPrefix(lp.p, "@.") {
+	if lp.name != "" {
+		if lp.v == nil {
+			return nil, &unboundVarError{name: lp.name}
+		}
+		return lp.v, nil
+	} else if lp.arith != nil {
+		return lp.arith.eval(obj, root, lim)
+	} else if lp.fn != nil {
+		if err := lp.unboundFuncVar(); err != nil {
+			return nil, err
+		}
+		return lp.fn.evalValue(root, obj, lim), nil
+	} else if lp.steps != nil {
+		if lp.fromRoot {
+			return filter_get_from_steps(root, lp.steps)
+		}
+		return filter_get_from_steps(obj, lp.steps)
+	} else if strings.HasPrefix(lp.p, "@.") {
 		return filter_get_from_explicit_path(obj, lp.p)
 	} else if strings.HasPrefix(lp.p, "$.") {
 		return filter_get_from_explicit_path(root, lp.p)
 	} else if lp.isField {
 		// 默认字段取@.含义
 		return filter_get_from_explicit_path(obj, lp.p)
+	} else if lp.v != nil {
+		lp_v = lp.v
 	} else {
-		lp_v = &Value{s: lp.p, t: TypeString}
+		lp_v = filter_const(lp)
 	}
 	return lp_v, nil
 }
 
-func get_rp_v(obj, root *Value, rp Param) (*Value, error) {
+func get_rp_v(obj, root *Value, rp Param, lim *evalLimiter) (*Value, error) {
 	var rp_v *Value
-	if strings.HasPrefix(rp.p, "@.") {
+	if rp.name != "" {
+		if rp.v == nil {
+			return nil, &unboundVarError{name: rp.name}
+		}
+		return rp.v, nil
+	} else if rp.arith != nil {
+		return rp.arith.eval(obj, root, lim)
+	} else if rp.fn != nil {
+		if err := rp.unboundFuncVar(); err != nil {
+			return nil, err
+		}
+		return rp.fn.evalValue(root, obj, lim), nil
+	} else if rp.steps != nil {
+		if rp.fromRoot {
+			return filter_get_from_steps(root, rp.steps)
+		}
+		return filter_get_from_steps(obj, rp.steps)
+	} else if strings.HasPrefix(rp.p, "@.") {
 		return filter_get_from_explicit_path(obj, rp.p)
 	} else if strings.HasPrefix(rp.p, "$.") {
 		return filter_get_from_explicit_path(root, rp.p)
 	} else if rp.isField {
 		// 默认字段取@.含义
 		return filter_get_from_explicit_path(obj, rp.p)
+	} else if rp.v != nil {
+		rp_v = rp.v
 	} else {
-		rp_v = &Value{s: rp.p, t: TypeString}
+		rp_v = filter_const(rp)
 	}
 	return rp_v, nil
 }
 
-func eval_filter(obj, root *Value, filter FilterTuple) (res bool, err error) {
-	lp_v, err := get_lp_v(obj, root, filter.lp)
+func eval_filter(obj, root *Value, filter FilterTuple, lim *evalLimiter) (res bool, err error) {
+	lp_v, err := get_lp_v(obj, root, filter.lp, lim)
+	if isUnboundVar(err) {
+		return false, err
+	}
 
 	if filter.op == "exists" {
+		if filter.lp.fn != nil {
+			return filter.lp.fn.evalLogical(root, obj, lim), nil
+		}
 		return lp_v != nil, nil
 	} else if filter.op == "=~" {
-		return false, fmt.Errorf("not implemented yet")
+		return eval_reg_filter(obj, root, filter.lp, filter.reg, lim)
 	} else {
-		rp_v, _ := get_rp_v(obj, root, filter.rp)
+		rp_v, err := get_rp_v(obj, root, filter.rp, lim)
+		if isUnboundVar(err) {
+			return false, err
+		}
+		if lp_v == nil || rp_v == nil {
+			// 字段不存在时比较结果为false
+			return false, nil
+		}
 
 		//fmt.Printf("lp_v: %v, rp_v: %v\n", lp_v, rp_v)
+		switch filter.op {
+		case "in", "nin", "contains", "subsetof", "anyof", "noneof", "size", "empty":
+			return cmp_collection(lp_v, rp_v, filter.op), nil
+		}
 		return cmp_any(lp_v, rp_v, filter.op)
 	}
 }
 
-func eval_filter_group(obj, root *Value, filter_group FilterTupleGroup) (res bool, err error) {
-	for idx, filter := range filter_group.tuples {
-		if idx == 0 {
-			res, err = eval_filter(obj, root, filter)
+func eval_filter_group(obj, root *Value, filter_group *FilterTupleGroup, lim *evalLimiter) (res bool, err error) {
+	return eval_filter_expr(obj, root, filter_group, filter_group.expr, lim)
+}
+
+func eval_filter_expr(obj, root *Value, filter_group *FilterTupleGroup, expr *filterExpr, lim *evalLimiter) (res bool, err error) {
+	switch expr.logic {
+	case "":
+		return eval_filter(obj, root, filter_group.tuples[expr.tuple], lim)
+	case "!":
+		res, err = eval_filter_expr(obj, root, filter_group, expr.args[0], lim)
+		return !res, err
+	case "&&", "||":
+		// 实现左值阻断逻辑
+		stop := expr.logic == "||"
+		for _, arg := range expr.args {
+			res, err = eval_filter_expr(obj, root, filter_group, arg, lim)
 			if err != nil {
 				return false, err
 			}
-		} else {
-			// 实现左值阻断逻辑
-			switch filter_group.logics[idx-1] {
-			case "&&":
-				if res == false {
-					return false, nil
-				}
-				res, err = eval_filter(obj, root, filter)
-				if err != nil {
-					return false, err
-				}
-			case "||":
-				if res == true {
-					return true, nil
-				}
-				res, err = eval_filter(obj, root, filter)
-				if err != nil {
-					return false, err
-				}
-			default:
-				return false, fmt.Errorf("invalid logic operator: %v", filter_group.logics[idx-1])
+			if res == stop {
+				return res, nil
 			}
 		}
+		return res, nil
+	default:
+		return false, fmt.Errorf("invalid logic operator: %v", expr.logic)
 	}
+}
 
-	return res, nil
+// 将filter中的常量解析为对应类型的Value
+// 引号包围的为字符串 true/false/null为对应的字面量 合法的JSON数字为数字 其余按字符串处理
+func filter_const(p Param) *Value {
+	if p.quoted {
+		return &Value{s: p.p, t: TypeString}
+	}
+
+	s := p.p
+	switch s {
+	case "true":
+		return valueTrue
+	case "false":
+		return valueFalse
+	case "null":
+		return valueNull
+	}
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return &Value{s: unescapeStringBestEffort(s[1 : len(s)-1]), t: TypeString}
+	}
+	if tail, err := validateNumber(s); err == nil && len(tail) == 0 {
+		return &Value{s: s, t: TypeNumber}
+	}
+	return &Value{s: s, t: TypeString}
 }
 
-func isNumber(o *Value) bool {
-	switch o.Type() {
-	case TypeNumber:
-		return true
-	case TypeString:
-		_, err := strconv.ParseFloat(o.s, 64)
-		if err == nil {
-			return true
-		} else {
+// 集合运算 类型不符时结果为false
+// in/nin: obj1是否为数组obj2的元素
+// contains: 数组obj1是否包含obj2 或字符串obj1是否包含子串obj2
+// subsetof/anyof/noneof: 数组obj1的全部/任一/没有元素属于数组obj2
+// size: 数组 字符串或对象obj1的长度是否等于obj2
+// empty: 数组 字符串或对象obj1是否为空与obj2是否一致
+func cmp_collection(obj1, obj2 *Value, op string) bool {
+	t1, t2 := obj1.Type(), obj2.Type()
+	switch op {
+	case "in", "nin":
+		if t2 != TypeArray {
+			return false
+		}
+		return contains_value(obj2.a, obj1) == (op == "in")
+	case "contains":
+		switch t1 {
+		case TypeArray:
+			return contains_value(obj1.a, obj2)
+		case TypeString:
+			return t2 == TypeString && strings.Contains(obj1.s, obj2.s)
+		}
+		return false
+	case "subsetof", "anyof", "noneof":
+		if t1 != TypeArray || t2 != TypeArray {
+			return false
+		}
+		for _, v := range obj1.a {
+			found := contains_value(obj2.a, v)
+			if op == "subsetof" && !found {
+				return false
+			}
+			if op == "anyof" && found {
+				return true
+			}
+			if op == "noneof" && found {
+				return false
+			}
+		}
+		return op != "anyof"
+	case "size", "empty":
+		n := 0
+		switch t1 {
+		case TypeArray:
+			n = len(obj1.a)
+		case TypeString:
+			n = utf8.RuneCountInString(obj1.s)
+		case TypeObject:
+			n = obj1.o.Len()
+		default:
+			return false
+		}
+		if op == "empty" {
+			return t2 == TypeTrue && n == 0 || t2 == TypeFalse && n > 0
+		}
+		if t2 != TypeNumber {
 			return false
 		}
+		f, err := fastfloat.Parse(obj2.s)
+		return err == nil && f == float64(n)
+	}
+	return false
+}
+
+func contains_value(a []*Value, v *Value) bool {
+	for _, x := range a {
+		if equal_value(x, v) {
+			return true
+		}
 	}
 	return false
 }
 
+// 按JSON语义比较两个值
+// 数字按数值比较 字符串按码点比较 布尔和null只支持==和!=
+// 对象和数组按内容判断是否相等 类型不同时==为false !=为true 其余比较均为false
 func cmp_any(obj1, obj2 *Value, op string) (bool, error) {
 	switch op {
 	case "<", "<=", "==", "!=", ">=", ">":
@@ -988,26 +1959,80 @@ func cmp_any(obj1, obj2 *Value, op string) (bool, error) {
 		return false, fmt.Errorf("op should only be <, <=, ==, >= and >")
 	}
 
-	var exp string
-	if isNumber(obj1) && isNumber(obj2) {
-		exp = fmt.Sprintf(`%v %s %v`, obj1.s, op, obj2.s)
-	} else {
-		exp = fmt.Sprintf(`"%v" %s "%v"`, obj1.s, op, obj2.s)
+	t1, t2 := obj1.Type(), obj2.Type()
+	switch {
+	case t1 == TypeNumber && t2 == TypeNumber:
+		f1 := fastfloat.ParseBestEffort(obj1.s)
+		f2 := fastfloat.ParseBestEffort(obj2.s)
+		switch {
+		case f1 < f2:
+			return op == "<" || op == "<=" || op == "!=", nil
+		case f1 > f2:
+			return op == ">" || op == ">=" || op == "!=", nil
+		default:
+			return op == "==" || op == "<=" || op == ">=", nil
+		}
+	case t1 == TypeString && t2 == TypeString:
+		// UTF-8编码下按字节比较与按码点比较结果一致
+		switch c := strings.Compare(obj1.s, obj2.s); {
+		case c < 0:
+			return op == "<" || op == "<=" || op == "!=", nil
+		case c > 0:
+			return op == ">" || op == ">=" || op == "!=", nil
+		default:
+			return op == "==" || op == "<=" || op == ">=", nil
+		}
 	}
 
-	//fmt.Println("exp: ", exp)
-	fset := token.NewFileSet()
-	res, err := types.Eval(fset, nil, 0, exp)
-	if err != nil {
-		return false, err
+	switch op {
+	case "==":
+		return equal_value(obj1, obj2), nil
+	case "!=":
+		return !equal_value(obj1, obj2), nil
+	case "<=", ">=":
+		// 布尔 null 对象 数组不支持大小比较 只在相等时满足<=和>=
+		return equal_value(obj1, obj2), nil
+	default:
+		return false, nil
 	}
+}
 
-	if res.IsValue() == false || (res.Value.String() != "false" && res.Value.String() != "true") {
-		return false, fmt.Errorf("result should only be true or false")
-	}
-	if res.Value.String() == "true" {
-		return true, nil
+// 判断两个值是否相等 对象和数组递归比较
+func equal_value(obj1, obj2 *Value) bool {
+	t1, t2 := obj1.Type(), obj2.Type()
+	if t1 != t2 {
+		return false
 	}
 
-	return false, nil
+	switch t1 {
+	case TypeNumber:
+		return fastfloat.ParseBestEffort(obj1.s) == fastfloat.ParseBestEffort(obj2.s)
+	case TypeString:
+		return obj1.s == obj2.s
+	case TypeArray:
+		if len(obj1.a) != len(obj2.a) {
+			return false
+		}
+		for i := range obj1.a {
+			if !equal_value(obj1.a[i], obj2.a[i]) {
+				return false
+			}
+		}
+		return true
+	case TypeObject:
+		if obj1.o.Len() != obj2.o.Len() {
+			return false
+		}
+		obj1.o.unescapeKeys()
+		for _, kv := range obj1.o.kvs {
+			v := obj2.o.Get(kv.k)
+			if v == nil || !equal_value(kv.v, v) {
+				return false
+			}
+		}
+		return true
+	default:
+		// true false null
+		return true
+	}
 }
@@ -0,0 +1,192 @@
+package fastjson
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/JimWen/fastjson/fastfloat"
+)
+
+// arithExpr is an arithmetic expression in a filter, i.e. `@.price * @.qty`.
+//
+// Operators must be separated from operands by spaces, since `-` and `*`
+// may be a part of field names. `*`, `/` and `%` take precedence over
+// `+` and `-`. Parentheses may be used for grouping.
+type arithExpr struct {
+	// op is one of `+`, `-`, `*`, `/` and `%`. It is 0 for operands.
+	op byte
+
+	x, y *arithExpr
+
+	// p is the operand, which may be a field, a number or a function call.
+	p Param
+}
+
+// isArithOp returns true if w is an arithmetic operator.
+func isArithOp(w filter_word) bool {
+	return !w.quoted && len(w.s) == 1 && (w.s[0] == '+' || w.s[0] == '-' || w.s[0] == '*' || w.s[0] == '/' || w.s[0] == '%')
+}
+
+// isArithGroup returns true if w is an arithmetic expression in parentheses.
+func isArithGroup(w filter_word) bool {
+	return !w.quoted && len(w.s) >= 2 && w.s[0] == '(' && w.s[len(w.s)-1] == ')'
+}
+
+// parseArith parses the arithmetic expression consisting of words
+// from the given filter.
+func parseArith(filter string, words []filter_word) (*arithExpr, error) {
+	p := &arithParser{
+		filter: filter,
+		words:  words,
+	}
+	x, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(words) {
+		return nil, newPathSyntaxError(filter, words[p.pos].pos, "arithmetic operator", "")
+	}
+	return x, nil
+}
+
+type arithParser struct {
+	filter string
+	words  []filter_word
+	pos    int
+}
+
+func (p *arithParser) parseSum() (*arithExpr, error) {
+	return p.parseBinary("+-", p.parseProduct)
+}
+
+func (p *arithParser) parseProduct() (*arithExpr, error) {
+	return p.parseBinary("*/%", p.parseOperand)
+}
+
+// parseBinary parses left-associative sequence of operands joined with ops.
+func (p *arithParser) parseBinary(ops string, parseArg func() (*arithExpr, error)) (*arithExpr, error) {
+	x, err := parseArg()
+	if err != nil {
+		return nil, err
+	}
+	for p.pos < len(p.words) {
+		w := p.words[p.pos]
+		if !isArithOp(w) || strings.IndexByte(ops, w.s[0]) < 0 {
+			break
+		}
+		p.pos++
+		y, err := parseArg()
+		if err != nil {
+			return nil, err
+		}
+		x = &arithExpr{
+			op: w.s[0],
+			x:  x,
+			y:  y,
+		}
+	}
+	return x, nil
+}
+
+func (p *arithParser) parseOperand() (*arithExpr, error) {
+	if p.pos >= len(p.words) {
+		return nil, newPathSyntaxError(p.filter, len(p.filter), "operand", "")
+	}
+	w := p.words[p.pos]
+	if isArithOp(w) || !w.quoted && strings.Trim(w.s, "<>=!~") == "" {
+		// Comparison operators aren't operands.
+		return nil, newPathSyntaxError(p.filter, w.pos, "operand", "")
+	}
+	p.pos++
+
+	if isArithGroup(w) {
+		inner := w.s[1 : len(w.s)-1]
+		words, err := split_filter_words(inner)
+		if err == nil {
+			var x *arithExpr
+			if x, err = parseArith(inner, words); err == nil {
+				return x, nil
+			}
+		}
+		return nil, toPathSyntaxError(p.filter, w.pos+1, err)
+	}
+
+	x := &arithExpr{
+		p: Param{
+			p:       w.s,
+			quoted:  w.quoted,
+			isField: !w.quoted && !is_filter_literal(w.s),
+		},
+	}
+	if err := compile_param(&x.p); err != nil {
+		return nil, toPathSyntaxError(p.filter, w.pos, err)
+	}
+	if fn := x.p.fn; fn != nil && fn.fn.Result != FuncTypeValue {
+		return nil, newPathSyntaxError(p.filter, w.pos, "", fmt.Sprintf("result of %s() cannot be used in arithmetic expression", fn.name))
+	}
+	return x, nil
+}
+
+// eval returns the number calculated by x for the current node obj.
+//
+// nil is returned if some operand isn't a number or the result isn't finite,
+// so the comparison with the result is false like for missing fields.
+// An error is returned only for unbound `$$name` placeholders.
+func (x *arithExpr) eval(obj, root *Value, lim *evalLimiter) (*Value, error) {
+	f, ok, err := x.evalFloat(obj, root, lim)
+	if !ok {
+		return nil, err
+	}
+	return &Value{
+		s: strconv.FormatFloat(f, 'g', -1, 64),
+		t: TypeNumber,
+	}, nil
+}
+
+func (x *arithExpr) evalFloat(obj, root *Value, lim *evalLimiter) (float64, bool, error) {
+	if x.op == 0 {
+		v, err := get_lp_v(obj, root, x.p, lim)
+		if isUnboundVar(err) {
+			return 0, false, err
+		}
+		if err != nil || v == nil || v.Type() != TypeNumber {
+			return 0, false, nil
+		}
+		f, err := fastfloat.Parse(v.s)
+		return f, err == nil, nil
+	}
+
+	a, ok, err := x.x.evalFloat(obj, root, lim)
+	if !ok {
+		return 0, false, err
+	}
+	b, ok, err := x.y.evalFloat(obj, root, lim)
+	if !ok {
+		return 0, false, err
+	}
+	var f float64
+	switch x.op {
+	case '+':
+		f = a + b
+	case '-':
+		f = a - b
+	case '*':
+		f = a * b
+	case '/':
+		if b == 0 {
+			return 0, false, nil
+		}
+		f = a / b
+	case '%':
+		if b == 0 {
+			return 0, false, nil
+		}
+		f = math.Mod(a, b)
+	}
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, false, nil
+	}
+	return f, true, nil
+}
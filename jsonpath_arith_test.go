@@ -0,0 +1,123 @@
+package fastjson
+
+import (
+	"testing"
+)
+
+func TestFilterArith(t *testing.T) {
+	root := MustParse(`{
+		"minDuration": 5,
+		"items": [
+			{"id": 1, "price": 10, "qty": 5, "start": 1, "end": 10, "discount": 2},
+			{"id": 2, "price": 30, "qty": 4, "start": 3, "end": 6, "discount": 20},
+			{"id": 3, "price": 0.5, "qty": 300, "start": 0, "end": 5},
+			{"id": 4, "price": "10", "qty": 20, "start": 2, "end": 2, "discount": 0}
+		]
+	}`)
+
+	f := func(path, resultExpected string) {
+		t.Helper()
+		c, err := Compile(path)
+		if err != nil {
+			t.Fatalf("cannot compile %s: %s", path, err)
+		}
+		v, err := c.Lookup(root)
+		if err != nil {
+			t.Fatalf("unexpected error for %s: %s", path, err)
+		}
+		if result := v.String(); result != resultExpected {
+			t.Fatalf("unexpected result for %s; got %s; want %s", path, result, resultExpected)
+		}
+	}
+
+	f(`$.items[?(@.price * @.qty > 100)].id`, `[2,3]`)
+	f(`$.items[?(@.end - @.start >= $.minDuration)].id`, `[1,3]`)
+	f(`$.items[?(@.price + @.qty * 2 == 20)].id`, `[1]`)
+	f(`$.items[?((@.price + @.qty) * 2 == 30)].id`, `[1]`)
+	f(`$.items[?(@.qty / @.price == 600)].id`, `[3]`)
+	f(`$.items[?(@.qty % 3 == 0)].id`, `[3]`)
+	f(`$.items[?(@.qty - 10 - 5 < 0)].id`, `[1,2]`)
+
+	// field-to-field comparisons and constants on the left side
+	f(`$.items[?(@.price > @.discount)].id`, `[1,2]`)
+	f(`$.items[?(@.end == @['start'])].id`, `[4]`)
+	f(`$.items[?(100 < @.price * @.qty)].id`, `[2,3]`)
+	f(`$.items[?('10' == @.price)].id`, `[4]`)
+
+	// missing fields, non-numbers and division by zero make the comparison false
+	f(`$.items[?(@.price - @.discount >= 0)].id`, `[1,2]`)
+	f(`$.items[?(@.price / @.discount > 0)].id`, `[1,2]`)
+	f(`$.items[?(!(@.price * @.qty > 100))].id`, `[1,4]`)
+
+	// function calls in arithmetic expressions
+	f(`$.items[?(length(@) - 5 == 1)].id`, `[1,2,4]`)
+
+	// arithmetic combined with logical operators
+	f(`$.items[?(@.price * @.qty > 100 && @.end - @.start < 5)].id`, `[2]`)
+	f(`$.items[?((@.price * @.qty > 100) || @.qty * 1 == 20)].id`, `[2,3,4]`)
+
+	// comparison operators without spaces
+	f(`$.items[?(@.id>2)].id`, `[3,4]`)
+	f(`$.items[?(@.id<=2&&@.qty!=5)].id`, `[2]`)
+	f(`$.items[?(@.price=='10')].id`, `[4]`)
+	f(`$.items[?('10'==@.price)].id`, `[4]`)
+	f(`$.items[?(@.price * @.qty>100)].id`, `[2,3]`)
+}
+
+func TestFilterUnspacedOperators(t *testing.T) {
+	root := MustParse(`{"records": [{"type": "x", "id": 1, "name": "a==b"}, {"type": "y", "id": 2, "name": "c<d"}, {"type": "x", "id": 3}]}`)
+
+	f := func(path, resultExpected string) {
+		t.Helper()
+		v, err := MustCompile(path).Lookup(root)
+		if err != nil {
+			t.Fatalf("unexpected error for %s: %s", path, err)
+		}
+		if result := v.String(); result != resultExpected {
+			t.Fatalf("unexpected result for %s; got %s; want %s", path, result, resultExpected)
+		}
+	}
+
+	f(`$.records[?(@.type=='x')].id`, `[1,3]`)
+	f(`$.records[?(@.type!="x")].id`, `[2]`)
+	f(`$.records[?(@.id>1)].id`, `[2,3]`)
+	f(`$.records[?(@.id>=2 && @.id<3)].id`, `[2]`)
+	f(`$.records[?(@.name=='a==b')].id`, `[1]`)
+	f(`$.records[?(@['name']=="c<d")].id`, `[2]`)
+	f(`$.records[?(@.name=~/^c<d$/)].id`, `[2]`)
+	f(`$.records[?(length(@.name)>3)].id`, `[1]`)
+}
+
+func TestFilterArithError(t *testing.T) {
+	f := func(path string, offsetExpected int, messageExpected string) {
+		t.Helper()
+		_, err := Compile(path)
+		if err == nil {
+			t.Fatalf("expecting non-nil error for %s", path)
+		}
+		se, ok := err.(*PathSyntaxError)
+		if !ok {
+			t.Fatalf("unexpected error type for %s: %T: %s", path, err, err)
+		}
+		if se.Offset != offsetExpected {
+			t.Fatalf("unexpected offset for %s; got %d; want %d; err: %s", path, se.Offset, offsetExpected, se)
+		}
+		if msg := se.message(); msg != messageExpected {
+			t.Fatalf("unexpected message for %s; got %q; want %q", path, msg, messageExpected)
+		}
+	}
+
+	f(`$[?(@.a * @.b)]`, 4, `result of arithmetic expression must be compared`)
+	f(`$[?(@.a * > 1)]`, 10, `expecting operand, found ">"`)
+	f(`$[?(@.a == 1 2)]`, 13, `expecting '&&', '||' or end of filter, found "2"`)
+	f(`$[?((@.a * ) > 1)]`, 11, `expecting operand, found ")"`)
+	f(`$[?(match(@.a, 'x') + 1 > 1)]`, 4, `result of match() cannot be used in arithmetic expression`)
+
+	// arithmetic operators without spaces would be parsed as a part of member name
+	f(`$[?(@.a*@.b > 1)]`, 7, `arithmetic operators must be separated by spaces`)
+	f(`$[?(@.a+1 > 1)]`, 7, `arithmetic operators must be separated by spaces`)
+	f(`$[?(1 < @.a-@.b)]`, 11, `arithmetic operators must be separated by spaces`)
+	f(`$[?(@.a/2)]`, 7, `arithmetic operators must be separated by spaces`)
+	f(`$[?((@.a + @.b)*2 == 30)]`, 15, `arithmetic operators must be separated by spaces`)
+	f(`$[?(@.a>=@.b+8)]`, 12, `arithmetic operators must be separated by spaces`)
+}
@@ -0,0 +1,866 @@
+package fastjson
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/JimWen/fastjson/fastfloat"
+)
+
+// GetPath returns raw JSON values matched by c in data.
+//
+// Unlike c.Lookup, GetPath doesn't parse data into Value tree. It scans
+// data and skips subtrees, which cannot match c, so it is much faster than
+// parsing when a few fields must be obtained from big JSON.
+//
+// The returned values point into data, so data mustn't be modified
+// while they are in use. Only the visited parts of data are validated.
+// Use Validate for validating the whole data.
+//
+// Values for paths with filters referring to the document root `$`
+// are evaluated on the parsed data and are copied.
+//
+// The matched values are returned in the same order as c.LookupNodes
+// returns them.
+func GetPath(data []byte, c *Compiled) ([][]byte, error) {
+	var e rawEvaluator
+	defer e.reset()
+
+	if c.needsRoot() {
+		return e.getPathParsed(data, c)
+	}
+
+	s := skipWS(b2s(data))
+	if len(s) == 0 {
+		return nil, fmt.Errorf("cannot parse empty string")
+	}
+	var nodes []string
+	var err error
+	if c.query != nil {
+		nodes, err = e.selectQuery(c.query, s)
+	} else {
+		nodes, _, err = e.lookupSteps(c.steps, []string{s}, false)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rawValues(nodes)
+}
+
+// rawValues returns the values at the start of nodes.
+func rawValues(nodes []string) ([][]byte, error) {
+	res := make([][]byte, len(nodes))
+	for i, n := range nodes {
+		tail, err := skipRawValue(n, 0)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse JSON: %s; unparsed tail: %q", err, startEndString(tail))
+		}
+		res[i] = s2b(n[:len(n)-len(tail)])
+	}
+	return res, nil
+}
+
+// GetPathString returns string value for the first value matched by c
+// in data.
+//
+// An empty string is returned on error or if the matched value isn't a string.
+// Use GetPath for proper error handling.
+func GetPathString(data []byte, c *Compiled) string {
+	b := getPathFirst(data, c)
+	if len(b) == 0 || b[0] != '"' {
+		return ""
+	}
+	// unescapeStringBestEffort unescapes in place, so it must work on a copy
+	// in order to leave data intact.
+	return unescapeStringBestEffort(string(b[1 : len(b)-1]))
+}
+
+// GetPathInt returns int value for the first value matched by c in data.
+//
+// 0 is returned on error or if the matched value isn't a number.
+// Use GetPath for proper error handling.
+func GetPathInt(data []byte, c *Compiled) int {
+	b := getPathFirst(data, c)
+	if rawType(b2s(b)) != TypeNumber {
+		return 0
+	}
+	n := fastfloat.ParseInt64BestEffort(b2s(b))
+	nn := int(n)
+	if int64(nn) != n {
+		return 0
+	}
+	return nn
+}
+
+// GetPathFloat64 returns float64 value for the first value matched by c
+// in data.
+//
+// 0 is returned on error or if the matched value isn't a number.
+// Use GetPath for proper error handling.
+func GetPathFloat64(data []byte, c *Compiled) float64 {
+	b := getPathFirst(data, c)
+	if rawType(b2s(b)) != TypeNumber {
+		return 0
+	}
+	return fastfloat.ParseBestEffort(b2s(b))
+}
+
+// GetPathBool returns boolean value for the first value matched by c
+// in data.
+//
+// false is returned on error or if the matched value isn't a boolean.
+// Use GetPath for proper error handling.
+func GetPathBool(data []byte, c *Compiled) bool {
+	return string(getPathFirst(data, c)) == "true"
+}
+
+// ExistsPath returns true if c matches at least a single value in data.
+//
+// false is returned on error. Use GetPath for proper error handling.
+func ExistsPath(data []byte, c *Compiled) bool {
+	a, err := GetPath(data, c)
+	return err == nil && len(a) > 0
+}
+
+func getPathFirst(data []byte, c *Compiled) []byte {
+	a, err := GetPath(data, c)
+	if err != nil || len(a) == 0 {
+		return nil
+	}
+	return a[0]
+}
+
+// needsRoot returns true if c contains filters, which may refer
+// to the document root.
+func (c *Compiled) needsRoot() bool {
+	// `$$name` placeholders don't refer to the root.
+	if !strings.Contains(strings.ReplaceAll(c.path[1:], "$$", ""), "$") {
+		return false
+	}
+	if c.query != nil {
+		for _, seg := range c.query.segments {
+			for _, sel := range seg.selectors {
+				if sel.kind == selectorFilter {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	for _, s := range c.steps {
+		if s.op == "filter" {
+			return true
+		}
+	}
+	return false
+}
+
+// rawEvaluator evaluates JSONPath over raw JSON.
+//
+// Nodes are represented by the tail of the JSON data starting at the node value.
+type rawEvaluator struct {
+	// p is used for parsing the values, which must be tested by filters.
+	p *Parser
+}
+
+func (e *rawEvaluator) reset() {
+	if e.p != nil {
+		handyPool.Put(e.p)
+		e.p = nil
+	}
+}
+
+// parse parses the value at the start of n.
+//
+// The returned value is valid until the next call to parse.
+func (e *rawEvaluator) parse(n string) (*Value, error) {
+	tail, err := skipRawValue(n, 0)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse JSON: %s; unparsed tail: %q", err, startEndString(tail))
+	}
+	if e.p == nil {
+		e.p = handyPool.Get()
+	}
+	return e.p.Parse(n[:len(n)-len(tail)])
+}
+
+// getPathParsed evaluates c on the parsed data.
+func (e *rawEvaluator) getPathParsed(data []byte, c *Compiled) ([][]byte, error) {
+	e.p = handyPool.Get()
+	root, err := e.p.ParseBytes(data)
+	if err != nil {
+		return nil, err
+	}
+	return marshaledValues(root, c)
+}
+
+// marshaledValues returns copies of the values matched by c in root.
+func marshaledValues(root *Value, c *Compiled) ([][]byte, error) {
+	var err error
+	var nodes []node
+	if c.query != nil {
+		nodes = c.query.selectNodes(root, node{v: root}, false, nil)
+	} else if nodes, _, err = c.lookup_nodes(root, false); err != nil {
+		return nil, err
+	}
+	res := make([][]byte, len(nodes))
+	for i, n := range nodes {
+		res[i] = n.v.MarshalTo(nil)
+	}
+	return res, nil
+}
+
+// lookupSteps is the raw JSON counterpart of lookup_steps.
+func (e *rawEvaluator) lookupSteps(steps []step, nodes []string, multi bool) ([]string, bool, error) {
+	for i := 0; i < len(steps); i++ {
+		s := steps[i]
+		scan := false
+		if s.op == "scan" {
+			all := make([]string, 0, len(nodes))
+			for _, n := range nodes {
+				var err error
+				if all, err = rawDescendants(all, n, 0); err != nil {
+					return nil, false, err
+				}
+			}
+			multi = true
+			if i+1 == len(steps) {
+				res := make([]string, 0, len(all))
+				for _, n := range all {
+					var err error
+					if res, err = rawChildren(res, n); err != nil {
+						return nil, false, err
+					}
+				}
+				return res, true, nil
+			}
+			nodes = all
+			scan = true
+			i++
+			s = steps[i]
+		}
+
+		res := make([]string, 0, len(nodes))
+		for _, n := range nodes {
+			ns, more, err := e.applyStep(n, s, !multi, scan)
+			if err != nil {
+				return nil, false, err
+			}
+			if more {
+				multi = true
+			}
+			res = append(res, ns...)
+		}
+		nodes = res
+
+		if !multi && len(nodes) == 0 {
+			return nil, false, nil
+		}
+	}
+	return nodes, multi, nil
+}
+
+// applyStep is the raw JSON counterpart of apply_step.
+func (e *rawEvaluator) applyStep(n string, s step, strict, scan bool) ([]string, bool, error) {
+	nodes := []string{n}
+	multi := false
+	if len(s.key) > 0 {
+		var err error
+		nodes, multi, err = rawSelectKey(n, s.key, strict, scan)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	strict = strict && !multi
+
+	var res []string
+	switch s.op {
+	case "key":
+		if s.args == nil {
+			return nodes, multi, nil
+		}
+		keys := s.args.([]string)
+		if len(keys) == 0 {
+			return nil, false, fmt.Errorf("cannot index on empty key slice")
+		}
+		if len(keys) > 1 {
+			multi = true
+			strict = false
+		}
+		for _, n := range nodes {
+			for _, k := range keys {
+				ns, more, err := rawSelectKey(n, k, strict, scan)
+				if err != nil {
+					return nil, false, err
+				}
+				if more {
+					multi = true
+				}
+				res = append(res, ns...)
+			}
+		}
+	case "idx":
+		idxs := s.args.([]int)
+		if len(idxs) == 0 {
+			return nil, false, fmt.Errorf("cannot index on empty index slice")
+		}
+		if len(idxs) > 1 {
+			multi = true
+		}
+		for _, n := range nodes {
+			if rawType(n) != TypeArray {
+				if strict {
+					return nil, false, typeMismatchErrorf("fail to exec get_idx:%d, object is not Slice", idxs[0])
+				}
+				continue
+			}
+			if len(idxs) == 1 && idxs[0] >= 0 {
+				// Fast path - stop scanning the array after the requested item.
+				item, err := rawArrayItem(n, idxs[0])
+				if err != nil {
+					return nil, false, err
+				}
+				if item != "" {
+					res = append(res, item)
+					continue
+				}
+				if !strict {
+					continue
+				}
+				// Fall back to the slow path for the proper error message.
+			}
+			items, err := rawChildren(nil, n)
+			if err != nil {
+				return nil, false, err
+			}
+			for _, idx := range idxs {
+				i, err := normalize_idx(len(items), idx)
+				if err != nil {
+					if strict {
+						return nil, false, err
+					}
+					continue
+				}
+				res = append(res, items[i])
+			}
+		}
+	case "range":
+		var frm, to, stp interface{}
+		switch argsv := s.args.(type) {
+		case [2]interface{}:
+			frm, to = argsv[0], argsv[1]
+		case [3]interface{}:
+			frm, to, stp = argsv[0], argsv[1], argsv[2]
+		default:
+			return nil, false, fmt.Errorf("range args length should be 2 or 3")
+		}
+		multi = true
+		for _, n := range nodes {
+			t := rawType(n)
+			if frm == nil && to == nil && stp == nil && t == TypeObject {
+				var err error
+				if res, err = rawChildren(res, n); err != nil {
+					return nil, false, err
+				}
+				continue
+			}
+			if t != TypeArray {
+				if strict {
+					return nil, false, typeMismatchErrorf("fail to exec get_idx:from %v to %v, object is not Slice", frm, to)
+				}
+				continue
+			}
+			items, err := rawChildren(nil, n)
+			if err != nil {
+				return nil, false, err
+			}
+			idxs, err := range_idxs(len(items), frm, to, stp)
+			if err != nil {
+				if strict {
+					return nil, false, err
+				}
+				continue
+			}
+			for _, i := range idxs {
+				res = append(res, items[i])
+			}
+		}
+	case "filter":
+		group := s.args.(*FilterTupleGroup)
+		for _, n := range nodes {
+			t := rawType(n)
+			if t != TypeArray && t != TypeObject {
+				if strict {
+					return nil, false, typeMismatchErrorf("don't support filter on this type: %v", t)
+				}
+				continue
+			}
+			if t == TypeObject && !scan {
+				// The filter tests the object itself like get_filtered does.
+				ok, err := e.filter(n, group)
+				if err != nil {
+					return nil, false, err
+				}
+				if ok {
+					res = append(res, n)
+				}
+				continue
+			}
+			multi = true
+			items, err := rawChildren(nil, n)
+			if err != nil {
+				return nil, false, err
+			}
+			for _, item := range items {
+				ok, err := e.filter(item, group)
+				if err != nil {
+					return nil, false, err
+				}
+				if ok {
+					res = append(res, item)
+				}
+			}
+		}
+	default:
+		return nil, false, fmt.Errorf("expression don't support in filter")
+	}
+
+	return res, multi, nil
+}
+
+func (e *rawEvaluator) filter(n string, group *FilterTupleGroup) (bool, error) {
+	v, err := e.parse(n)
+	if err != nil {
+		return false, err
+	}
+	return eval_filter_group(v, nil, group, nil)
+}
+
+// rawSelectKey is the raw JSON counterpart of select_key.
+func rawSelectKey(n, key string, strict, scan bool) ([]string, bool, error) {
+	switch rawType(n) {
+	case TypeObject:
+		v, err := rawObjectMember(n, key)
+		if err != nil {
+			return nil, false, err
+		}
+		if v == "" {
+			if strict {
+				return nil, false, notFoundErrorf("key error: %s not found in object", key)
+			}
+			return nil, false, nil
+		}
+		return []string{v}, false, nil
+	case TypeArray:
+		if scan {
+			return nil, false, nil
+		}
+		var res []string
+		_, err := visitRawArray(n[1:], 0, func(item string) (bool, error) {
+			var v string
+			var err error
+			switch rawType(item) {
+			case TypeObject:
+				v, err = rawObjectMember(item, key)
+			case TypeArray:
+				// Value.Get accepts array indexes as keys.
+				var idx int
+				if idx, err = parseArrayIndex(key); err == nil {
+					v, err = rawArrayItem(item, idx)
+				} else {
+					err = nil
+				}
+			}
+			if v != "" {
+				res = append(res, v)
+			}
+			return true, err
+		})
+		if err != nil {
+			return nil, false, err
+		}
+		return res, true, nil
+	default:
+		if strict {
+			return nil, false, typeMismatchErrorf("fail to exec get_key:%s, object is not map", key)
+		}
+		return nil, false, nil
+	}
+}
+
+func parseArrayIndex(s string) (int, error) {
+	n := 0
+	if len(s) == 0 || len(s) > 9 {
+		return 0, fmt.Errorf("invalid array index %q", s)
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return 0, fmt.Errorf("invalid array index %q", s)
+		}
+		n = n*10 + int(s[i]-'0')
+	}
+	return n, nil
+}
+
+// selectQuery is the raw JSON counterpart of rfcQuery.selectNodes.
+func (e *rawEvaluator) selectQuery(q *rfcQuery, root string) ([]string, error) {
+	nodes := []string{root}
+	for i := range q.segments {
+		var err error
+		if nodes, err = e.selectSegment(&q.segments[i], nodes); err != nil || len(nodes) == 0 {
+			return nil, err
+		}
+	}
+	return nodes, nil
+}
+
+// selectSegment is the raw JSON counterpart of rfcSegment.selectNodes.
+func (e *rawEvaluator) selectSegment(seg *rfcSegment, nodes []string) ([]string, error) {
+	var res []string
+	for _, n := range nodes {
+		var err error
+		if !seg.descendant {
+			if res, err = e.selectChildren(res, seg, n); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		all, err := rawDescendants(nil, n, 0)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range all {
+			if res, err = e.selectChildren(res, seg, d); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return res, nil
+}
+
+func (e *rawEvaluator) selectChildren(dst []string, seg *rfcSegment, n string) ([]string, error) {
+	t := rawType(n)
+	var items []string
+	for i := range seg.selectors {
+		sel := &seg.selectors[i]
+		var err error
+		switch sel.kind {
+		case selectorName:
+			if t == TypeObject {
+				var v string
+				if v, err = rawObjectMember(n, sel.name); v != "" {
+					dst = append(dst, v)
+				}
+			}
+		case selectorWildcard:
+			dst, err = rawChildren(dst, n)
+		case selectorIndex:
+			if t != TypeArray {
+				break
+			}
+			if sel.index >= 0 {
+				var v string
+				if v, err = rawArrayItem(n, sel.index); v != "" {
+					dst = append(dst, v)
+				}
+				break
+			}
+			if items == nil {
+				if items, err = rawChildren(nil, n); err != nil {
+					break
+				}
+			}
+			if idx := sel.index + len(items); idx >= 0 {
+				dst = append(dst, items[idx])
+			}
+		case selectorSlice:
+			if t != TypeArray {
+				break
+			}
+			if items == nil {
+				if items, err = rawChildren(nil, n); err != nil {
+					break
+				}
+			}
+			sel.slice.visit(len(items), func(i int) {
+				dst = append(dst, items[i])
+			})
+		case selectorFilter:
+			var children []string
+			if children, err = rawChildren(nil, n); err != nil {
+				break
+			}
+			for _, c := range children {
+				var v *Value
+				if v, err = e.parse(c); err != nil {
+					break
+				}
+				if sel.filter.evalLogical(nil, v, nil) {
+					dst = append(dst, c)
+				}
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return dst, nil
+}
+
+// rawType returns the type of the JSON value at the start of s.
+func rawType(s string) Type {
+	if len(s) == 0 {
+		return TypeNull
+	}
+	switch s[0] {
+	case '{':
+		return TypeObject
+	case '[':
+		return TypeArray
+	case '"':
+		return TypeString
+	case 't':
+		return TypeTrue
+	case 'f':
+		return TypeFalse
+	case 'n':
+		if strings.HasPrefix(s, "null") {
+			return TypeNull
+		}
+		return TypeNumber
+	default:
+		return TypeNumber
+	}
+}
+
+// rawObjectMember returns the value for the given key in the JSON object
+// at the start of n.
+//
+// An empty string is returned if the key is missing. The object isn't scanned
+// past the found member.
+func rawObjectMember(n, key string) (string, error) {
+	var res string
+	_, err := visitRawObject(n[1:], 0, func(k, v string) (bool, error) {
+		if rawKeyEqual(k, key) {
+			res = v
+			return false, nil
+		}
+		return true, nil
+	})
+	return res, err
+}
+
+// rawArrayItem returns idx-th item of the JSON array at the start of n.
+//
+// An empty string is returned if the item is missing. The array isn't scanned
+// past the found item.
+func rawArrayItem(n string, idx int) (string, error) {
+	var res string
+	_, err := visitRawArray(n[1:], 0, func(v string) (bool, error) {
+		if idx == 0 {
+			res = v
+			return false, nil
+		}
+		idx--
+		return true, nil
+	})
+	return res, err
+}
+
+// rawChildren appends member values or items of the JSON object or array
+// at the start of n to dst.
+func rawChildren(dst []string, n string) ([]string, error) {
+	var err error
+	switch rawType(n) {
+	case TypeObject:
+		_, err = visitRawObject(n[1:], 0, func(k, v string) (bool, error) {
+			dst = append(dst, v)
+			return true, nil
+		})
+	case TypeArray:
+		_, err = visitRawArray(n[1:], 0, func(v string) (bool, error) {
+			dst = append(dst, v)
+			return true, nil
+		})
+	}
+	return dst, err
+}
+
+// rawDescendants appends n and all its descendants to dst in document order.
+func rawDescendants(dst []string, n string, depth int) ([]string, error) {
+	depth++
+	if depth > MaxDepth {
+		return dst, fmt.Errorf("too big depth for the nested JSON; it exceeds %d", MaxDepth)
+	}
+	dst = append(dst, n)
+	children, err := rawChildren(nil, n)
+	if err != nil {
+		return dst, err
+	}
+	for _, c := range children {
+		if dst, err = rawDescendants(dst, c, depth); err != nil {
+			return dst, err
+		}
+	}
+	return dst, nil
+}
+
+func rawKeyEqual(rawKey, key string) bool {
+	if strings.IndexByte(rawKey, '\\') < 0 {
+		return rawKey == key
+	}
+	// rawKey points into the caller's data, which mustn't be modified
+	// by in-place unescaping.
+	return unescapeStringBestEffort(string(s2b(rawKey))) == key
+}
+
+// visitRawObject calls f for each member of the JSON object in s, which must
+// follow the opening '{'. f receives the raw key and the tail of s starting
+// at the member value.
+//
+// The tail of s after the object is returned. The iteration stops with an empty
+// tail if f returns false.
+func visitRawObject(s string, depth int, f func(k, v string) (bool, error)) (string, error) {
+	s = skipWS(s)
+	if len(s) == 0 {
+		return s, fmt.Errorf("missing '}'")
+	}
+	if s[0] == '}' {
+		return s[1:], nil
+	}
+	for {
+		var k string
+		var err error
+		s = skipWS(s)
+		if len(s) == 0 || s[0] != '"' {
+			return s, fmt.Errorf(`cannot find opening '"" for object key`)
+		}
+		if k, s, err = parseRawKey(s[1:]); err != nil {
+			return s, fmt.Errorf("cannot parse object key: %s", err)
+		}
+		s = skipWS(s)
+		if len(s) == 0 || s[0] != ':' {
+			return s, fmt.Errorf("missing ':' after object key")
+		}
+		s = skipWS(s[1:])
+		if f != nil {
+			ok, err := f(k, s)
+			if err != nil || !ok {
+				return "", err
+			}
+		}
+		if s, err = skipRawValue(s, depth); err != nil {
+			return s, fmt.Errorf("cannot parse object value: %s", err)
+		}
+		s = skipWS(s)
+		if len(s) == 0 {
+			return s, fmt.Errorf("unexpected end of object")
+		}
+		if s[0] == ',' {
+			s = s[1:]
+			continue
+		}
+		if s[0] == '}' {
+			return s[1:], nil
+		}
+		return s, fmt.Errorf("missing ',' after object value")
+	}
+}
+
+// visitRawArray calls f for each item of the JSON array in s, which must
+// follow the opening '['. f receives the tail of s starting at the item.
+//
+// The tail of s after the array is returned. The iteration stops with an empty
+// tail if f returns false.
+func visitRawArray(s string, depth int, f func(v string) (bool, error)) (string, error) {
+	s = skipWS(s)
+	if len(s) == 0 {
+		return s, fmt.Errorf("missing ']'")
+	}
+	if s[0] == ']' {
+		return s[1:], nil
+	}
+	for {
+		var err error
+		s = skipWS(s)
+		if f != nil {
+			ok, err := f(s)
+			if err != nil || !ok {
+				return "", err
+			}
+		}
+		if s, err = skipRawValue(s, depth); err != nil {
+			return s, fmt.Errorf("cannot parse array value: %s", err)
+		}
+		s = skipWS(s)
+		if len(s) == 0 {
+			return s, fmt.Errorf("unexpected end of array")
+		}
+		if s[0] == ',' {
+			s = s[1:]
+			continue
+		}
+		if s[0] == ']' {
+			return s[1:], nil
+		}
+		return s, fmt.Errorf("missing ',' after array value")
+	}
+}
+
+// skipRawValue returns the tail of s after the JSON value at the start of s.
+//
+// It is the allocation-free counterpart of parseValue.
+func skipRawValue(s string, depth int) (string, error) {
+	if len(s) == 0 {
+		return s, fmt.Errorf("cannot parse empty string")
+	}
+	depth++
+	if depth > MaxDepth {
+		return s, fmt.Errorf("too big depth for the nested JSON; it exceeds %d", MaxDepth)
+	}
+
+	switch s[0] {
+	case '{':
+		tail, err := visitRawObject(s[1:], depth, nil)
+		if err != nil {
+			return tail, fmt.Errorf("cannot parse object: %s", err)
+		}
+		return tail, nil
+	case '[':
+		tail, err := visitRawArray(s[1:], depth, nil)
+		if err != nil {
+			return tail, fmt.Errorf("cannot parse array: %s", err)
+		}
+		return tail, nil
+	case '"':
+		_, tail, err := parseRawString(s[1:])
+		if err != nil {
+			return tail, fmt.Errorf("cannot parse string: %s", err)
+		}
+		return tail, nil
+	case 't':
+		if !strings.HasPrefix(s, "true") {
+			return s, fmt.Errorf("unexpected value found: %q", startEndString(s))
+		}
+		return s[len("true"):], nil
+	case 'f':
+		if !strings.HasPrefix(s, "false") {
+			return s, fmt.Errorf("unexpected value found: %q", startEndString(s))
+		}
+		return s[len("false"):], nil
+	case 'n':
+		if strings.HasPrefix(s, "null") {
+			return s[len("null"):], nil
+		}
+		if len(s) >= 3 && strings.EqualFold(s[:3], "nan") {
+			return s[3:], nil
+		}
+		return s, fmt.Errorf("unexpected value found: %q", startEndString(s))
+	}
+
+	_, tail, err := parseRawNumber(s)
+	if err != nil {
+		return tail, fmt.Errorf("cannot parse number: %s", err)
+	}
+	return tail, nil
+}
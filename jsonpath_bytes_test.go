@@ -0,0 +1,232 @@
+package fastjson
+
+import (
+	"os"
+	"testing"
+)
+
+// checkGetPath verifies GetPath returns the same values as LookupNodes.
+func checkGetPath(t *testing.T, data []byte, c *Compiled) {
+	t.Helper()
+	var p Parser
+	root, err := p.ParseBytes(data)
+	if err != nil {
+		t.Fatalf("cannot parse %q: %s", data, err)
+	}
+	nodes, errExpected := c.LookupNodes(root)
+	res, err := GetPath(data, c)
+	if errExpected != nil {
+		if err == nil || err.Error() != errExpected.Error() {
+			t.Fatalf("unexpected error for %s; got %v; want %v", c, err, errExpected)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("unexpected error for %s: %s", c, err)
+	}
+	if len(res) != len(nodes) {
+		t.Fatalf("unexpected number of values for %s; got %d; want %d", c, len(res), len(nodes))
+	}
+	for i, b := range res {
+		v, err := ParseBytes(b)
+		if err != nil {
+			t.Fatalf("cannot parse value #%d for %s: %q: %s", i, c, b, err)
+		}
+		if !equal_value(v, nodes[i].Value) {
+			t.Fatalf("unexpected value #%d for %s; got %s; want %s", i, c, b, nodes[i].Value)
+		}
+	}
+}
+
+func TestGetPath(t *testing.T) {
+	data := []byte(`{
+		"store": {
+			"book": [
+				{"category": "reference", "author": "Nigel Rees", "price": 8.95},
+				{"category": "fiction", "author": "Evelyn Waugh", "price": 12.99},
+				{"category": "fiction", "author": "Herman \"M\"", "isbn": "0-553-21311-3", "price": 8.99},
+				{"category": "fiction", "author": "J. R. R. Tolkien", "isbn": "0-395-19395-8", "price": 22.99}
+			],
+			"bicycle": {"color": "red", "price": 19.95, "tags": [[1, 2], [3]]}
+		},
+		"expensive": 10,
+		"a.b": true,
+		"empty": {}
+	}`)
+
+	for _, path := range []string{
+		`$`,
+		`$.expensive`,
+		`$.store.book[0].author`,
+		`$.store.book[-1].author`,
+		`$.store.book[1,3].price`,
+		`$.store.book[1:2]`,
+		`$.store.book[::-2].price`,
+		`$.store.book[*].isbn`,
+		`$.store.book.author`,
+		`$.store.*`,
+		`$.store.bicycle.tags.0`,
+		`$['a.b']`,
+		`$['store']['bicycle', 'missing']`,
+		`$.store..price`,
+		`$..author`,
+		`$..*`,
+		`$..book[2]`,
+		`$..tags[0][1]`,
+		`$.store.book[?(@.price > 10)].author`,
+		`$.store.book[?(@.isbn && @.price < 10)]`,
+		`$.store.bicycle[?(@.color == 'red')].price`,
+		`$..[?(@.price > 20)]`,
+		`$.store.book[?(@.price < $.expensive)].author`,
+		`$.empty.*`,
+
+		// errors in the strict mode
+		`$.missing`,
+		`$.store.book[10]`,
+		`$.store.book[-10]`,
+		`$.expensive.x`,
+		`$.expensive[0]`,
+		`$.expensive[0:1]`,
+		`$.expensive[?(@.a)]`,
+	} {
+		checkGetPath(t, data, MustCompile(path))
+	}
+
+	for _, path := range []string{
+		`$`,
+		`$.store.book[0].author`,
+		`$.store.book[-1, 0].price`,
+		`$.store.book[1:]`,
+		`$["a.b"]`,
+		`$.store.*`,
+		`$..price`,
+		`$..*`,
+		`$.store.book[?@.price > 10].author`,
+		`$.store.book[?@.price < $.expensive].author`,
+		`$.missing`,
+		`$.store.book[10]`,
+	} {
+		checkGetPath(t, data, MustCompileRFC9535(path))
+	}
+}
+
+func TestGetPathRFC9535Compliance(t *testing.T) {
+	data, err := os.ReadFile("testdata/jsonpath-compliance/cts.json")
+	if err != nil {
+		t.Fatalf("cannot read compliance suite: %s", err)
+	}
+	suite, err := ParseBytes(data)
+	if err != nil {
+		t.Fatalf("cannot parse compliance suite: %s", err)
+	}
+	for _, tc := range suite.GetArray("tests") {
+		c, err := CompileRFC9535(string(tc.GetStringBytes("selector")))
+		if err != nil {
+			continue
+		}
+		checkGetPath(t, tc.Get("document").MarshalTo(nil), c)
+	}
+}
+
+func TestGetPathZeroCopy(t *testing.T) {
+	data := []byte(`{"a": {"b": "xyz"}, "c": [1, 2]}`)
+	res, err := GetPath(data, MustCompile(`$.a.b`))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(res) != 1 || string(res[0]) != `"xyz"` {
+		t.Fatalf("unexpected result: %q", res)
+	}
+	if &res[0][0] != &data[12] {
+		t.Fatalf("expecting the result to point into data")
+	}
+}
+
+func TestGetPathKeepsData(t *testing.T) {
+	// Escaped keys and strings mustn't be unescaped in place.
+	data := []byte(`{"a\"b": "x\ny", "c\u0064": {"e": "\u0066"}}`)
+	orig := string(data)
+
+	f := func(path, resultExpected string) {
+		t.Helper()
+		for i := 0; i < 2; i++ {
+			res, err := GetPath(data, MustCompile(path))
+			if err != nil {
+				t.Fatalf("unexpected error for %q: %s", path, err)
+			}
+			if len(res) != 1 || string(res[0]) != resultExpected {
+				t.Fatalf("unexpected result #%d for %q; got %q; want %q", i, path, res, resultExpected)
+			}
+			if string(data) != orig {
+				t.Fatalf("data has been modified by %q; got %s; want %s", path, data, orig)
+			}
+		}
+	}
+
+	f(`$["a\"b"]`, `"x\ny"`)
+	f(`$.cd.e`, `"\u0066"`)
+
+	for i := 0; i < 2; i++ {
+		if s := GetPathString(data, MustCompile(`$["a\"b"]`)); s != "x\ny" {
+			t.Fatalf("unexpected string; got %q; want %q", s, "x\ny")
+		}
+		if s := GetPathString(data, MustCompile(`$.cd.e`)); s != "f" {
+			t.Fatalf("unexpected string; got %q; want %q", s, "f")
+		}
+		if string(data) != orig {
+			t.Fatalf("data has been modified by GetPathString; got %s; want %s", data, orig)
+		}
+	}
+}
+
+func TestGetPathSkipsUnvisited(t *testing.T) {
+	// Malformed parts of data, which aren't visited, don't result in errors.
+	data := []byte(`{"a": 1, "b": [1, 2,, "c": 3`)
+	if n := GetPathInt(data, MustCompile(`$.a`)); n != 1 {
+		t.Fatalf("unexpected value; got %d; want 1", n)
+	}
+	if _, err := GetPath(data, MustCompile(`$.c`)); err == nil {
+		t.Fatalf("expecting non-nil error")
+	}
+	if _, err := GetPath([]byte(` `), MustCompile(`$.c`)); err == nil {
+		t.Fatalf("expecting non-nil error for empty data")
+	}
+}
+
+func TestGetPathHandy(t *testing.T) {
+	data := []byte(`{"s": "a\nb", "raw": "xyz", "n": 123, "f": 1.5, "t": true, "arr": [{"x": 1}, {"x": 2}]}`)
+
+	if s := GetPathString(data, MustCompile(`$.s`)); s != "a\nb" {
+		t.Fatalf("unexpected string; got %q; want %q", s, "a\nb")
+	}
+	if s := GetPathString(data, MustCompile(`$.raw`)); s != "xyz" {
+		t.Fatalf("unexpected string; got %q; want %q", s, "xyz")
+	}
+	if s := GetPathString(data, MustCompile(`$.n`)); s != "" {
+		t.Fatalf("unexpected string for number; got %q", s)
+	}
+	if n := GetPathInt(data, MustCompile(`$.n`)); n != 123 {
+		t.Fatalf("unexpected int; got %d; want 123", n)
+	}
+	if n := GetPathInt(data, MustCompile(`$.arr.x`)); n != 1 {
+		t.Fatalf("unexpected int for the first match; got %d; want 1", n)
+	}
+	if n := GetPathInt(data, MustCompile(`$.s`)); n != 0 {
+		t.Fatalf("unexpected int for string; got %d", n)
+	}
+	if f := GetPathFloat64(data, MustCompile(`$.f`)); f != 1.5 {
+		t.Fatalf("unexpected float64; got %v; want 1.5", f)
+	}
+	if !GetPathBool(data, MustCompile(`$.t`)) {
+		t.Fatalf("expecting true")
+	}
+	if GetPathBool(data, MustCompile(`$.n`)) {
+		t.Fatalf("expecting false for number")
+	}
+	if !ExistsPath(data, MustCompile(`$.arr[1]`)) {
+		t.Fatalf("expecting $.arr[1] to exist")
+	}
+	if ExistsPath(data, MustCompile(`$.arr[2]`)) {
+		t.Fatalf("unexpected $.arr[2]")
+	}
+}
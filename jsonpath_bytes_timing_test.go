@@ -0,0 +1,47 @@
+package fastjson
+
+import (
+	"fmt"
+	"testing"
+)
+
+func BenchmarkGetPath(b *testing.B) {
+	for _, path := range []string{`$.statuses[0].id_str`, `$.search_metadata.count`} {
+		b.Run(path, func(b *testing.B) {
+			benchmarkGetPath(b, path)
+		})
+	}
+}
+
+func benchmarkGetPath(b *testing.B, path string) {
+	c := MustCompile(path)
+	data := []byte(twitterFixture)
+	b.Run("GetPath", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(data)))
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				a, err := GetPath(data, c)
+				if err != nil || len(a) != 1 {
+					panic(fmt.Errorf("unexpected result for %s: %q, %v", path, a, err))
+				}
+			}
+		})
+	})
+	b.Run("ParseLookup", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(data)))
+		b.RunParallel(func(pb *testing.PB) {
+			var p Parser
+			for pb.Next() {
+				v, err := p.ParseBytes(data)
+				if err != nil {
+					panic(fmt.Errorf("cannot parse: %s", err))
+				}
+				if _, err := c.Lookup(v); err != nil {
+					panic(fmt.Errorf("unexpected error for %s: %s", path, err))
+				}
+			}
+		})
+	})
+}
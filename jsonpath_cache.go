@@ -0,0 +1,174 @@
+package fastjson
+
+import (
+	"container/list"
+	"sync"
+)
+
+// DefaultPathCacheSize is the default maximum number of compiled paths
+// held by DefaultPathCache.
+const DefaultPathCacheSize = 1024
+
+var defaultPathCache = NewPathCache(DefaultPathCacheSize)
+
+// DefaultPathCache returns the cache used by JsonPathLookup,
+// JsonPathLookupRaw and JsonPathExists.
+//
+// Its size may be changed via SetMaxSize.
+func DefaultPathCache() *PathCache {
+	return defaultPathCache
+}
+
+// PathCache is a bounded LRU cache of compiled JSONPath expressions.
+//
+// It may be used for evaluating paths, which aren't known in advance,
+// e.g. paths supplied by users, without compiling them on every call.
+//
+// It is safe calling PathCache methods from concurrent goroutines.
+type PathCache struct {
+	mu      sync.Mutex
+	maxSize int
+	lru     list.List
+	items   map[string]*list.Element
+	hits    uint64
+	misses  uint64
+}
+
+// PathCacheStats contains PathCache statistics.
+type PathCacheStats struct {
+	// Size is the number of cached paths.
+	Size int
+
+	// MaxSize is the maximum number of cached paths.
+	MaxSize int
+
+	// Hits is the number of Compile calls served from the cache.
+	Hits uint64
+
+	// Misses is the number of Compile calls, which had to compile the path.
+	Misses uint64
+}
+
+type pathCacheEntry struct {
+	path string
+	c    *Compiled
+}
+
+// NewPathCache returns a cache holding up to maxSize compiled paths.
+//
+// Paths aren't cached if maxSize <= 0.
+func NewPathCache(maxSize int) *PathCache {
+	return &PathCache{
+		maxSize: maxSize,
+		items:   make(map[string]*list.Element),
+	}
+}
+
+// Compile returns compiled jpath.
+//
+// The path is compiled with Compile on the first call and is returned
+// from the cache on subsequent calls until it is evicted by more recently
+// used paths. Compilation errors aren't cached.
+func (pc *PathCache) Compile(jpath string) (*Compiled, error) {
+	pc.mu.Lock()
+	if e, ok := pc.items[jpath]; ok {
+		pc.lru.MoveToFront(e)
+		pc.hits++
+		c := e.Value.(*pathCacheEntry).c
+		pc.mu.Unlock()
+		return c, nil
+	}
+	pc.misses++
+	pc.mu.Unlock()
+
+	// Compile outside the lock, so slow compilation doesn't block
+	// concurrent lookups for other paths.
+	c, err := Compile(jpath)
+	if err != nil {
+		return nil, err
+	}
+
+	pc.mu.Lock()
+	if e, ok := pc.items[jpath]; ok {
+		// The path has been cached by concurrent goroutine.
+		pc.lru.MoveToFront(e)
+		c = e.Value.(*pathCacheEntry).c
+	} else if pc.maxSize > 0 {
+		pc.items[jpath] = pc.lru.PushFront(&pathCacheEntry{
+			path: jpath,
+			c:    c,
+		})
+		pc.evictLocked()
+	}
+	pc.mu.Unlock()
+	return c, nil
+}
+
+// Lookup compiles jpath via pc and looks it up in obj.
+func (pc *PathCache) Lookup(obj *Value, jpath string) (*Value, error) {
+	c, err := pc.Compile(jpath)
+	if err != nil {
+		return nil, err
+	}
+	return c.Lookup(obj)
+}
+
+// LookupRaw is like Lookup, but returns the found value converted to Go value
+// in the same way as JsonPathLookupRaw does.
+func (pc *PathCache) LookupRaw(obj *Value, jpath string) (interface{}, error) {
+	v, err := pc.Lookup(obj, jpath)
+	if err != nil {
+		return nil, err
+	}
+	return raw_value(v), nil
+}
+
+// Exists returns true if jpath is valid and exists in obj.
+func (pc *PathCache) Exists(obj *Value, jpath string) bool {
+	c, err := pc.Compile(jpath)
+	if err != nil {
+		return false
+	}
+	return c.Exists(obj)
+}
+
+// SetMaxSize changes the maximum number of cached paths.
+//
+// The least recently used paths are evicted if pc holds more than maxSize paths.
+func (pc *PathCache) SetMaxSize(maxSize int) {
+	pc.mu.Lock()
+	pc.maxSize = maxSize
+	pc.evictLocked()
+	pc.mu.Unlock()
+}
+
+// Stats returns pc statistics.
+func (pc *PathCache) Stats() PathCacheStats {
+	pc.mu.Lock()
+	s := PathCacheStats{
+		Size:    pc.lru.Len(),
+		MaxSize: pc.maxSize,
+		Hits:    pc.hits,
+		Misses:  pc.misses,
+	}
+	pc.mu.Unlock()
+	return s
+}
+
+// Reset removes all the cached paths and resets pc statistics.
+func (pc *PathCache) Reset() {
+	pc.mu.Lock()
+	pc.lru.Init()
+	pc.items = make(map[string]*list.Element)
+	pc.hits = 0
+	pc.misses = 0
+	pc.mu.Unlock()
+}
+
+func (pc *PathCache) evictLocked() {
+	for pc.lru.Len() > 0 && pc.lru.Len() > pc.maxSize {
+		e := pc.lru.Back()
+		pc.lru.Remove(e)
+		delete(pc.items, e.Value.(*pathCacheEntry).path)
+	}
+}
@@ -0,0 +1,135 @@
+package fastjson
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestPathCache(t *testing.T) {
+	pc := NewPathCache(2)
+	root := MustParse(`{"a":1,"b":"x","c":[1,2]}`)
+
+	checkStats := func(sizeExpected int, hitsExpected, missesExpected uint64) {
+		t.Helper()
+		s := pc.Stats()
+		if s.Size != sizeExpected || s.Hits != hitsExpected || s.Misses != missesExpected {
+			t.Fatalf("unexpected stats; got %+v; want size=%d, hits=%d, misses=%d", s, sizeExpected, hitsExpected, missesExpected)
+		}
+	}
+
+	c1, err := pc.Compile("$.a")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	c2, err := pc.Compile("$.a")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if c1 != c2 {
+		t.Fatalf("expecting the cached path")
+	}
+	checkStats(1, 1, 1)
+
+	v, err := pc.Lookup(root, "$.b")
+	if err != nil || v.String() != `"x"` {
+		t.Fatalf("unexpected Lookup result: %s, %v", v, err)
+	}
+	checkStats(2, 1, 2)
+
+	// $.a is the least recently used path, so it must be evicted.
+	if !pc.Exists(root, "$.c[1]") {
+		t.Fatalf("expecting $.c[1] to exist")
+	}
+	checkStats(2, 1, 3)
+	if c, _ := pc.Compile("$.a"); c == c1 {
+		t.Fatalf("expecting $.a to be evicted")
+	}
+	checkStats(2, 1, 4)
+
+	raw, err := pc.LookupRaw(root, "$.a")
+	if err != nil || raw != float64(1) {
+		t.Fatalf("unexpected LookupRaw result: %v, %v", raw, err)
+	}
+	checkStats(2, 2, 4)
+
+	// Errors aren't cached.
+	for i := 0; i < 2; i++ {
+		if _, err := pc.Compile("a.b"); err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+	if pc.Exists(root, "a.b") {
+		t.Fatalf("invalid path cannot exist")
+	}
+	checkStats(2, 2, 7)
+
+	pc.SetMaxSize(1)
+	checkStats(1, 2, 7)
+	if s := pc.Stats(); s.MaxSize != 1 {
+		t.Fatalf("unexpected MaxSize; got %d; want 1", s.MaxSize)
+	}
+
+	pc.Reset()
+	checkStats(0, 0, 0)
+
+	pc.SetMaxSize(0)
+	for i := 0; i < 3; i++ {
+		if _, err := pc.Compile("$.a"); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	checkStats(0, 0, 3)
+}
+
+func TestPathCacheConcurrent(t *testing.T) {
+	pc := NewPathCache(8)
+	root := MustParse(`{"a":[0,1,2,3,4,5,6,7,8,9]}`)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				idx := (n + j) % 10
+				v, err := pc.Lookup(root, fmt.Sprintf("$.a[%d]", idx))
+				if err != nil {
+					t.Errorf("unexpected error: %s", err)
+					return
+				}
+				if n := v.GetInt(); n != idx {
+					t.Errorf("unexpected value; got %d; want %d", n, idx)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	s := pc.Stats()
+	if s.Size != 8 {
+		t.Fatalf("unexpected size; got %d; want 8", s.Size)
+	}
+	if s.Hits+s.Misses != 8000 {
+		t.Fatalf("unexpected number of calls; got %d; want 8000", s.Hits+s.Misses)
+	}
+}
+
+func TestDefaultPathCache(t *testing.T) {
+	root := MustParse(`{"a":{"b":2}}`)
+	before := DefaultPathCache().Stats()
+	for i := 0; i < 3; i++ {
+		v, err := JsonPathLookup(root, "$.a.b")
+		if err != nil || v.String() != "2" {
+			t.Fatalf("unexpected result: %s, %v", v, err)
+		}
+	}
+	after := DefaultPathCache().Stats()
+	if after.Hits-before.Hits < 2 {
+		t.Fatalf("expecting at least 2 cache hits; got %d", after.Hits-before.Hits)
+	}
+	if after.MaxSize != DefaultPathCacheSize {
+		t.Fatalf("unexpected MaxSize; got %d; want %d", after.MaxSize, DefaultPathCacheSize)
+	}
+}
@@ -0,0 +1,212 @@
+package fastjson
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// PathSyntaxError is returned by Compile and CompileRFC9535
+// for malformed JSONPath expressions.
+type PathSyntaxError struct {
+	// Path is the JSONPath expression, which failed to compile.
+	Path string
+
+	// Offset is the byte offset in Path where the error has been detected.
+	Offset int
+
+	// Token is the offending token found at Offset.
+	//
+	// Token is empty if the error has been detected at the end of Path.
+	Token string
+
+	// Expected describes what has been expected at Offset instead of Token.
+	//
+	// Expected is empty if the error isn't caused by unexpected Token.
+	// Msg describes the error in this case.
+	Expected string
+
+	// Msg describes the error if Expected is empty.
+	Msg string
+}
+
+// Error implements error interface.
+func (e *PathSyntaxError) Error() string {
+	return fmt.Sprintf("cannot compile JSONPath %q at offset %d: %s", e.Path, e.Offset, e.message())
+}
+
+func (e *PathSyntaxError) message() string {
+	if len(e.Expected) == 0 {
+		return e.Msg
+	}
+	found := "end of path"
+	if len(e.Token) > 0 {
+		found = strconv.Quote(e.Token)
+	}
+	return fmt.Sprintf("expecting %s, found %s", e.Expected, found)
+}
+
+// Caret returns Path with a caret pointing to the error location
+// on the next line followed by the error message, i.e.
+//
+//	$.store.book[?(@.price <> 10)]
+//	                       ^ expecting comparison operator, found "<>"
+//
+// Control chars in Path are replaced by spaces, so the caret position
+// is correct for single-line monospace rendering.
+func (e *PathSyntaxError) Caret() string {
+	var b strings.Builder
+	for _, r := range e.Path {
+		if r < 0x20 {
+			r = ' '
+		}
+		b.WriteRune(r)
+	}
+	b.WriteByte('\n')
+
+	offset := e.Offset
+	if offset > len(e.Path) {
+		offset = len(e.Path)
+	}
+	b.WriteString(strings.Repeat(" ", utf8.RuneCountInString(e.Path[:offset])))
+	b.WriteString("^ ")
+	b.WriteString(e.message())
+	return b.String()
+}
+
+func newPathSyntaxError(path string, offset int, expected, msg string) *PathSyntaxError {
+	return &PathSyntaxError{
+		Path:     path,
+		Offset:   offset,
+		Token:    syntaxToken(path, offset),
+		Expected: expected,
+		Msg:      msg,
+	}
+}
+
+// toPathSyntaxError converts err detected at the given offset in path
+// to PathSyntaxError.
+//
+// If err is already PathSyntaxError for a part of path, which starts
+// at the given offset, then its location is translated to path.
+func toPathSyntaxError(path string, offset int, err error) *PathSyntaxError {
+	if se, ok := err.(*PathSyntaxError); ok {
+		return newPathSyntaxError(path, offset+se.Offset, se.Expected, se.Msg)
+	}
+	return newPathSyntaxError(path, offset, "", err.Error())
+}
+
+// syntaxToken returns the token starting at the given offset in s.
+func syntaxToken(s string, offset int) string {
+	if offset < 0 || offset >= len(s) {
+		return ""
+	}
+	tail := s[offset:]
+	c := tail[0]
+	n := 0
+	switch {
+	case c == '\'' || c == '"':
+		n = 1
+		for n < len(tail) && tail[n] != c {
+			if tail[n] == '\\' {
+				n++
+			}
+			n++
+		}
+		n++
+	case (c >= '0' && c <= '9') || (c == '-' && len(tail) > 1 && tail[1] >= '0' && tail[1] <= '9'):
+		n = 1
+		for n < len(tail) && strings.IndexByte("0123456789.eE+-", tail[n]) >= 0 {
+			n++
+		}
+	case isFunctionNameChar(c) || c >= utf8.RuneSelf:
+		for n < len(tail) && (isFunctionNameChar(tail[n]) || tail[n] >= utf8.RuneSelf) {
+			n++
+		}
+	case strings.HasPrefix(tail, "$$"):
+		n = 2
+		for n < len(tail) && isVarNameChar(tail[n]) {
+			n++
+		}
+	case isFilterOpChar(c):
+		// Report the whole run of operator chars such as "<>" or "=<".
+		n = 1
+		for n < len(tail) && isFilterOpChar(tail[n]) {
+			n++
+		}
+	default:
+		for _, op := range []string{"&&", "||", ".."} {
+			if strings.HasPrefix(tail, op) {
+				return op
+			}
+		}
+		_, n = utf8.DecodeRuneInString(tail)
+	}
+	if n > len(tail) {
+		n = len(tail)
+	}
+	return tail[:n]
+}
+
+var (
+	// ErrPathNotFound is returned when JSONPath doesn't match any value.
+	//
+	// Errors returned for missing object keys and out of range array indexes
+	// wrap ErrPathNotFound, so they may be checked with errors.Is.
+	ErrPathNotFound = errors.New("path not found")
+
+	// ErrTypeMismatch is returned when the value matched by JSONPath
+	// has unexpected type.
+	//
+	// Errors returned for selecting keys in non-objects and indexes in non-arrays
+	// wrap ErrTypeMismatch, so they may be checked with errors.Is.
+	ErrTypeMismatch = errors.New("type mismatch")
+
+	// ErrNullValue is returned by the typed lookups such as LookupString
+	// when the value matched by JSONPath is null.
+	//
+	// It is distinct from ErrTypeMismatch, so explicit nulls may be told apart
+	// from values of unexpected type.
+	ErrNullValue = errors.New("null value")
+)
+
+// lookupError is an error detected during JSONPath evaluation.
+//
+// It keeps the detailed message, while errors.Is reports the kind of the error.
+type lookupError struct {
+	msg  string
+	kind error
+}
+
+// Error implements error interface.
+func (e *lookupError) Error() string {
+	return e.msg
+}
+
+// Unwrap returns ErrPathNotFound, ErrTypeMismatch or ErrNullValue.
+func (e *lookupError) Unwrap() error {
+	return e.kind
+}
+
+func notFoundErrorf(format string, args ...interface{}) error {
+	return &lookupError{
+		msg:  fmt.Sprintf(format, args...),
+		kind: ErrPathNotFound,
+	}
+}
+
+func typeMismatchErrorf(format string, args ...interface{}) error {
+	return &lookupError{
+		msg:  fmt.Sprintf(format, args...),
+		kind: ErrTypeMismatch,
+	}
+}
+
+func nullValueErrorf(format string, args ...interface{}) error {
+	return &lookupError{
+		msg:  fmt.Sprintf(format, args...),
+		kind: ErrNullValue,
+	}
+}
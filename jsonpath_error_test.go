@@ -0,0 +1,95 @@
+package fastjson
+
+import (
+	"testing"
+)
+
+func TestPathSyntaxError(t *testing.T) {
+	f := func(compile func(string) (*Compiled, error), path string, offsetExpected int, tokenExpected, messageExpected string) {
+		t.Helper()
+		_, err := compile(path)
+		if err == nil {
+			t.Fatalf("expecting non-nil error for %q", path)
+		}
+		se, ok := err.(*PathSyntaxError)
+		if !ok {
+			t.Fatalf("unexpected error type for %q: %T: %s", path, err, err)
+		}
+		if se.Path != path {
+			t.Fatalf("unexpected Path; got %q; want %q", se.Path, path)
+		}
+		if se.Offset != offsetExpected {
+			t.Fatalf("unexpected Offset for %q; got %d; want %d; err: %s", path, se.Offset, offsetExpected, se)
+		}
+		if se.Token != tokenExpected {
+			t.Fatalf("unexpected Token for %q; got %q; want %q", path, se.Token, tokenExpected)
+		}
+		if msg := se.message(); msg != messageExpected {
+			t.Fatalf("unexpected message for %q; got %q; want %q", path, msg, messageExpected)
+		}
+	}
+
+	// legacy syntax
+	f(Compile, ``, 0, ``, `expecting '$' or '@', found end of path`)
+	f(Compile, `store.book`, 0, `store`, `expecting '$' or '@', found "store"`)
+	f(Compile, `$.a[?(@.b > 1 &&)]`, 16, `)`, `expecting operand, found ")"`)
+	f(Compile, `$.a[?(@.b > 1 || !)]`, 18, `)`, `expecting operand, found ")"`)
+	f(Compile, `$.a[?(@.b ==)]`, 12, `)`, `expecting right operand, found ")"`)
+	f(Compile, `$.a[?(@.b > && @.c)]`, 12, `&&`, `expecting right operand, found "&&"`)
+	f(Compile, `$.a[?(..b)]`, 6, `..`, `expecting '@', '$' or member name, found ".."`)
+	f(Compile, `$.a[?(..b == 1)]`, 6, `..`, `expecting '@', '$' or member name, found ".."`)
+	f(Compile, `$.a[?(@.b <> 1)]`, 10, `<>`, `expecting comparison operator, found "<>"`)
+	f(Compile, `$.a[?(@.b =< 1)]`, 10, `=<`, `expecting comparison operator, found "=<"`)
+	f(Compile, `$.a[?(@.b in 'x')]`, 13, `'x'`, `expecting array as right operand of in, found "'x'"`)
+	f(Compile, `$.a[?(@.b size 'x')]`, 15, `'x'`, `expecting number as right operand of size, found "'x'"`)
+	f(Compile, `$.a[?(@.b =~ /(/)]`, 13, `/`, "error parsing regexp: missing closing ): `(`")
+	f(Compile, `$.a[?(@.b && $$flag)]`, 13, `$$flag`, `$$flag must be compared`)
+	f(Compile, `$.a[x]`, 4, `x`, `expecting integer index, found "x"`)
+	f(Compile, `$.a[0, x]`, 7, `x`, `expecting integer index, found "x"`)
+	f(Compile, `$.a[1:x]`, 6, `x`, `expecting integer, found "x"`)
+	f(Compile, `$.a[1:2:3:4]`, 9, `:`, `expecting ']', found ":"`)
+	f(Compile, `$.a[?(@.b[x] == 1)]`, 10, `x`, `expecting integer index, found "x"`)
+	f(Compile, `$.a[?(@.b == length(@.c, 1))]`, 25, `1`, `too many arguments for length()`)
+	f(Compile, `$.a['b\x']`, 6, `\`, `invalid escape sequence \x`)
+	f(Compile, `$.a.b[1:2:0]`, 10, `0`, `expecting non-zero range step, found "0"`)
+
+	// RFC 9535 syntax
+	f(CompileRFC9535, `$.a[`, 4, ``, `expecting selector, found end of path`)
+	f(CompileRFC9535, `$.a[?@.b <> 1]`, 10, `>`, `expecting filter expression, found ">"`)
+	f(CompileRFC9535, `$[?length(@.a, 1)]`, 15, `1`, `too many arguments for length()`)
+}
+
+func TestPathSyntaxErrorCaret(t *testing.T) {
+	f := func(compile func(string) (*Compiled, error), path, caretExpected string) {
+		t.Helper()
+		_, err := compile(path)
+		se, ok := err.(*PathSyntaxError)
+		if !ok {
+			t.Fatalf("unexpected error for %q: %v", path, err)
+		}
+		if caret := se.Caret(); caret != caretExpected {
+			t.Fatalf("unexpected Caret for %q;\ngot\n%s\nwant\n%s", path, caret, caretExpected)
+		}
+	}
+
+	f(Compile, `$.a[?(@.b > 1 &&)]`, "$.a[?(@.b > 1 &&)]\n"+
+		"                ^ expecting operand, found \")\"")
+	f(Compile, `$.店[?(@.b > 1 &&)]`, "$.店[?(@.b > 1 &&)]\n"+
+		"                ^ expecting operand, found \")\"")
+	f(Compile, `$.store.book[?(@.price <> 10)]`, "$.store.book[?(@.price <> 10)]\n"+
+		"                       ^ expecting comparison operator, found \"<>\"")
+	f(CompileRFC9535, "$[?@.a ==\n]", "$[?@.a == ]\n"+
+		"          ^ expecting filter expression, found \"]\"")
+}
+
+func TestPathSyntaxErrorString(t *testing.T) {
+	_, err := CompileRFC9535(`$.a[`)
+	if err == nil {
+		t.Fatalf("expecting non-nil error")
+	}
+	s := err.Error()
+	sExpected := `cannot compile JSONPath "$.a[" at offset 4: expecting selector, found end of path`
+	if s != sExpected {
+		t.Fatalf("unexpected error string; got %q; want %q", s, sExpected)
+	}
+}
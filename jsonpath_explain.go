@@ -0,0 +1,678 @@
+package fastjson
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// maxTraceRejections is the maximum number of rejections recorded per step
+// by Compiled.LookupTrace.
+const maxTraceRejections = 100
+
+// Trace describes how Compiled.LookupTrace evaluated the path.
+type Trace struct {
+	// Steps contains the evaluated steps in evaluation order.
+	//
+	// The evaluation stops at the step, which returned an error
+	// or which selected nothing on a non-wildcard path.
+	Steps []TraceStep
+
+	// Err is the error, which stopped the evaluation.
+	Err error
+}
+
+// TraceStep describes the evaluation of a single step.
+type TraceStep struct {
+	// Step is the human-readable description of the step.
+	Step string
+
+	// In is the number of nodes the step was applied to.
+	In int
+
+	// Out is the number of nodes selected by the step.
+	Out int
+
+	// Rejected contains up to 100 candidates rejected by the step filters.
+	Rejected []TraceRejection
+
+	// TotalRejected is the total number of candidates rejected by the step filters.
+	TotalRejected int
+}
+
+// TraceRejection describes a node rejected by a filter.
+type TraceRejection struct {
+	// Path is the RFC 9535 normalized path of the node.
+	Path string
+
+	// Reason explains why the filter is false for the node.
+	Reason string
+}
+
+// String returns human-readable multi-line representation of t.
+func (t *Trace) String() string {
+	var b strings.Builder
+	for i, s := range t.Steps {
+		fmt.Fprintf(&b, "%d: %s: %d in, %d out", i+1, s.Step, s.In, s.Out)
+		if s.TotalRejected > 0 {
+			fmt.Fprintf(&b, ", %d rejected", s.TotalRejected)
+		}
+		b.WriteByte('\n')
+		for _, r := range s.Rejected {
+			fmt.Fprintf(&b, "     %s: %s\n", r.Path, r.Reason)
+		}
+		if n := s.TotalRejected - len(s.Rejected); n > 0 {
+			fmt.Fprintf(&b, "     ... and %d more\n", n)
+		}
+	}
+	if t.Err != nil {
+		fmt.Fprintf(&b, "error: %s\n", t.Err)
+	}
+	return b.String()
+}
+
+func (s *TraceStep) reject(n node, reason string) {
+	s.TotalRejected++
+	if len(s.Rejected) < maxTraceRejections {
+		s.Rejected = append(s.Rejected, TraceRejection{
+			Path:   normalizedPath(n.loc.path()),
+			Reason: reason,
+		})
+	}
+}
+
+// Explain returns human-readable multi-line description of the compiled steps.
+//
+// Every step is printed on a separate line. Filters are followed
+// by their syntax trees, which show how operands are interpreted,
+// i.e. whether they are fields, constants, function calls or arithmetic expressions.
+func (c *Compiled) Explain() string {
+	var b strings.Builder
+	b.WriteString(c.path)
+	b.WriteByte('\n')
+	if c.query != nil {
+		for i := range c.query.segments {
+			seg := &c.query.segments[i]
+			fmt.Fprintf(&b, "%d: %s\n", i+1, describeSegment(seg))
+			for j := range seg.selectors {
+				if sel := &seg.selectors[j]; sel.kind == selectorFilter {
+					explainRFCFilter(&b, sel.filter, 2)
+				}
+			}
+		}
+		return b.String()
+	}
+	for i, s := range c.steps {
+		fmt.Fprintf(&b, "%d: %s\n", i+1, describeStep(s))
+		if s.op == "filter" {
+			g := s.args.(*FilterTupleGroup)
+			explainFilter(&b, g, g.expr, 2)
+		}
+	}
+	return b.String()
+}
+
+// LookupTrace is like Lookup, but it also returns the trace describing
+// the evaluation of every step.
+//
+// The trace contains the number of nodes each step was applied to
+// and the number of nodes it selected together with the reasons filters
+// rejected candidates for. It is intended for debugging paths returning
+// unexpected results, since it is much slower than Lookup.
+func (c *Compiled) LookupTrace(root *Value) (*Value, *Trace, error) {
+	var t Trace
+	if c.query != nil {
+		nodes := []node{{v: root}}
+		for i := range c.query.segments {
+			nodes = traceSegment(&t, &c.query.segments[i], nodes, root)
+		}
+		return nodeValues(nodes), &t, nil
+	}
+
+	nodes := []node{{v: root}}
+	multi := false
+	for _, steps := range traceSteps(c.steps) {
+		ts := TraceStep{
+			Step: describeSteps(steps),
+			In:   len(nodes),
+		}
+		if s := steps[len(steps)-1]; s.op == "filter" {
+			traceFilter(&ts, steps, nodes, root, multi)
+		}
+		ns, m, err := lookup_steps(steps, nodes, root, multi, true, nil)
+		ts.Out = len(ns)
+		t.Steps = append(t.Steps, ts)
+		if err != nil {
+			t.Err = err
+			return nil, &t, err
+		}
+		nodes, multi = ns, m
+		if !multi && len(nodes) == 0 {
+			return nil, &t, nil
+		}
+	}
+	if multi {
+		return nodeValues(nodes), &t, nil
+	}
+	return nodes[0].v, &t, nil
+}
+
+// traceSteps groups steps the way they are traced.
+//
+// Steps with both key and op are split into key and op steps,
+// while `..` is grouped with the next step, since it is evaluated together with it.
+func traceSteps(steps []step) [][]step {
+	var res [][]step
+	for i := 0; i < len(steps); i++ {
+		s := steps[i]
+		switch {
+		case s.op == "scan":
+			k := i + 2
+			if k > len(steps) {
+				k = len(steps)
+			}
+			res = append(res, steps[i:k])
+			i = k - 1
+		case len(s.key) == 0 || s.op == "key" && s.args == nil:
+			res = append(res, steps[i:i+1])
+		default:
+			res = append(res, []step{{op: "key", key: s.key}}, []step{{op: s.op, args: s.args}})
+		}
+	}
+	return res
+}
+
+// traceFilter records the candidates rejected by the filter ending steps.
+func traceFilter(ts *TraceStep, steps []step, nodes []node, root *Value, multi bool) {
+	s := steps[len(steps)-1]
+	g := s.args.(*FilterTupleGroup)
+	scan := len(steps) > 1
+	if scan {
+		var all []node
+		for _, n := range nodes {
+			all = walk_descendants(all, n, true, nil)
+		}
+		nodes = all
+		if len(s.key) > 0 {
+			var selected []node
+			for _, n := range nodes {
+				ns, _, _ := select_key(n, s.key, false, true, true)
+				selected = append(selected, ns...)
+			}
+			nodes = selected
+		}
+	}
+
+	for _, n := range nodes {
+		candidates := []node{n}
+		switch {
+		case n.v.t == TypeArray, scan && n.v.t == TypeObject:
+			candidates = children(n, true)
+		case n.v.t != TypeObject:
+			if !multi {
+				// The filter fails with an error, which is recorded in the trace.
+				return
+			}
+			continue
+		}
+		for _, x := range candidates {
+			ok, err := eval_filter_group(x.v, root, g, nil)
+			if err != nil {
+				return
+			}
+			if !ok {
+				ts.reject(x, filterRejection(x.v, root, g, g.expr))
+			}
+		}
+	}
+}
+
+func traceSegment(t *Trace, seg *rfcSegment, nodes []node, root *Value) []node {
+	ts := TraceStep{
+		Step: describeSegment(seg),
+		In:   len(nodes),
+	}
+	for i := range seg.selectors {
+		sel := &seg.selectors[i]
+		if sel.kind != selectorFilter {
+			continue
+		}
+		for _, n := range nodes {
+			ds := []node{n}
+			if seg.descendant {
+				ds = walk_descendants(nil, n, true, nil)
+			}
+			for _, d := range ds {
+				for _, x := range children(d, true) {
+					if !sel.filter.evalLogical(root, x.v, nil) {
+						ts.reject(x, rfcRejection(sel.filter, root, x.v))
+					}
+				}
+			}
+		}
+	}
+	nodes = seg.selectNodes(nodes, root, true, nil)
+	ts.Out = len(nodes)
+	t.Steps = append(t.Steps, ts)
+	return nodes
+}
+
+// describeSteps returns the description of steps returned by traceSteps.
+func describeSteps(steps []step) string {
+	a := make([]string, len(steps))
+	for i, s := range steps {
+		a[i] = describeStep(s)
+	}
+	return strings.Join(a, ", then ")
+}
+
+func describeStep(s step) string {
+	var a []string
+	if len(s.key) > 0 && s.op != "scan" {
+		a = append(a, "key "+quoteName(s.key))
+	}
+	switch s.op {
+	case "scan":
+		a = append(a, "descendants ..")
+	case "key":
+		if keys, ok := s.args.([]string); ok {
+			qs := make([]string, len(keys))
+			for i, k := range keys {
+				qs[i] = quoteName(k)
+			}
+			a = append(a, "keys ["+strings.Join(qs, ", ")+"]")
+		}
+	case "idx":
+		idxs := s.args.([]int)
+		qs := make([]string, len(idxs))
+		for i, idx := range idxs {
+			qs[i] = strconv.Itoa(idx)
+		}
+		if len(idxs) == 1 {
+			a = append(a, "index "+qs[0])
+		} else {
+			a = append(a, "indexes ["+strings.Join(qs, ", ")+"]")
+		}
+	case "range":
+		var bounds []interface{}
+		switch args := s.args.(type) {
+		case [2]interface{}:
+			bounds = args[:]
+		case [3]interface{}:
+			bounds = args[:]
+		}
+		qs := make([]string, len(bounds))
+		wildcard := true
+		for i, x := range bounds {
+			if x != nil {
+				qs[i] = strconv.Itoa(x.(int))
+				wildcard = false
+			}
+		}
+		if wildcard {
+			a = append(a, "wildcard [*]")
+		} else {
+			a = append(a, "slice ["+strings.Join(qs, ":")+"]")
+		}
+	case "filter":
+		g := s.args.(*FilterTupleGroup)
+		a = append(a, "filter [?("+filterString(g, g.expr)+")]")
+	}
+	return strings.Join(a, ", then ")
+}
+
+func quoteName(s string) string {
+	var b strings.Builder
+	b.WriteByte('\'')
+	writeNormalizedName(&b, s)
+	b.WriteByte('\'')
+	return b.String()
+}
+
+// filterString returns the text of the filter expression.
+func filterString(g *FilterTupleGroup, x *filterExpr) string {
+	switch x.logic {
+	case "":
+		return tupleString(g.tuples[x.tuple])
+	case "!":
+		return "!(" + filterString(g, x.args[0]) + ")"
+	default:
+		a := make([]string, len(x.args))
+		for i, arg := range x.args {
+			a[i] = filterString(g, arg)
+			if arg.logic == "||" || arg.logic == "&&" && x.logic != "&&" {
+				a[i] = "(" + a[i] + ")"
+			}
+		}
+		return strings.Join(a, " "+x.logic+" ")
+	}
+}
+
+func tupleString(t FilterTuple) string {
+	switch t.op {
+	case "exists":
+		return paramString(t.lp)
+	case "=~":
+		return paramString(t.lp) + " =~ " + t.rp.p
+	default:
+		return paramString(t.lp) + " " + t.op + " " + paramString(t.rp)
+	}
+}
+
+func paramString(p Param) string {
+	if p.quoted {
+		return "'" + p.p + "'"
+	}
+	return p.p
+}
+
+// explainFilter writes the syntax tree of the filter expression x to b.
+func explainFilter(b *strings.Builder, g *FilterTupleGroup, x *filterExpr, depth int) {
+	indent := strings.Repeat("  ", depth)
+	if x.logic != "" {
+		fmt.Fprintf(b, "%s%s\n", indent, x.logic)
+		for _, arg := range x.args {
+			explainFilter(b, g, arg, depth+1)
+		}
+		return
+	}
+	t := g.tuples[x.tuple]
+	switch t.op {
+	case "exists":
+		if t.lp.fn != nil {
+			fmt.Fprintf(b, "%stest %s\n", indent, describeParam(t.lp))
+		} else {
+			fmt.Fprintf(b, "%sexists %s\n", indent, describeParam(t.lp))
+		}
+	case "=~":
+		fmt.Fprintf(b, "%smatch %s =~ regexp %s\n", indent, describeParam(t.lp), t.rp.p)
+	default:
+		fmt.Fprintf(b, "%scompare %s %s %s\n", indent, describeParam(t.lp), t.op, describeParam(t.rp))
+	}
+}
+
+// describeParam describes how the filter operand p is evaluated.
+func describeParam(p Param) string {
+	switch {
+	case p.name != "":
+		if p.v != nil {
+			return "variable $$" + p.name + " = " + startEndString(p.v.String())
+		}
+		return "variable $$" + p.name
+	case p.arith != nil:
+		return "arithmetic " + p.arith.String()
+	case p.fn != nil:
+		return "function " + p.p
+	case p.fromRoot:
+		return "root field " + p.p
+	case p.isField:
+		return "field " + p.p
+	case p.v != nil:
+		return "constant " + startEndString(p.v.String())
+	default:
+		return "constant " + paramString(p)
+	}
+}
+
+// String returns x with every binary operation enclosed in parentheses,
+// so the evaluation order is clear.
+func (x *arithExpr) String() string {
+	if x.op == 0 {
+		return paramString(x.p)
+	}
+	return "(" + x.x.String() + " " + string(x.op) + " " + x.y.String() + ")"
+}
+
+// filterRejection returns the reason the filter expression x is false for obj.
+func filterRejection(obj, root *Value, g *FilterTupleGroup, x *filterExpr) string {
+	switch x.logic {
+	case "":
+		return tupleRejection(obj, root, g.tuples[x.tuple])
+	case "!":
+		return filterString(g, x) + " is false, since " + filterString(g, x.args[0]) + " is true"
+	case "&&":
+		for _, arg := range x.args {
+			if ok, _ := eval_filter_expr(obj, root, g, arg, nil); !ok {
+				return filterRejection(obj, root, g, arg)
+			}
+		}
+	case "||":
+		a := make([]string, len(x.args))
+		for i, arg := range x.args {
+			a[i] = filterRejection(obj, root, g, arg)
+		}
+		return strings.Join(a, "; ")
+	}
+	return filterString(g, x) + " is false"
+}
+
+func tupleRejection(obj, root *Value, t FilterTuple) string {
+	text := tupleString(t)
+	// Lookup errors mean the operand is missing, like in eval_filter.
+	lv, err := get_lp_v(obj, root, t.lp, nil)
+	if isUnboundVar(err) {
+		return text + ": " + err.Error()
+	}
+	switch t.op {
+	case "exists":
+		if t.lp.fn != nil {
+			return text + " is false"
+		}
+		return paramString(t.lp) + " is missing"
+	case "=~":
+		if lv == nil {
+			return paramString(t.lp) + " is missing"
+		}
+		if lv.Type() != TypeString {
+			return fmt.Sprintf("%s is %s, not a string", paramString(t.lp), lv.Type())
+		}
+		return fmt.Sprintf("%s = %s doesn't match %s", paramString(t.lp), startEndString(lv.String()), t.rp.p)
+	}
+	rv, err := get_rp_v(obj, root, t.rp, nil)
+	if isUnboundVar(err) {
+		return text + ": " + err.Error()
+	}
+	if lv == nil {
+		return paramString(t.lp) + " is missing"
+	}
+	if rv == nil {
+		return paramString(t.rp) + " is missing"
+	}
+	return fmt.Sprintf("%s is false for %s %s %s", text, startEndString(lv.String()), t.op, startEndString(rv.String()))
+}
+
+// describeSegment returns the description of the RFC 9535 segment.
+func describeSegment(seg *rfcSegment) string {
+	a := make([]string, len(seg.selectors))
+	for i := range seg.selectors {
+		a[i] = describeSelector(&seg.selectors[i])
+	}
+	kind := "child"
+	if seg.descendant {
+		kind = "descendant"
+	}
+	return kind + " segment [" + strings.Join(a, ", ") + "]"
+}
+
+func describeSelector(sel *rfcSelector) string {
+	switch sel.kind {
+	case selectorName:
+		return "name " + quoteName(sel.name)
+	case selectorWildcard:
+		return "wildcard *"
+	case selectorIndex:
+		return "index " + strconv.Itoa(sel.index)
+	case selectorSlice:
+		return "slice " + sel.slice.String()
+	default:
+		return "filter ?" + rfcExprString(sel.filter)
+	}
+}
+
+func (b *sliceBounds) String() string {
+	var s strings.Builder
+	if b.hasStart {
+		s.WriteString(strconv.Itoa(b.start))
+	}
+	s.WriteByte(':')
+	if b.hasEnd {
+		s.WriteString(strconv.Itoa(b.end))
+	}
+	if b.hasStep {
+		s.WriteByte(':')
+		s.WriteString(strconv.Itoa(b.step))
+	}
+	return s.String()
+}
+
+// String returns q in the bracket notation.
+func (q *rfcQuery) String() string {
+	var b strings.Builder
+	if q.relative {
+		b.WriteByte('@')
+	} else {
+		b.WriteByte('$')
+	}
+	for i := range q.segments {
+		seg := &q.segments[i]
+		if seg.descendant {
+			b.WriteString("..")
+		}
+		b.WriteByte('[')
+		for j := range seg.selectors {
+			if j > 0 {
+				b.WriteByte(',')
+			}
+			sel := &seg.selectors[j]
+			switch sel.kind {
+			case selectorName:
+				b.WriteString(quoteName(sel.name))
+			case selectorWildcard:
+				b.WriteByte('*')
+			case selectorIndex:
+				b.WriteString(strconv.Itoa(sel.index))
+			case selectorSlice:
+				b.WriteString(sel.slice.String())
+			default:
+				b.WriteString("?" + rfcExprString(sel.filter))
+			}
+		}
+		b.WriteByte(']')
+	}
+	return b.String()
+}
+
+// rfcExprString returns the text of the RFC 9535 filter expression
+// or function argument x.
+func rfcExprString(x interface{}) string {
+	switch x := x.(type) {
+	case orExpr:
+		return rfcJoin(x, " || ", func(arg logicalExpr) bool {
+			return false
+		})
+	case andExpr:
+		return rfcJoin(x, " && ", func(arg logicalExpr) bool {
+			_, ok := arg.(orExpr)
+			return ok
+		})
+	case notExpr:
+		return "!(" + rfcExprString(x.x) + ")"
+	case *comparisonExpr:
+		return rfcExprString(x.left) + " " + x.op + " " + rfcExprString(x.right)
+	case literalExpr:
+		return x.v.String()
+	case queryExpr:
+		return x.q.String()
+	case *funcExpr:
+		a := make([]string, len(x.args))
+		for i, arg := range x.args {
+			a[i] = rfcExprString(arg)
+		}
+		return x.name + "(" + strings.Join(a, ", ") + ")"
+	default:
+		return fmt.Sprintf("%v", x)
+	}
+}
+
+func rfcJoin(args []logicalExpr, sep string, parens func(arg logicalExpr) bool) string {
+	a := make([]string, len(args))
+	for i, arg := range args {
+		a[i] = rfcExprString(arg)
+		if parens(arg) {
+			a[i] = "(" + a[i] + ")"
+		}
+	}
+	return strings.Join(a, sep)
+}
+
+// explainRFCFilter writes the syntax tree of the RFC 9535 filter expression x to b.
+func explainRFCFilter(b *strings.Builder, x logicalExpr, depth int) {
+	indent := strings.Repeat("  ", depth)
+	var args []logicalExpr
+	switch x := x.(type) {
+	case orExpr:
+		fmt.Fprintf(b, "%s||\n", indent)
+		args = x
+	case andExpr:
+		fmt.Fprintf(b, "%s&&\n", indent)
+		args = x
+	case notExpr:
+		fmt.Fprintf(b, "%s!\n", indent)
+		args = []logicalExpr{x.x}
+	case *comparisonExpr:
+		fmt.Fprintf(b, "%scompare %s %s %s\n", indent, describeRFCValue(x.left), x.op, describeRFCValue(x.right))
+	case queryExpr:
+		fmt.Fprintf(b, "%sexists query %s\n", indent, x.q)
+	case *funcExpr:
+		fmt.Fprintf(b, "%stest function %s\n", indent, rfcExprString(x))
+	}
+	for _, arg := range args {
+		explainRFCFilter(b, arg, depth+1)
+	}
+}
+
+func describeRFCValue(x valueExpr) string {
+	switch x := x.(type) {
+	case literalExpr:
+		return "constant " + startEndString(x.v.String())
+	case queryExpr:
+		return "query " + x.q.String()
+	case *funcExpr:
+		return "function " + rfcExprString(x)
+	default:
+		return rfcExprString(x)
+	}
+}
+
+// rfcRejection returns the reason the RFC 9535 filter expression x is false for cur.
+func rfcRejection(x logicalExpr, root, cur *Value) string {
+	switch x := x.(type) {
+	case orExpr:
+		a := make([]string, len(x))
+		for i, arg := range x {
+			a[i] = rfcRejection(arg, root, cur)
+		}
+		return strings.Join(a, "; ")
+	case andExpr:
+		for _, arg := range x {
+			if !arg.evalLogical(root, cur, nil) {
+				return rfcRejection(arg, root, cur)
+			}
+		}
+	case notExpr:
+		return rfcExprString(x) + " is false, since " + rfcExprString(x.x) + " is true"
+	case *comparisonExpr:
+		lv, rv := x.left.evalValue(root, cur, nil), x.right.evalValue(root, cur, nil)
+		return fmt.Sprintf("%s is false for %s %s %s", rfcExprString(x), rfcValueString(lv), x.op, rfcValueString(rv))
+	case queryExpr:
+		return x.q.String() + " selects nothing"
+	}
+	return rfcExprString(x) + " is false"
+}
+
+func rfcValueString(v *Value) string {
+	if v == nil {
+		return "Nothing"
+	}
+	return startEndString(v.String())
+}
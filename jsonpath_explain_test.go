@@ -0,0 +1,216 @@
+package fastjson
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompiledExplain(t *testing.T) {
+	f := func(c *Compiled, linesExpected ...string) {
+		t.Helper()
+		s := c.Explain()
+		sExpected := strings.Join(linesExpected, "\n") + "\n"
+		if s != sExpected {
+			t.Fatalf("unexpected explanation for %s;\ngot\n%s\nwant\n%s", c, s, sExpected)
+		}
+	}
+
+	f(MustCompile(`$`), `$`)
+	f(MustCompile(`$.store['book','x'][0,1][1:][*]..price[-1]`),
+		`$.store['book','x'][0,1][1:][*]..price[-1]`,
+		`1: key 'store', then keys ['book', 'x']`,
+		`2: indexes [0, 1]`,
+		`3: slice [1:]`,
+		`4: wildcard [*]`,
+		`5: descendants ..`,
+		`6: key 'price', then index -1`)
+	f(MustCompile(`$.book[?(@.price < 10 && @.isbn || !(@.title =~ /^b/i))]`),
+		`$.book[?(@.price < 10 && @.isbn || !(@.title =~ /^b/i))]`,
+		`1: key 'book', then filter [?((@.price < 10 && @.isbn) || !(@.title =~ /^b/i))]`,
+		`    ||`,
+		`      &&`,
+		`        compare field @.price < constant 10`,
+		`        exists field @.isbn`,
+		`      !`,
+		`        match field @.title =~ regexp /^b/i`)
+	f(MustCompile(`$[?(@.price * (@.qty + 1) > $.limit && length(@.tags) == 2 && @.kind in ['a', "b"] && @.id == $$id)]`),
+		`$[?(@.price * (@.qty + 1) > $.limit && length(@.tags) == 2 && @.kind in ['a', "b"] && @.id == $$id)]`,
+		`1: filter [?(@.price * (@.qty + 1) > $.limit && length(@.tags) == 2 && @.kind in ['a', "b"] && @.id == $$id)]`,
+		`    &&`,
+		`      compare arithmetic (@.price * (@.qty + 1)) > root field $.limit`,
+		`      compare function length(@.tags) == constant 2`,
+		`      compare field @.kind in constant ["a","b"]`,
+		`      compare field @.id == variable $$id`)
+
+	f(MustCompileRFC9535(`$.store..[?@.price < 10 && (@.isbn || !match(@.title, 'b'))][0:2]`),
+		`$.store..[?@.price < 10 && (@.isbn || !match(@.title, 'b'))][0:2]`,
+		`1: child segment [name 'store']`,
+		`2: descendant segment [filter ?@['price'] < 10 && (@['isbn'] || !(match(@['title'], "b")))]`,
+		`    &&`,
+		`      compare query @['price'] < constant 10`,
+		`      ||`,
+		`        exists query @['isbn']`,
+		`        !`,
+		`          test function match(@['title'], "b")`,
+		`3: child segment [slice 0:2]`)
+	f(MustCompileRFC9535(`$[*, 1, ::-1, 'a']`),
+		`$[*, 1, ::-1, 'a']`,
+		`1: child segment [wildcard *, index 1, slice ::-1, name 'a']`)
+}
+
+func TestCompiledExplainBound(t *testing.T) {
+	c, err := MustCompile(`$[?(@.id == $$id)]`).Bind(Vars{"id": 42})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	s := c.Explain()
+	if !strings.Contains(s, "compare field @.id == variable $$id = 42\n") {
+		t.Fatalf("unexpected explanation:\n%s", s)
+	}
+}
+
+func TestCompiledLookupTrace(t *testing.T) {
+	root := MustParse(`{"store":{"book":[{"title":"a","price":8,"isbn":"x"},{"title":"b","price":22},{"title":"c","price":5}],"bicycle":{"price":399}}}`)
+
+	f := func(c *Compiled, stepsExpected []TraceStep) {
+		t.Helper()
+		v, tr, err := c.LookupTrace(root)
+		vExpected, errExpected := c.Lookup(root)
+		if !reflect.DeepEqual(err, errExpected) {
+			t.Fatalf("unexpected error for %s; got %v; want %v", c, err, errExpected)
+		}
+		if !reflect.DeepEqual(tr.Err, errExpected) {
+			t.Fatalf("unexpected trace error for %s; got %v; want %v", c, tr.Err, errExpected)
+		}
+		if (v == nil) != (vExpected == nil) || v != nil && v.String() != vExpected.String() {
+			t.Fatalf("unexpected value for %s; got %s; want %s", c, v, vExpected)
+		}
+		if !reflect.DeepEqual(tr.Steps, stepsExpected) {
+			t.Fatalf("unexpected trace for %s;\ngot\n%s\nwant\n%s", c, tr, &Trace{Steps: stepsExpected})
+		}
+	}
+
+	f(MustCompile(`$`), nil)
+	f(MustCompile(`$.store.book[?(@.price < 10 && @.isbn || !(@.title =~ /^b/i))].title`), []TraceStep{
+		{Step: `key 'store'`, In: 1, Out: 1},
+		{Step: `key 'book'`, In: 1, Out: 1},
+		{
+			Step: `filter [?((@.price < 10 && @.isbn) || !(@.title =~ /^b/i))]`,
+			In:   1,
+			Out:  2,
+			Rejected: []TraceRejection{{
+				Path:   `$['store']['book'][1]`,
+				Reason: `@.price < 10 is false for 22 < 10; !(@.title =~ /^b/i) is false, since @.title =~ /^b/i is true`,
+			}},
+			TotalRejected: 1,
+		},
+		{Step: `key 'title'`, In: 2, Out: 2},
+	})
+	f(MustCompile(`$..book[?(@.price * 2 > $.store.bicycle.price / 10 && @.isbn)]`), []TraceStep{
+		{
+			Step: `descendants .., then key 'book', then filter [?(@.price * 2 > $.store.bicycle.price / 10 && @.isbn)]`,
+			In:   1,
+			Out:  0,
+			Rejected: []TraceRejection{
+				{Path: `$['store']['book'][0]`, Reason: `@.price * 2 > $.store.bicycle.price / 10 is false for 16 > 39.9`},
+				{Path: `$['store']['book'][1]`, Reason: `@.isbn is missing`},
+				{Path: `$['store']['book'][2]`, Reason: `@.price * 2 > $.store.bicycle.price / 10 is false for 10 > 39.9`},
+			},
+			TotalRejected: 3,
+		},
+	})
+	f(MustCompile(`$.store.book[?(@.title =~ /^x/ || @.price == @.isbn)]`), []TraceStep{
+		{Step: `key 'store'`, In: 1, Out: 1},
+		{Step: `key 'book'`, In: 1, Out: 1},
+		{
+			Step: `filter [?(@.title =~ /^x/ || @.price == @.isbn)]`,
+			In:   1,
+			Out:  0,
+			Rejected: []TraceRejection{
+				{Path: `$['store']['book'][0]`, Reason: `@.title = "a" doesn't match /^x/; @.price == @.isbn is false for 8 == "x"`},
+				{Path: `$['store']['book'][1]`, Reason: `@.title = "b" doesn't match /^x/; @.isbn is missing`},
+				{Path: `$['store']['book'][2]`, Reason: `@.title = "c" doesn't match /^x/; @.isbn is missing`},
+			},
+			TotalRejected: 3,
+		},
+	})
+	f(MustCompile(`$.store.missing.x`), []TraceStep{
+		{Step: `key 'store'`, In: 1, Out: 1},
+		{Step: `key 'missing'`, In: 1, Out: 0},
+	})
+	f(MustCompile(`$.store.book[5]`), []TraceStep{
+		{Step: `key 'store'`, In: 1, Out: 1},
+		{Step: `key 'book'`, In: 1, Out: 1},
+		{Step: `index 5`, In: 1, Out: 0},
+	})
+	f(MustCompile(`$.store.book[*].isbn`), []TraceStep{
+		{Step: `key 'store'`, In: 1, Out: 1},
+		{Step: `key 'book'`, In: 1, Out: 1},
+		{Step: `wildcard [*]`, In: 1, Out: 3},
+		{Step: `key 'isbn'`, In: 3, Out: 1},
+	})
+
+	f(MustCompileRFC9535(`$.store.book[?@.price > 6 && @.price < 10].title`), []TraceStep{
+		{Step: `child segment [name 'store']`, In: 1, Out: 1},
+		{Step: `child segment [name 'book']`, In: 1, Out: 1},
+		{
+			Step: `child segment [filter ?@['price'] > 6 && @['price'] < 10]`,
+			In:   1,
+			Out:  1,
+			Rejected: []TraceRejection{
+				{Path: `$['store']['book'][1]`, Reason: `@['price'] < 10 is false for 22 < 10`},
+				{Path: `$['store']['book'][2]`, Reason: `@['price'] > 6 is false for 5 > 6`},
+			},
+			TotalRejected: 2,
+		},
+		{Step: `child segment [name 'title']`, In: 1, Out: 1},
+	})
+	f(MustCompileRFC9535(`$.store[?@.isbn || !@.price]`), []TraceStep{
+		{Step: `child segment [name 'store']`, In: 1, Out: 1},
+		{
+			Step: `child segment [filter ?@['isbn'] || !(@['price'])]`,
+			In:   1,
+			Out:  1,
+			Rejected: []TraceRejection{
+				{Path: `$['store']['bicycle']`, Reason: `@['isbn'] selects nothing; !(@['price']) is false, since @['price'] is true`},
+			},
+			TotalRejected: 1,
+		},
+	})
+}
+
+func TestCompiledLookupTraceError(t *testing.T) {
+	root := MustParse(`{"a":1}`)
+	c := MustCompile(`$.a[?(@.b)]`)
+	_, tr, err := c.LookupTrace(root)
+	if err == nil {
+		t.Fatalf("expecting non-nil error")
+	}
+	if tr.Err != err {
+		t.Fatalf("unexpected trace error; got %v; want %v", tr.Err, err)
+	}
+	s := tr.String()
+	sExpected := "1: key 'a': 1 in, 1 out\n2: filter [?(@.b)]: 1 in, 0 out\nerror: " + err.Error() + "\n"
+	if s != sExpected {
+		t.Fatalf("unexpected trace;\ngot\n%s\nwant\n%s", s, sExpected)
+	}
+}
+
+func TestCompiledLookupTraceMaxRejections(t *testing.T) {
+	root := MustParse(`[` + strings.Repeat(`1,`, 150) + `2]`)
+	_, tr, err := MustCompile(`$[?(@ == 2)]`).LookupTrace(root)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ts := tr.Steps[0]
+	if ts.In != 1 || ts.Out != 1 || ts.TotalRejected != 150 || len(ts.Rejected) != maxTraceRejections {
+		t.Fatalf("unexpected step: in=%d, out=%d, total rejected=%d, rejected=%d", ts.In, ts.Out, ts.TotalRejected, len(ts.Rejected))
+	}
+	if r := ts.Rejected[0]; r.Path != `$[0]` || r.Reason != `@ == 2 is false for 1 == 2` {
+		t.Fatalf("unexpected rejection: %+v", r)
+	}
+	if s := tr.String(); !strings.HasSuffix(s, "     ... and 50 more\n") {
+		t.Fatalf("unexpected trace:\n%s", s)
+	}
+}
@@ -0,0 +1,248 @@
+package fastjson
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// FuncType is the declared type of a JSONPath function parameter or result.
+//
+// See RFC 9535 section 2.4.1 for details.
+type FuncType int
+
+const (
+	// FuncTypeValue is a JSON value or Nothing, i.e. absent value.
+	FuncTypeValue FuncType = iota
+
+	// FuncTypeLogical is a logical true or false.
+	FuncTypeLogical
+
+	// FuncTypeNodes is a nodelist.
+	FuncTypeNodes
+)
+
+// String returns RFC 9535 name for t.
+func (t FuncType) String() string {
+	switch t {
+	case FuncTypeValue:
+		return "ValueType"
+	case FuncTypeLogical:
+		return "LogicalType"
+	case FuncTypeNodes:
+		return "NodesType"
+	default:
+		return fmt.Sprintf("FuncType(%d)", int(t))
+	}
+}
+
+// FuncValue holds a JSONPath function argument or result.
+//
+// Only the field matching the declared FuncType is used.
+type FuncValue struct {
+	// Value is used for FuncTypeValue. nil Value stands for Nothing.
+	Value *Value
+
+	// Logical is used for FuncTypeLogical.
+	Logical bool
+
+	// Nodes is used for FuncTypeNodes.
+	Nodes []*Value
+}
+
+// Function is a JSONPath function extension, which may be called
+// from filter expressions.
+type Function struct {
+	// Params contains the declared parameter types.
+	//
+	// Calls with the wrong number of arguments or with arguments
+	// of the wrong type are rejected when the query is compiled.
+	Params []FuncType
+
+	// Result is the declared result type.
+	//
+	// FuncTypeValue results must be compared, while FuncTypeLogical
+	// and FuncTypeNodes results may be used as filter tests.
+	Result FuncType
+
+	// Call must return the function result for the given args.
+	//
+	// args has the same length as Params. Call may be called
+	// from concurrently running goroutines.
+	Call func(args []FuncValue) FuncValue
+}
+
+var (
+	functionsLock sync.RWMutex
+	functions     = map[string]*Function{
+		"length": {
+			Params: []FuncType{FuncTypeValue},
+			Result: FuncTypeValue,
+			Call:   fnLength,
+		},
+		"count": {
+			Params: []FuncType{FuncTypeNodes},
+			Result: FuncTypeValue,
+			Call:   fnCount,
+		},
+		"match": {
+			Params: []FuncType{FuncTypeValue, FuncTypeValue},
+			Result: FuncTypeLogical,
+			Call:   fnMatch,
+		},
+		"search": {
+			Params: []FuncType{FuncTypeValue, FuncTypeValue},
+			Result: FuncTypeLogical,
+			Call:   fnSearch,
+		},
+		"value": {
+			Params: []FuncType{FuncTypeNodes},
+			Result: FuncTypeValue,
+			Call:   fnValue,
+		},
+	}
+)
+
+// RegisterFunction registers f under the given name, so it may be called
+// from filter expressions of the subsequently compiled JSONPath queries.
+//
+// The name must start with a lowercase ASCII letter followed by ASCII
+// letters, digits or underscores. The standard length, count, match,
+// search and value functions are always available and cannot be replaced.
+func RegisterFunction(name string, f Function) error {
+	if !isFunctionName(name) {
+		return fmt.Errorf("invalid function name %q", name)
+	}
+	if f.Call == nil {
+		return fmt.Errorf("missing Call for function %s()", name)
+	}
+	for _, t := range append(f.Params, f.Result) {
+		if t < FuncTypeValue || t > FuncTypeNodes {
+			return fmt.Errorf("unknown type %s in function %s() declaration", t, name)
+		}
+	}
+	f.Params = append([]FuncType(nil), f.Params...)
+
+	functionsLock.Lock()
+	defer functionsLock.Unlock()
+	if functions[name] != nil {
+		return fmt.Errorf("function %s() is already registered", name)
+	}
+	functions[name] = &f
+	return nil
+}
+
+func lookupFunction(name string) *Function {
+	functionsLock.RLock()
+	f := functions[name]
+	functionsLock.RUnlock()
+	return f
+}
+
+func isFunctionName(s string) bool {
+	if len(s) == 0 || s[0] < 'a' || s[0] > 'z' {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		if !isFunctionNameChar(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isFunctionNameChar(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '_'
+}
+
+func fnLength(args []FuncValue) FuncValue {
+	v := args[0].Value
+	if v == nil {
+		return FuncValue{}
+	}
+	n := 0
+	switch v.Type() {
+	case TypeString:
+		n = utf8.RuneCountInString(v.s)
+	case TypeArray:
+		n = len(v.a)
+	case TypeObject:
+		n = v.o.Len()
+	default:
+		return FuncValue{}
+	}
+	return FuncValue{Value: &Value{s: strconv.Itoa(n), t: TypeNumber}}
+}
+
+func fnCount(args []FuncValue) FuncValue {
+	return FuncValue{Value: &Value{s: strconv.Itoa(len(args[0].Nodes)), t: TypeNumber}}
+}
+
+func fnValue(args []FuncValue) FuncValue {
+	if len(args[0].Nodes) != 1 {
+		return FuncValue{}
+	}
+	return FuncValue{Value: args[0].Nodes[0]}
+}
+
+func fnMatch(args []FuncValue) FuncValue {
+	return FuncValue{Logical: iregexpMatch(args[0].Value, args[1].Value, true)}
+}
+
+func fnSearch(args []FuncValue) FuncValue {
+	return FuncValue{Logical: iregexpMatch(args[0].Value, args[1].Value, false)}
+}
+
+// iregexpMatch matches v against the I-Regexp (RFC 9485) pattern.
+//
+// false is returned if either v or pattern isn't a string, if pattern is invalid
+// or if it exceeds RegexpLimits.
+func iregexpMatch(v, pattern *Value, full bool) bool {
+	if v == nil || pattern == nil || v.Type() != TypeString || pattern.Type() != TypeString {
+		return false
+	}
+
+	// Keys never start with `/` in order to differ from `=~` filter regexps.
+	key := "?" + pattern.s
+	if full {
+		key = "^" + pattern.s
+	}
+	re, err := regexps.compile(key, pattern.s, func() string {
+		expr := iregexpToRE2(pattern.s)
+		if full {
+			expr = `\A(?:` + expr + `)\z`
+		}
+		return expr
+	})
+	return err == nil && re.MatchString(v.s)
+}
+
+// iregexpToRE2 converts I-Regexp to RE2 syntax.
+//
+// The only difference which matters is `.`, which doesn't match
+// \n and \r in I-Regexp.
+func iregexpToRE2(s string) string {
+	var b strings.Builder
+	inClass := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s):
+			b.WriteByte(c)
+			i++
+			b.WriteByte(s[i])
+			continue
+		case c == '[':
+			inClass = true
+		case c == ']':
+			inClass = false
+		case c == '.' && !inClass:
+			b.WriteString(`[^\n\r]`)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
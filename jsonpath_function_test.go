@@ -0,0 +1,133 @@
+package fastjson
+
+import (
+	"strings"
+	"testing"
+)
+
+func init() {
+	mustRegisterFunction := func(name string, f Function) {
+		if err := RegisterFunction(name, f); err != nil {
+			panic(err)
+		}
+	}
+	mustRegisterFunction("startsWith", Function{
+		Params: []FuncType{FuncTypeValue, FuncTypeValue},
+		Result: FuncTypeLogical,
+		Call: func(args []FuncValue) FuncValue {
+			s, prefix := args[0].Value, args[1].Value
+			if s == nil || prefix == nil || s.Type() != TypeString || prefix.Type() != TypeString {
+				return FuncValue{}
+			}
+			return FuncValue{Logical: strings.HasPrefix(s.s, prefix.s)}
+		},
+	})
+	mustRegisterFunction("lower", Function{
+		Params: []FuncType{FuncTypeValue},
+		Result: FuncTypeValue,
+		Call: func(args []FuncValue) FuncValue {
+			s := args[0].Value
+			if s == nil || s.Type() != TypeString {
+				return FuncValue{}
+			}
+			return FuncValue{Value: &Value{s: strings.ToLower(s.s), t: TypeString}}
+		},
+	})
+	mustRegisterFunction("last_two", Function{
+		Params: []FuncType{FuncTypeNodes},
+		Result: FuncTypeNodes,
+		Call: func(args []FuncValue) FuncValue {
+			nodes := args[0].Nodes
+			if len(nodes) > 2 {
+				nodes = nodes[len(nodes)-2:]
+			}
+			return FuncValue{Nodes: nodes}
+		},
+	})
+}
+
+func TestRegisteredFunctions(t *testing.T) {
+	root := MustParse(`[{"name":"Alice","tags":[1,2,3]},{"name":"bob","tags":[]},{"name":"ALBERT","tags":[4]}]`)
+
+	f := func(c *Compiled, resultExpected string) {
+		t.Helper()
+		res, err := c.Lookup(root)
+		if err != nil {
+			t.Fatalf("unexpected error for %s: %s", c, err)
+		}
+		if s := res.String(); s != resultExpected {
+			t.Fatalf("unexpected result for %s; got %s; want %s", c, s, resultExpected)
+		}
+	}
+
+	f(MustCompile(`$[?(startsWith(@.name, 'A'))].name`), `["Alice","ALBERT"]`)
+	f(MustCompile(`$[?(lower(@.name) == 'bob')].name`), `["bob"]`)
+	f(MustCompile(`$[?(startsWith(lower(@.name), 'al') && length(@.tags) == 1)].name`), `["ALBERT"]`)
+	f(MustCompileRFC9535(`$[?startsWith(lower(@.name), 'al')].name`), `["Alice","ALBERT"]`)
+	f(MustCompileRFC9535(`$[?count(last_two(@.tags[*])) == 2].name`), `["Alice"]`)
+	f(MustCompileRFC9535(`$[?last_two(@.tags[*])].name`), `["Alice","ALBERT"]`)
+}
+
+func TestRegisteredFunctionsTypeCheck(t *testing.T) {
+	f := func(jpath string) {
+		t.Helper()
+		if _, err := Compile(jpath); err == nil {
+			t.Fatalf("expecting non-nil error when compiling %q", jpath)
+		}
+		rfcPath := strings.Replace(strings.Replace(jpath, "?(", "?", 1), ")]", "]", 1)
+		if _, err := CompileRFC9535(rfcPath); err == nil {
+			t.Fatalf("expecting non-nil error when compiling %q", rfcPath)
+		}
+	}
+
+	// The result of logical function cannot be compared.
+	f(`$[?(startsWith(@.name, 'A') == true)]`)
+
+	// The result of value function must be compared.
+	f(`$[?(lower(@.name))]`)
+
+	// Wrong number of arguments.
+	f(`$[?(startsWith(@.name))]`)
+	f(`$[?(lower(@.name, 'x') == 'a')]`)
+
+	// Wrong argument types.
+	f(`$[?(lower(startsWith(@.name, 'a')) == 'a')]`)
+	f(`$[?(count(last_two(1)) == 2)]`)
+	f(`$[?(lower(@.*) == 'a')]`)
+}
+
+func TestRegisterFunctionError(t *testing.T) {
+	call := func(args []FuncValue) FuncValue {
+		return FuncValue{}
+	}
+	f := func(name string, fn Function) {
+		t.Helper()
+		if err := RegisterFunction(name, fn); err == nil {
+			t.Fatalf("expecting non-nil error when registering %q", name)
+		}
+	}
+
+	f("", Function{Call: call})
+	f("Upper", Function{Call: call})
+	f("1st", Function{Call: call})
+	f("foo-bar", Function{Call: call})
+	f("nocall", Function{})
+	f("badtype", Function{Params: []FuncType{FuncType(10)}, Call: call})
+	f("badresult", Function{Result: FuncType(-1), Call: call})
+	f("length", Function{Params: []FuncType{FuncTypeValue}, Call: call})
+	f("lower", Function{Params: []FuncType{FuncTypeValue}, Call: call})
+}
+
+func TestFuncTypeString(t *testing.T) {
+	f := func(ft FuncType, sExpected string) {
+		t.Helper()
+		if s := ft.String(); s != sExpected {
+			t.Fatalf("unexpected string for FuncType; got %q; want %q", s, sExpected)
+		}
+	}
+
+	f(FuncTypeValue, "ValueType")
+	f(FuncTypeLogical, "LogicalType")
+	f(FuncTypeNodes, "NodesType")
+	f(FuncType(123), "FuncType(123)")
+}
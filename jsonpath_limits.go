@@ -0,0 +1,233 @@
+package fastjson
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrLimitExceeded is returned by Compiled.LookupLimited when the evaluation
+// exceeds one of the Limits or when its context is done.
+//
+// The returned errors are LimitError wrapping ErrLimitExceeded,
+// so they may be checked with errors.Is.
+var ErrLimitExceeded = errors.New("JSONPath evaluation limit exceeded")
+
+// Limits bounds resources consumed by Compiled.LookupLimited.
+//
+// There is no limit for zero and negative fields.
+type Limits struct {
+	// MaxNodes is the maximum number of nodes visited during the evaluation.
+	//
+	// Visited nodes are the nodes selected by every step, the nodes walked
+	// by descendant segments `..` and the nodes filters are evaluated on,
+	// including the nodes visited by queries nested into filters such as
+	// `count(@..*)`.
+	MaxNodes int
+
+	// MaxResults is the maximum number of values in the result.
+	//
+	// It is checked while the results are selected, so the evaluation stops
+	// as soon as the limit is exceeded.
+	MaxResults int
+
+	// MaxDepth is the maximum recursion depth of descendant segments `..`,
+	// i.e. the maximum depth of the walked nodes relative to the node
+	// the segment is applied to.
+	MaxDepth int
+}
+
+// LimitError is returned by Compiled.LookupLimited when the evaluation
+// exceeds a limit.
+type LimitError struct {
+	// Limit is the name of the exceeded limit: "MaxNodes", "MaxResults",
+	// "MaxDepth" or "Context" if the evaluation context is done.
+	Limit string
+
+	// Value is the value of the exceeded limit. It is 0 for "Context".
+	Value int
+
+	// Err is the context error for "Context".
+	Err error
+}
+
+// Error implements error interface.
+func (e *LimitError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %s", ErrLimitExceeded, e.Err)
+	}
+	return fmt.Sprintf("%s: %s=%d", ErrLimitExceeded, e.Limit, e.Value)
+}
+
+// Is returns true for ErrLimitExceeded.
+func (e *LimitError) Is(target error) bool {
+	return target == ErrLimitExceeded
+}
+
+// Unwrap returns the context error for "Context", so context.DeadlineExceeded
+// and context.Canceled may be checked with errors.Is.
+func (e *LimitError) Unwrap() error {
+	return e.Err
+}
+
+// LookupLimited is like Lookup, but it stops the evaluation with LimitError
+// when it exceeds the given limits or when ctx is done.
+//
+// It is intended for evaluating untrusted paths, such as `$..*..*`,
+// which may consume a lot of CPU time and memory on large documents.
+// ctx is checked periodically while nodes are visited, so the evaluation
+// may overrun the deadline by the time needed for evaluating a filter
+// on a single node.
+func (c *Compiled) LookupLimited(ctx context.Context, root *Value, limits Limits) (*Value, error) {
+	lim := &evalLimiter{
+		ctx:    ctx,
+		limits: limits,
+	}
+	if lim.checkContext() {
+		return nil, lim.err
+	}
+
+	var nodes []node
+	multi := true
+	if c.query != nil {
+		if n := len(c.query.segments); n > 0 {
+			lim.final = &c.query.segments[n-1]
+		}
+		nodes = c.query.selectNodes(root, node{v: root}, false, lim)
+	} else {
+		var err error
+		if nodes, multi, err = lookup_steps(c.steps, []node{{v: root}}, root, false, false, lim); err != nil {
+			return nil, err
+		}
+	}
+	if lim.exceeded() {
+		return nil, lim.err
+	}
+
+	if multi {
+		return nodeValues(nodes), nil
+	}
+	if len(nodes) == 0 {
+		return nil, notFoundErrorf("path not found: %s", c)
+	}
+	return nodes[0].v, nil
+}
+
+// contextCheckInterval is the number of visited nodes between context checks.
+const contextCheckInterval = 64
+
+// evalLimiter tracks resources consumed by the evaluation.
+//
+// nil evalLimiter doesn't limit anything, so the evaluation without limits
+// doesn't pay for the accounting.
+type evalLimiter struct {
+	ctx    context.Context
+	limits Limits
+
+	nodes int
+	depth int
+
+	// final is the segment selecting the results of the RFC 9535 query.
+	// Queries nested into filters have distinct segments, so the nodes
+	// they select aren't counted as results.
+	final *rfcSegment
+
+	// unchecked is the number of nodes visited since the last context check.
+	unchecked int
+
+	// err is set to LimitError when a limit is exceeded.
+	err error
+}
+
+// exceeded returns true if a limit has been exceeded.
+func (l *evalLimiter) exceeded() bool {
+	return l != nil && l.err != nil
+}
+
+// visit accounts n visited nodes.
+//
+// It returns false if a limit has been exceeded, so the evaluation must stop.
+func (l *evalLimiter) visit(n int) bool {
+	if l == nil {
+		return true
+	}
+	if l.err != nil {
+		return false
+	}
+	l.nodes += n
+	if max := l.limits.MaxNodes; max > 0 && l.nodes > max {
+		l.err = &LimitError{Limit: "MaxNodes", Value: max}
+		return false
+	}
+	l.unchecked += n
+	if l.unchecked >= contextCheckInterval {
+		l.unchecked = 0
+		return !l.checkContext()
+	}
+	return true
+}
+
+// results checks MaxResults for n results selected so far.
+//
+// It returns false if a limit has been exceeded, so the evaluation must stop.
+func (l *evalLimiter) results(n int) bool {
+	if l == nil {
+		return true
+	}
+	if l.err != nil {
+		return false
+	}
+	if max := l.limits.MaxResults; max > 0 && n > max {
+		l.err = &LimitError{Limit: "MaxResults", Value: max}
+		return false
+	}
+	return true
+}
+
+// selected is like results for n nodes selected by seg so far.
+//
+// MaxResults is checked only if seg selects the query results.
+func (l *evalLimiter) selected(seg *rfcSegment, n int) bool {
+	if l == nil {
+		return true
+	}
+	if seg == l.final {
+		return l.results(n)
+	}
+	return l.err == nil
+}
+
+// checkContext returns true if the evaluation context is done.
+func (l *evalLimiter) checkContext() bool {
+	if err := l.ctx.Err(); err != nil {
+		l.err = &LimitError{Limit: "Context", Err: err}
+		return true
+	}
+	return false
+}
+
+// descend must be called before walking children of a node.
+//
+// It returns false if MaxDepth has been exceeded, so the children mustn't be walked.
+// Otherwise ascend must be called after the children are walked.
+func (l *evalLimiter) descend() bool {
+	if l == nil {
+		return true
+	}
+	if l.err != nil {
+		return false
+	}
+	l.depth++
+	if max := l.limits.MaxDepth; max > 0 && l.depth > max {
+		l.depth--
+		l.err = &LimitError{Limit: "MaxDepth", Value: max}
+		return false
+	}
+	return true
+}
+
+func (l *evalLimiter) ascend() {
+	if l != nil {
+		l.depth--
+	}
+}
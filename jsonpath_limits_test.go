@@ -0,0 +1,170 @@
+package fastjson
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompiledLookupLimited(t *testing.T) {
+	root := MustParse(`{"a":{"b":[1,2,{"c":[3,4]}]},"d":[5,6,7]}`)
+
+	f := func(c *Compiled, limits Limits, resultExpected string) {
+		t.Helper()
+		v, err := c.LookupLimited(context.Background(), root, limits)
+		if err != nil {
+			t.Fatalf("unexpected error for %s: %s", c, err)
+		}
+		vExpected, err := c.Lookup(root)
+		if err != nil {
+			t.Fatalf("unexpected Lookup error for %s: %s", c, err)
+		}
+		result := "<nil>"
+		if v != nil {
+			result = v.String()
+		}
+		if result != resultExpected {
+			t.Fatalf("unexpected result for %s; got %s; want %s", c, result, resultExpected)
+		}
+		if vExpected != nil && result != vExpected.String() {
+			t.Fatalf("unexpected result for %s; got %s; Lookup returns %s", c, result, vExpected)
+		}
+	}
+
+	f(MustCompile(`$.a.b[1]`), Limits{MaxNodes: 2, MaxResults: 1, MaxDepth: 1}, `2`)
+	f(MustCompile(`$.a.b[5:]`), Limits{MaxNodes: 2}, `[]`)
+	f(MustCompile(`$.d[*]`), Limits{MaxNodes: 4, MaxResults: 3}, `[5,6,7]`)
+	f(MustCompile(`$.d[?(@ > 5)]`), Limits{MaxNodes: 6, MaxResults: 2}, `[6,7]`)
+	f(MustCompile(`$..c`), Limits{MaxDepth: 5}, `[[3,4]]`)
+	f(MustCompile(`$..*`), Limits{MaxResults: 12}, `[{"b":[1,2,{"c":[3,4]}]},[5,6,7],[1,2,{"c":[3,4]}],1,2,{"c":[3,4]},[3,4],3,4,5,6,7]`)
+	f(MustCompile(`$.a`), Limits{}, `{"b":[1,2,{"c":[3,4]}]}`)
+
+	f(MustCompileRFC9535(`$.a.b[1]`), Limits{MaxNodes: 3, MaxResults: 1, MaxDepth: 1}, `[2]`)
+	f(MustCompileRFC9535(`$.d[?@ > 5]`), Limits{MaxNodes: 6, MaxResults: 2}, `[6,7]`)
+	f(MustCompileRFC9535(`$..c`), Limits{MaxDepth: 5}, `[[3,4]]`)
+	f(MustCompileRFC9535(`$.missing`), Limits{MaxNodes: 1}, `[]`)
+
+	// Single-valued paths without a match fail like Lookup does.
+	c := MustCompile(`$.a[?(@.x == 1)]`)
+	if _, err := c.LookupLimited(context.Background(), root, Limits{}); !errors.Is(err, ErrPathNotFound) {
+		t.Fatalf("unexpected error for %s; got %v; want %v", c, err, ErrPathNotFound)
+	}
+}
+
+func TestCompiledLookupLimitedExceeded(t *testing.T) {
+	root := MustParse(`{"a":{"b":[1,2,{"c":[3,4]}]},"d":[5,6,7]}`)
+
+	f := func(c *Compiled, limits Limits, limitExpected string) {
+		t.Helper()
+		v, err := c.LookupLimited(context.Background(), root, limits)
+		if err == nil {
+			t.Fatalf("expecting non-nil error for %s; got %s", c, v)
+		}
+		if !errors.Is(err, ErrLimitExceeded) {
+			t.Fatalf("expecting ErrLimitExceeded for %s; got %s", c, err)
+		}
+		var le *LimitError
+		if !errors.As(err, &le) {
+			t.Fatalf("expecting LimitError for %s; got %T", c, err)
+		}
+		if le.Limit != limitExpected {
+			t.Fatalf("unexpected limit for %s; got %s; want %s", c, le.Limit, limitExpected)
+		}
+		if v != nil {
+			t.Fatalf("expecting nil value for %s; got %s", c, v)
+		}
+	}
+
+	f(MustCompile(`$.a.b[1]`), Limits{MaxNodes: 1}, "MaxNodes")
+	f(MustCompile(`$.d[?(@ > 5)]`), Limits{MaxNodes: 4}, "MaxNodes")
+	f(MustCompile(`$..*..*`), Limits{MaxNodes: 50}, "MaxNodes")
+	f(MustCompile(`$..*`), Limits{MaxNodes: 10}, "MaxNodes")
+	f(MustCompile(`$.d[*]`), Limits{MaxResults: 2}, "MaxResults")
+	f(MustCompile(`$..c`), Limits{MaxDepth: 4}, "MaxDepth")
+
+	f(MustCompileRFC9535(`$.a.b[1]`), Limits{MaxNodes: 2}, "MaxNodes")
+	f(MustCompileRFC9535(`$.d[?@ > 5]`), Limits{MaxNodes: 4}, "MaxNodes")
+	f(MustCompileRFC9535(`$..*..*`), Limits{MaxNodes: 50}, "MaxNodes")
+	f(MustCompileRFC9535(`$..*`), Limits{MaxResults: 11}, "MaxResults")
+	f(MustCompileRFC9535(`$..c`), Limits{MaxDepth: 4}, "MaxDepth")
+}
+
+func TestCompiledLookupLimitedLargeInput(t *testing.T) {
+	root := MustParse(`[` + strings.Repeat(`{"a":[1,2,3]},`, 1000) + `{}]`)
+
+	f := func(c *Compiled, limits Limits, limitExpected string) {
+		t.Helper()
+		_, err := c.LookupLimited(context.Background(), root, limits)
+		var le *LimitError
+		if !errors.As(err, &le) {
+			t.Fatalf("expecting LimitError for %s; got %v", c, err)
+		}
+		if le.Limit != limitExpected {
+			t.Fatalf("unexpected limit for %s; got %s; want %s", c, le.Limit, limitExpected)
+		}
+	}
+
+	// Nodes visited by queries nested into filters are counted.
+	f(MustCompile(`$[?(count($..*) > 0)]`), Limits{MaxNodes: 10000}, "MaxNodes")
+	f(MustCompile(`$[?(count(@..*) > 100)]`), Limits{MaxNodes: 5000}, "MaxNodes")
+	f(MustCompileRFC9535(`$[?count($..*) > 0]`), Limits{MaxNodes: 10000}, "MaxNodes")
+	f(MustCompileRFC9535(`$[?@.a[?count($[*]) > 0]]`), Limits{MaxNodes: 10000}, "MaxNodes")
+
+	// MaxResults is checked before all the results are selected,
+	// so MaxNodes isn't reached.
+	f(MustCompile(`$[*].a`), Limits{MaxNodes: 1100, MaxResults: 2}, "MaxResults")
+	f(MustCompile(`$..a`), Limits{MaxNodes: 6100, MaxResults: 2}, "MaxResults")
+	f(MustCompileRFC9535(`$[*].a`), Limits{MaxNodes: 1100, MaxResults: 2}, "MaxResults")
+	f(MustCompileRFC9535(`$..a`), Limits{MaxNodes: 6100, MaxResults: 2}, "MaxResults")
+
+	// Nodes selected by nested queries aren't results.
+	c := MustCompileRFC9535(`$[?count(@.a[*]) == 3].a`)
+	v, err := c.LookupLimited(context.Background(), root, Limits{MaxResults: 1000})
+	if err != nil {
+		t.Fatalf("unexpected error for %s: %s", c, err)
+	}
+	if n := len(v.GetArray()); n != 1000 {
+		t.Fatalf("unexpected number of results for %s; got %d; want 1000", c, n)
+	}
+}
+
+func TestCompiledLookupLimitedContext(t *testing.T) {
+	root := MustParse(`[` + strings.Repeat(`{"a":[1,2,3]},`, 1000) + `{}]`)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, c := range []*Compiled{MustCompile(`$.x`), MustCompile(`$..a`), MustCompileRFC9535(`$..a`)} {
+		_, err := c.LookupLimited(ctx, root, Limits{})
+		if !errors.Is(err, ErrLimitExceeded) || !errors.Is(err, context.Canceled) {
+			t.Fatalf("unexpected error for %s: %v", c, err)
+		}
+	}
+
+	// The deadline expires during the evaluation.
+	ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	<-ctx.Done()
+	lim := &evalLimiter{
+		ctx: ctx,
+	}
+	nodes := walk_descendants(nil, node{v: root}, false, lim)
+	if !lim.exceeded() || !errors.Is(lim.err, context.DeadlineExceeded) {
+		t.Fatalf("unexpected error: %v", lim.err)
+	}
+	if len(nodes) != contextCheckInterval-1 {
+		t.Fatalf("unexpected number of walked nodes; got %d; want %d", len(nodes), contextCheckInterval-1)
+	}
+
+	s := lim.err.Error()
+	sExpected := "JSONPath evaluation limit exceeded: context deadline exceeded"
+	if s != sExpected {
+		t.Fatalf("unexpected error message; got %q; want %q", s, sExpected)
+	}
+	s = (&LimitError{Limit: "MaxNodes", Value: 10}).Error()
+	sExpected = "JSONPath evaluation limit exceeded: MaxNodes=10"
+	if s != sExpected {
+		t.Fatalf("unexpected error message; got %q; want %q", s, sExpected)
+	}
+}
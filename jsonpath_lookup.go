@@ -0,0 +1,115 @@
+package fastjson
+
+// LookupString returns the string matched by c in root.
+//
+// The returned string is valid until Parse is called on the Parser returned root.
+//
+// The first match is used if c matches multiple values.
+// An error wrapping ErrPathNotFound is returned if c matches nothing.
+// An error wrapping ErrNullValue is returned if the matched value is null,
+// while an error wrapping ErrTypeMismatch is returned if it has other type
+// than string.
+func (c *Compiled) LookupString(root *Value) (string, error) {
+	v, err := c.lookupFirst(root)
+	if err != nil {
+		return "", err
+	}
+	if v.Type() != TypeString {
+		return "", c.unexpectedType(v, "string")
+	}
+	return v.s, nil
+}
+
+// LookupInt64 returns the int64 matched by c in root.
+//
+// See LookupString for details on the returned errors. Numbers, which
+// aren't integers or don't fit int64, are reported as ErrTypeMismatch.
+func (c *Compiled) LookupInt64(root *Value) (int64, error) {
+	v, err := c.lookupFirst(root)
+	if err != nil {
+		return 0, err
+	}
+	if v.t != TypeNumber {
+		return 0, c.unexpectedType(v, "number")
+	}
+	n, err := v.ToInt64()
+	if err != nil {
+		return 0, typeMismatchErrorf("cannot obtain int64 from the value at %s: %s", c, err)
+	}
+	return n, nil
+}
+
+// LookupFloat64 returns the float64 matched by c in root.
+//
+// See LookupString for details on the returned errors.
+func (c *Compiled) LookupFloat64(root *Value) (float64, error) {
+	v, err := c.lookupFirst(root)
+	if err != nil {
+		return 0, err
+	}
+	if v.t != TypeNumber {
+		return 0, c.unexpectedType(v, "number")
+	}
+	f, err := v.ToFloat64()
+	if err != nil {
+		return 0, typeMismatchErrorf("cannot obtain float64 from the value at %s: %s", c, err)
+	}
+	return f, nil
+}
+
+// LookupBool returns the bool matched by c in root.
+//
+// See LookupString for details on the returned errors.
+func (c *Compiled) LookupBool(root *Value) (bool, error) {
+	v, err := c.lookupFirst(root)
+	if err != nil {
+		return false, err
+	}
+	switch v.t {
+	case TypeTrue:
+		return true, nil
+	case TypeFalse:
+		return false, nil
+	default:
+		return false, c.unexpectedType(v, "bool")
+	}
+}
+
+// LookupArray returns items of the array matched by c in root.
+//
+// See LookupString for details on the returned errors.
+// Use Lookup for obtaining all the values matched by c.
+func (c *Compiled) LookupArray(root *Value) ([]*Value, error) {
+	v, err := c.lookupFirst(root)
+	if err != nil {
+		return nil, err
+	}
+	if v.t != TypeArray {
+		return nil, c.unexpectedType(v, "array")
+	}
+	return v.a, nil
+}
+
+// lookupFirst returns the first value matched by c in root.
+func (c *Compiled) lookupFirst(root *Value) (*Value, error) {
+	var nodes []node
+	if c.query != nil {
+		nodes = c.query.selectNodes(root, node{v: root}, false, nil)
+	} else {
+		var err error
+		if nodes, _, err = c.lookup_nodes(root, false); err != nil {
+			return nil, err
+		}
+	}
+	if len(nodes) == 0 {
+		return nil, notFoundErrorf("path not found: %s", c)
+	}
+	return nodes[0].v, nil
+}
+
+func (c *Compiled) unexpectedType(v *Value, expected string) error {
+	if v.t == TypeNull {
+		return nullValueErrorf("value at %s doesn't contain %s; it contains null", c, expected)
+	}
+	return typeMismatchErrorf("value at %s doesn't contain %s; it contains %s", c, expected, v.Type())
+}
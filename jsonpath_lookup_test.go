@@ -0,0 +1,129 @@
+package fastjson
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestCompiledLookupTyped(t *testing.T) {
+	root := MustParse(`{"s": "foo\nbar", "n": 123, "big": 12345678901234567890, "f": 1.5, "t": true, "nil": null, "a": [1, "x"], "o": {"b": [{"c": 2}, {"c": 3}]}}`)
+
+	s, err := MustCompile(`$.s`).LookupString(root)
+	if err != nil || s != "foo\nbar" {
+		t.Fatalf("unexpected LookupString result; got %q, %v; want %q", s, err, "foo\nbar")
+	}
+	n, err := MustCompile(`$.n`).LookupInt64(root)
+	if err != nil || n != 123 {
+		t.Fatalf("unexpected LookupInt64 result; got %d, %v; want 123", n, err)
+	}
+	x, err := MustCompile(`$.f`).LookupFloat64(root)
+	if err != nil || x != 1.5 {
+		t.Fatalf("unexpected LookupFloat64 result; got %v, %v; want 1.5", x, err)
+	}
+	b, err := MustCompile(`$.t`).LookupBool(root)
+	if err != nil || !b {
+		t.Fatalf("unexpected LookupBool result; got %v, %v; want true", b, err)
+	}
+	a, err := MustCompile(`$.a`).LookupArray(root)
+	if err != nil || len(a) != 2 || a[1].String() != `"x"` {
+		t.Fatalf("unexpected LookupArray result; got %v, %v; want [1 \"x\"]", a, err)
+	}
+
+	// The first match is used for multiple matches.
+	n, err = MustCompile(`$.o.b[*].c`).LookupInt64(root)
+	if err != nil || n != 2 {
+		t.Fatalf("unexpected LookupInt64 result for multiple matches; got %d, %v; want 2", n, err)
+	}
+	n, err = MustCompileRFC9535(`$.o.b[1].c`).LookupInt64(root)
+	if err != nil || n != 3 {
+		t.Fatalf("unexpected LookupInt64 result for RFC 9535 path; got %d, %v; want 3", n, err)
+	}
+
+	f := func(path string, lookup func(c *Compiled) error, errExpected error) {
+		t.Helper()
+		err := lookup(MustCompile(path))
+		if err == nil {
+			t.Fatalf("expecting non-nil error for %s", path)
+		}
+		if !errors.Is(err, errExpected) {
+			t.Fatalf("unexpected error for %s; got %v; want %v", path, err, errExpected)
+		}
+	}
+	lookupString := func(c *Compiled) error {
+		_, err := c.LookupString(root)
+		return err
+	}
+	lookupInt64 := func(c *Compiled) error {
+		_, err := c.LookupInt64(root)
+		return err
+	}
+	lookupArray := func(c *Compiled) error {
+		_, err := c.LookupArray(root)
+		return err
+	}
+
+	// missing fields
+	f(`$.missing`, lookupString, ErrPathNotFound)
+	f(`$.a[5]`, lookupInt64, ErrPathNotFound)
+	f(`$.o.b[?(@.c > 10)].c`, lookupInt64, ErrPathNotFound)
+	f(`$..missing`, lookupString, ErrPathNotFound)
+	f(`$.o[?(@.c == 'blue')]`, lookupString, ErrPathNotFound)
+
+	// null values
+	f(`$.nil`, lookupString, ErrNullValue)
+	f(`$.nil`, lookupInt64, ErrNullValue)
+	f(`$.nil`, lookupArray, ErrNullValue)
+
+	// wrong types
+	f(`$.n`, lookupString, ErrTypeMismatch)
+	f(`$.f`, lookupInt64, ErrTypeMismatch)
+	f(`$.big`, lookupInt64, ErrTypeMismatch)
+	f(`$.o`, lookupArray, ErrTypeMismatch)
+	f(`$.s.x`, lookupString, ErrTypeMismatch)
+	f(`$.n[0]`, lookupInt64, ErrTypeMismatch)
+
+	if _, err := MustCompileRFC9535(`$.missing`).LookupBool(root); !errors.Is(err, ErrPathNotFound) {
+		t.Fatalf("unexpected error for RFC 9535 path; got %v; want %v", err, ErrPathNotFound)
+	}
+	if _, err := MustCompileRFC9535(`$.nil`).LookupBool(root); !errors.Is(err, ErrNullValue) || errors.Is(err, ErrTypeMismatch) {
+		t.Fatalf("unexpected error for RFC 9535 null; got %v; want %v", err, ErrNullValue)
+	}
+	if _, err := MustCompile(`$.n`).LookupString(root); errors.Is(err, ErrNullValue) {
+		t.Fatalf("unexpected ErrNullValue for a number: %v", err)
+	}
+}
+
+func TestLookupErrorsIs(t *testing.T) {
+	data := []byte(`{"a": {"b": 1}, "c": [1, 2], "s": "x"}`)
+	root := MustParseBytes(data)
+
+	f := func(path string, errExpected error) {
+		t.Helper()
+		c := MustCompile(path)
+		if _, err := c.Lookup(root); !errors.Is(err, errExpected) {
+			t.Fatalf("unexpected Lookup error for %s; got %v; want %v", path, err, errExpected)
+		}
+		if _, err := GetPath(data, c); !errors.Is(err, errExpected) {
+			t.Fatalf("unexpected GetPath error for %s; got %v; want %v", path, err, errExpected)
+		}
+		err := StreamPath(bytes.NewReader(data), c, func(v *Value) error { return nil })
+		if !errors.Is(err, errExpected) {
+			t.Fatalf("unexpected StreamPath error for %s; got %v; want %v", path, err, errExpected)
+		}
+	}
+
+	f(`$.a.x`, ErrPathNotFound)
+	f(`$.c[2]`, ErrPathNotFound)
+	f(`$.s.x`, ErrTypeMismatch)
+	f(`$.a[0]`, ErrTypeMismatch)
+
+	// A filter over an object, which doesn't match the object.
+	if _, err := MustCompile(`$.a[?(@.b == 2)]`).Lookup(root); !errors.Is(err, ErrPathNotFound) {
+		t.Fatalf("unexpected Lookup error for a filter over an object; got %v; want %v", err, ErrPathNotFound)
+	}
+
+	if !errors.Is(ErrGetFromNullObj, ErrTypeMismatch) {
+		t.Fatalf("ErrGetFromNullObj must wrap ErrTypeMismatch")
+	}
+}
@@ -0,0 +1,223 @@
+package fastjson
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Node is a value matched by a JSONPath query together with its location
+// in the queried document.
+type Node struct {
+	// Value is the matched value.
+	Value *Value
+
+	// Path is the location of Value starting from the document root.
+	//
+	// Every item is either a string holding object member name
+	// or an int holding array index. The root node has empty Path.
+	Path []interface{}
+
+	// loc is used for obtaining the parent node.
+	loc *location
+}
+
+// Parent returns the node holding n, i.e. the object n is a member of
+// or the array n is an item of.
+//
+// false is returned for the document root and for nodes,
+// which haven't been returned by Compiled.LookupNodes.
+func (n *Node) Parent() (Node, bool) {
+	if n.loc == nil || len(n.Path) == 0 {
+		return Node{}, false
+	}
+	depth := len(n.Path) - 1
+	return Node{
+		Value: n.loc.container,
+		Path:  n.Path[:depth:depth],
+		loc:   n.loc.parent,
+	}, true
+}
+
+// Key returns the member name of n in the parent object.
+//
+// false is returned if n isn't an object member.
+func (n *Node) Key() (string, bool) {
+	if len(n.Path) == 0 {
+		return "", false
+	}
+	key, ok := n.Path[len(n.Path)-1].(string)
+	return key, ok
+}
+
+// Index returns the index of n in the parent array.
+//
+// false is returned if n isn't an array item.
+func (n *Node) Index() (int, bool) {
+	if len(n.Path) == 0 {
+		return 0, false
+	}
+	idx, ok := n.Path[len(n.Path)-1].(int)
+	return idx, ok
+}
+
+// NormalizedPath returns n location as RFC 9535 normalized path,
+// i.e. `$['store']['book'][2]['price']`.
+func (n *Node) NormalizedPath() string {
+	return normalizedPath(n.Path)
+}
+
+// LookupNodes returns all the nodes matched by c in the document
+// starting from root.
+//
+// Unlike Lookup, the matched values aren't wrapped into an array,
+// so the location of every match may be obtained via Node.Path,
+// while the object or array holding it may be obtained via Node.Parent.
+func (c *Compiled) LookupNodes(root *Value) ([]Node, error) {
+	nodes, err := c.selectNodes(root)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]Node, len(nodes))
+	for i, n := range nodes {
+		res[i] = Node{
+			Value: n.v,
+			Path:  n.loc.path(),
+			loc:   n.loc,
+		}
+	}
+	return res, nil
+}
+
+// selectNodes returns the nodes matched by c together with their locations.
+func (c *Compiled) selectNodes(root *Value) ([]node, error) {
+	if c.query != nil {
+		return c.query.selectNodes(root, node{v: root}, true, nil), nil
+	}
+	nodes, _, err := c.lookup_nodes(root, true)
+	return nodes, err
+}
+
+// node is a value visited during JSONPath evaluation.
+//
+// loc is tracked only when the caller needs node locations,
+// since it costs an allocation per visited node.
+type node struct {
+	v   *Value
+	loc *location
+}
+
+// location is a step from the parent location to the node.
+//
+// nil location refers to the document root.
+type location struct {
+	parent *location
+
+	// container is the object or array holding the node.
+	container *Value
+
+	// key is the object member name. It is valid if idx < 0.
+	key string
+
+	// idx is the array index.
+	idx int
+}
+
+// member returns the node for v, which is n member with the given key.
+func (n node) member(key string, v *Value, paths bool) node {
+	if !paths {
+		return node{v: v}
+	}
+	return node{
+		v: v,
+		loc: &location{
+			parent:    n.loc,
+			container: n.v,
+			key:       key,
+			idx:       -1,
+		},
+	}
+}
+
+// element returns the node for the i-th item of n array.
+func (n node) element(i int, paths bool) node {
+	v := n.v.a[i]
+	if !paths {
+		return node{v: v}
+	}
+	return node{
+		v: v,
+		loc: &location{
+			parent:    n.loc,
+			container: n.v,
+			idx:       i,
+		},
+	}
+}
+
+func (loc *location) path() []interface{} {
+	depth := 0
+	for l := loc; l != nil; l = l.parent {
+		depth++
+	}
+	path := make([]interface{}, depth)
+	for l := loc; l != nil; l = l.parent {
+		depth--
+		if l.idx < 0 {
+			path[depth] = l.key
+		} else {
+			path[depth] = l.idx
+		}
+	}
+	return path
+}
+
+func normalizedPath(path []interface{}) string {
+	var b strings.Builder
+	b.WriteByte('$')
+	for _, x := range path {
+		b.WriteByte('[')
+		switch x := x.(type) {
+		case string:
+			b.WriteByte('\'')
+			writeNormalizedName(&b, x)
+			b.WriteByte('\'')
+		case int:
+			b.WriteString(strconv.Itoa(x))
+		}
+		b.WriteByte(']')
+	}
+	return b.String()
+}
+
+// writeNormalizedName writes s escaped according to RFC 9535 section 2.7.
+func writeNormalizedName(b *strings.Builder, s string) {
+	const hex = "0123456789abcdef"
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case '\'':
+			b.WriteString(`\'`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\f':
+			b.WriteString(`\f`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if c < 0x20 {
+				b.WriteString(`\u00`)
+				b.WriteByte(hex[c>>4])
+				b.WriteByte(hex[c&0xf])
+			} else {
+				b.WriteByte(c)
+			}
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package fastjson
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompiledLookupNodes(t *testing.T) {
+	root := MustParse(`{"store":{"book":[{"title":"a","price":8},{"title":"b","price":22}],"bicycle":{"price":399}}}`)
+
+	f := func(c *Compiled, pathsExpected ...string) {
+		t.Helper()
+		nodes, err := c.LookupNodes(root)
+		if err != nil {
+			t.Fatalf("unexpected error for %s: %s", c, err)
+		}
+		var paths []string
+		for _, n := range nodes {
+			paths = append(paths, n.NormalizedPath())
+		}
+		if !reflect.DeepEqual(paths, pathsExpected) {
+			t.Fatalf("unexpected paths for %s; got %q; want %q", c, paths, pathsExpected)
+		}
+	}
+
+	f(MustCompile(`$`), `$`)
+	f(MustCompile(`$.store.book[1].price`), `$['store']['book'][1]['price']`)
+	f(MustCompile(`$.store.book[-1]`), `$['store']['book'][1]`)
+	f(MustCompile(`$.store.book[0:1]`), `$['store']['book'][0]`, `$['store']['book'][1]`)
+	f(MustCompile(`$.store.book.title`), `$['store']['book'][0]['title']`, `$['store']['book'][1]['title']`)
+	f(MustCompile(`$.store.book[?(@.price > 10)]`), `$['store']['book'][1]`)
+	f(MustCompile(`$..price`), `$['store']['book'][0]['price']`, `$['store']['book'][1]['price']`, `$['store']['bicycle']['price']`)
+	f(MustCompile(`$.store.book[?(@.price > 100)]`))
+
+	f(MustCompileRFC9535(`$`), `$`)
+	f(MustCompileRFC9535(`$.store.book[-1].title`), `$['store']['book'][1]['title']`)
+	f(MustCompileRFC9535(`$.store.*`), `$['store']['book']`, `$['store']['bicycle']`)
+	f(MustCompileRFC9535(`$.store.book[::-1]`), `$['store']['book'][1]`, `$['store']['book'][0]`)
+	f(MustCompileRFC9535(`$..[?@.price < 100]`), `$['store']['book'][0]`, `$['store']['book'][1]`)
+	f(MustCompileRFC9535(`$.nonexisting`))
+}
+
+func TestCompiledLookupNodesPath(t *testing.T) {
+	root := MustParse(`{"a":[{"b'\n":1},{"c":[2,3]}]}`)
+
+	nodes, err := MustCompileRFC9535(`$..*`).LookupNodes(root)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var paths []string
+	for _, n := range nodes {
+		paths = append(paths, n.NormalizedPath())
+	}
+	s := strings.Join(paths, " ")
+	sExpected := `$['a'] $['a'][0] $['a'][1] $['a'][0]['b\'\n'] $['a'][1]['c'] $['a'][1]['c'][0] $['a'][1]['c'][1]`
+	if s != sExpected {
+		t.Fatalf("unexpected paths; got %s; want %s", s, sExpected)
+	}
+
+	n := nodes[len(nodes)-1]
+	pathExpected := []interface{}{"a", 1, "c", 1}
+	if !reflect.DeepEqual(n.Path, pathExpected) {
+		t.Fatalf("unexpected path; got %v; want %v", n.Path, pathExpected)
+	}
+
+	// Feed the path back into Value.Set
+	parent := root
+	for _, x := range n.Path[:len(n.Path)-1] {
+		switch x := x.(type) {
+		case string:
+			parent = parent.Get(x)
+		case int:
+			parent = parent.GetArray()[x]
+		}
+	}
+	parent.SetArrayItem(n.Path[len(n.Path)-1].(int), MustParse(`42`))
+	if s := root.String(); s != `{"a":[{"b'\n":1},{"c":[2,42]}]}` {
+		t.Fatalf("unexpected document after update: %s", s)
+	}
+}
+
+func TestNormalizedPath(t *testing.T) {
+	f := func(path []interface{}, sExpected string) {
+		t.Helper()
+		n := &Node{Path: path}
+		if s := n.NormalizedPath(); s != sExpected {
+			t.Fatalf("unexpected normalized path; got %s; want %s", s, sExpected)
+		}
+	}
+
+	f(nil, `$`)
+	f([]interface{}{"a", 0, "b"}, `$['a'][0]['b']`)
+	f([]interface{}{"", 12}, `$[''][12]`)
+	f([]interface{}{"a'b\\c"}, `$['a\'b\\c']`)
+	f([]interface{}{"\b\f\n\r\t\x00\x1f"}, `$['\b\f\n\r\t\u0000\u001f']`)
+	f([]interface{}{"☺\x7f"}, "$['☺\x7f']")
+}
+
+func TestNodeParent(t *testing.T) {
+	root := MustParse(`{"services": {
+		"auth": {"status": "ok"},
+		"billing": {"status": "failed", "error": {"code": 42}},
+		"queue": {"workers": [{"id": 1}, {"id": 2, "error": {"code": 7}}]}
+	}}`)
+
+	for _, c := range []*Compiled{MustCompile(`$..[?(@.error)]`), MustCompileRFC9535(`$..[?@.error]`)} {
+		nodes, err := c.LookupNodes(root)
+		if err != nil {
+			t.Fatalf("unexpected error for %s: %s", c, err)
+		}
+		var found []string
+		for _, n := range nodes {
+			// Climb to the service section holding the error.
+			// Legacy filters may match both an array and its item.
+			for len(n.Path) > 2 {
+				var ok bool
+				if n, ok = n.Parent(); !ok {
+					t.Fatalf("missing parent for %s", n.NormalizedPath())
+				}
+			}
+			key, ok := n.Key()
+			if !ok {
+				t.Fatalf("missing key for %s", n.NormalizedPath())
+			}
+			parent, ok := n.Parent()
+			if !ok || parent.Value != root.Get("services") {
+				t.Fatalf("unexpected parent for %s: %v", n.NormalizedPath(), parent.Value)
+			}
+			if len(found) == 0 || found[len(found)-1] != key {
+				found = append(found, key)
+			}
+		}
+		if s := strings.Join(found, ","); s != "billing,queue" {
+			t.Fatalf("unexpected sections with errors for %s; got %s; want billing,queue", c, s)
+		}
+	}
+
+	nodes, err := MustCompile(`$.services.queue.workers[1].id`).LookupNodes(root)
+	if err != nil || len(nodes) != 1 {
+		t.Fatalf("unexpected result: %v, %v", nodes, err)
+	}
+	n := nodes[0]
+	if key, ok := n.Key(); !ok || key != "id" {
+		t.Fatalf("unexpected key; got %q, %v; want id", key, ok)
+	}
+	if _, ok := n.Index(); ok {
+		t.Fatalf("object member mustn't have index")
+	}
+	item, ok := n.Parent()
+	if !ok || item.Value.String() != `{"id":2,"error":{"code":7}}` {
+		t.Fatalf("unexpected parent: %v", item.Value)
+	}
+	if idx, ok := item.Index(); !ok || idx != 1 {
+		t.Fatalf("unexpected index; got %d, %v; want 1", idx, ok)
+	}
+	if _, ok := item.Key(); ok {
+		t.Fatalf("array item mustn't have key")
+	}
+	if p := item.NormalizedPath(); p != `$['services']['queue']['workers'][1]` {
+		t.Fatalf("unexpected parent path: %s", p)
+	}
+
+	// Climb to the root.
+	depth := 0
+	for {
+		parent, ok := n.Parent()
+		if !ok {
+			break
+		}
+		n = parent
+		depth++
+	}
+	if depth != 5 || n.Value != root || len(n.Path) != 0 {
+		t.Fatalf("unexpected root after climbing %d levels: %v, %v", depth, n.Path, n.Value)
+	}
+	if _, ok := n.Key(); ok {
+		t.Fatalf("root mustn't have key")
+	}
+
+	// Nodes constructed by callers have no parent.
+	if _, ok := (&Node{Path: []interface{}{"a"}}).Parent(); ok {
+		t.Fatalf("constructed node mustn't have parent")
+	}
+}
+
+func TestCompiledLookupNodesDescendantFilterNestedArrays(t *testing.T) {
+	root := MustParse(`{"jobs":[["t1","t2"],{"error":"e1"},[3,[{"error":"e2"}]],[]],"error":"top"}`)
+
+	for _, c := range []*Compiled{MustCompile(`$..[?(@.error)]`), MustCompileRFC9535(`$..[?@.error]`)} {
+		nodes, err := c.LookupNodes(root)
+		if err != nil {
+			t.Fatalf("unexpected error for %s: %s", c, err)
+		}
+		var result []string
+		for _, n := range nodes {
+			parent, ok := n.Parent()
+			if !ok {
+				t.Fatalf("missing parent for %s", n.NormalizedPath())
+			}
+			idx, ok := n.Index()
+			if !ok {
+				t.Fatalf("missing index for %s", n.NormalizedPath())
+			}
+			if _, ok := n.Key(); ok {
+				t.Fatalf("array item %s mustn't have key", n.NormalizedPath())
+			}
+			if parent.Value.Type() != TypeArray || parent.Value.GetArray()[idx] != n.Value {
+				t.Fatalf("unexpected parent for %s: %s", n.NormalizedPath(), parent.Value)
+			}
+			result = append(result, fmt.Sprintf("%s %s %d", n.NormalizedPath(), parent.NormalizedPath(), idx))
+		}
+		resultExpected := "$['jobs'][1] $['jobs'] 1;$['jobs'][2][1][0] $['jobs'][2][1] 0"
+		if s := strings.Join(result, ";"); s != resultExpected {
+			t.Fatalf("unexpected nodes for %s; got %s; want %s", c, s, resultExpected)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package fastjson
+
+import (
+	"container/list"
+	"fmt"
+	"regexp"
+	"sync"
+)
+
+const (
+	// DefaultMaxRegexpLen is the default maximum length in bytes
+	// of regexp patterns in JSONPath filters.
+	DefaultMaxRegexpLen = 1024
+
+	// DefaultMaxRegexps is the default maximum number of distinct
+	// compiled regexps kept in memory.
+	DefaultMaxRegexps = 1024
+)
+
+// RegexpLimits limits regexps used by JSONPath filters, i.e. `=~ /pattern/`
+// in Compile syntax and match() or search() functions.
+//
+// Regexps are compiled once per distinct pattern and are cached,
+// so patterns supplied by users or found in JSON documents cannot
+// exhaust memory when the limits are set.
+type RegexpLimits struct {
+	// MaxLen is the maximum length in bytes of a pattern.
+	//
+	// Compile returns an error for longer patterns in `=~` filters,
+	// while match() and search() return false for them.
+	// There is no limit if MaxLen <= 0.
+	MaxLen int
+
+	// MaxRegexps is the maximum number of distinct compiled regexps
+	// kept in the cache.
+	//
+	// The least recently used regexps are evicted from the cache
+	// when the limit is reached. There is no limit if MaxRegexps <= 0.
+	MaxRegexps int
+}
+
+var regexps = &regexpCache{
+	limits: RegexpLimits{
+		MaxLen:     DefaultMaxRegexpLen,
+		MaxRegexps: DefaultMaxRegexps,
+	},
+	items: make(map[string]*list.Element),
+}
+
+// SetRegexpLimits sets limits for regexps used by JSONPath filters.
+//
+// The limits apply to paths compiled after the call and to match()
+// and search() calls. Regexps exceeding the new MaxRegexps are evicted.
+func SetRegexpLimits(limits RegexpLimits) {
+	rc := regexps
+	rc.mu.Lock()
+	rc.limits = limits
+	rc.evictLocked()
+	rc.mu.Unlock()
+}
+
+// GetRegexpLimits returns the current limits for regexps used by JSONPath filters.
+func GetRegexpLimits() RegexpLimits {
+	rc := regexps
+	rc.mu.Lock()
+	limits := rc.limits
+	rc.mu.Unlock()
+	return limits
+}
+
+// regexpCache is a bounded LRU cache of compiled regexps.
+type regexpCache struct {
+	mu     sync.Mutex
+	limits RegexpLimits
+	lru    list.List
+	items  map[string]*list.Element
+}
+
+type regexpCacheEntry struct {
+	key string
+	re  *regexp.Regexp
+	err error
+}
+
+// compile returns the regexp for the given key.
+//
+// The regexp is compiled from the RE2 expression returned by toRE2
+// if it is missing in the cache. pattern is the original pattern,
+// which is checked against MaxLen. Compilation errors are cached too,
+// since match() and search() may be called with the same invalid
+// pattern for every evaluated node.
+func (rc *regexpCache) compile(key, pattern string, toRE2 func() string) (*regexp.Regexp, error) {
+	rc.mu.Lock()
+	if maxLen := rc.limits.MaxLen; maxLen > 0 && len(pattern) > maxLen {
+		rc.mu.Unlock()
+		return nil, fmt.Errorf("too long regexp pattern: %d bytes; the limit is %d bytes", len(pattern), maxLen)
+	}
+	if e, ok := rc.items[key]; ok {
+		rc.lru.MoveToFront(e)
+		x := e.Value.(*regexpCacheEntry)
+		rc.mu.Unlock()
+		return x.re, x.err
+	}
+	rc.mu.Unlock()
+
+	// Compile outside the lock, since it may be slow for big patterns.
+	re, err := regexp.Compile(toRE2())
+
+	rc.mu.Lock()
+	if e, ok := rc.items[key]; ok {
+		// The regexp has been compiled by concurrent goroutine.
+		rc.lru.MoveToFront(e)
+	} else {
+		rc.items[key] = rc.lru.PushFront(&regexpCacheEntry{
+			key: key,
+			re:  re,
+			err: err,
+		})
+		rc.evictLocked()
+	}
+	rc.mu.Unlock()
+	return re, err
+}
+
+func (rc *regexpCache) evictLocked() {
+	maxRegexps := rc.limits.MaxRegexps
+	if maxRegexps <= 0 {
+		return
+	}
+	for rc.lru.Len() > maxRegexps {
+		e := rc.lru.Back()
+		rc.lru.Remove(e)
+		delete(rc.items, e.Value.(*regexpCacheEntry).key)
+	}
+}
+
+func (rc *regexpCache) len() int {
+	rc.mu.Lock()
+	n := rc.lru.Len()
+	rc.mu.Unlock()
+	return n
+}
@@ -0,0 +1,102 @@
+package fastjson
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestFilterRegexpFlags(t *testing.T) {
+	root := MustParse(`[
+		{"id": 1, "s": "Nigel Rees"},
+		{"id": 2, "s": "NIGEL REES"},
+		{"id": 3, "s": "foo\nrees"},
+		{"id": 4, "s": "bar"}
+	]`)
+
+	f := func(path, resultExpected string) {
+		t.Helper()
+		c, err := Compile(path)
+		if err != nil {
+			t.Fatalf("cannot compile %s: %s", path, err)
+		}
+		v, err := c.Lookup(root)
+		if err != nil {
+			t.Fatalf("unexpected error for %s: %s", path, err)
+		}
+		if result := v.String(); result != resultExpected {
+			t.Fatalf("unexpected result for %s; got %s; want %s", path, result, resultExpected)
+		}
+	}
+
+	f(`$[?(@.s =~ /.*REES/)].id`, `[2]`)
+	f(`$[?(@.s =~ /.*REES/i)].id`, `[1,2,3]`)
+	f(`$[?(@.s =~ /^rees/)].id`, `[]`)
+	f(`$[?(@.s =~ /^rees/m)].id`, `[3]`)
+	f(`$[?(@.s =~ /foo.rees/)].id`, `[]`)
+	f(`$[?(@.s =~ /foo.rees/s)].id`, `[3]`)
+	f(`$[?(@.s =~ /^REES$/im)].id`, `[3]`)
+	f(`$[?(@.s =~ /a/b/)].id`, `[]`)
+	f(`$[?(@.s =~ /a b/)].id`, `[]`)
+
+	for _, path := range []string{
+		`$[?(@.s =~ /x/g)]`,
+		`$[?(@.s =~ /x/I)]`,
+		`$[?(@.s =~ //)]`,
+	} {
+		if _, err := Compile(path); err == nil {
+			t.Fatalf("expecting non-nil error for %s", path)
+		}
+	}
+}
+
+func TestRegexpLimits(t *testing.T) {
+	defer SetRegexpLimits(GetRegexpLimits())
+
+	SetRegexpLimits(RegexpLimits{
+		MaxLen:     10,
+		MaxRegexps: 3,
+	})
+	if n := regexps.len(); n > 3 {
+		t.Fatalf("unexpected number of cached regexps after lowering the limit; got %d; want up to 3", n)
+	}
+
+	// too long patterns
+	_, err := Compile(`$[?(@.s =~ /` + strings.Repeat("a", 11) + `/)]`)
+	if err == nil || !strings.Contains(err.Error(), "too long regexp pattern: 11 bytes; the limit is 10 bytes") {
+		t.Fatalf("unexpected error for too long pattern: %v", err)
+	}
+	if _, err := Compile(`$[?(@.s =~ /` + strings.Repeat("a", 10) + `/i)]`); err != nil {
+		t.Fatalf("unexpected error for pattern at the limit: %s", err)
+	}
+	root := MustParse(`[{"s": "aaaaaaaaaaa", "p": "a+"}, {"s": "aaaaaaaaaaa", "p": "aaaaaaaaaaa"}]`)
+	v, err := MustCompileRFC9535(`$[?match(@.s, @.p)]`).Lookup(root)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(v.GetArray()) != 1 {
+		t.Fatalf("match() must be false for too long patterns; got %s", v)
+	}
+
+	// the number of cached regexps is bounded
+	for i := 0; i < 10; i++ {
+		MustCompile(fmt.Sprintf(`$[?(@.s =~ /a%d/)]`, i))
+		if n := regexps.len(); n > 3 {
+			t.Fatalf("unexpected number of cached regexps; got %d; want up to 3", n)
+		}
+	}
+	c := MustCompile(`$[?(@.s =~ /a0/)]`)
+	if _, err := c.Lookup(MustParse(`[{"s": "a0"}]`)); err != nil {
+		t.Fatalf("unexpected error for recompiled regexp: %s", err)
+	}
+
+	// no limits
+	SetRegexpLimits(RegexpLimits{})
+	MustCompile(`$[?(@.s =~ /` + strings.Repeat("a", 2000) + `/)]`)
+	for i := 0; i < 10; i++ {
+		MustCompile(fmt.Sprintf(`$[?(@.s =~ /b%d/)]`, i))
+	}
+	if n := regexps.len(); n < 10 {
+		t.Fatalf("unexpected number of cached regexps without limits; got %d; want at least 10", n)
+	}
+}
@@ -0,0 +1,1057 @@
+package fastjson
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// CompileRFC9535 compiles jpath according to RFC 9535 (JSONPath: Query
+// Expressions for JSON).
+//
+// Unlike Compile, the returned query follows the standard grammar and
+// semantics: filters select children of the current node, `?` filters
+// don't need parentheses, names may be single- or double-quoted, `!`
+// negates filter expressions and the standard function extensions
+// length, count, match, search and value are available together with
+// the functions registered via RegisterFunction.
+//
+// Lookup on the returned query always returns an array holding the
+// resulting nodelist.
+func CompileRFC9535(jpath string) (*Compiled, error) {
+	p := &rfcParser{s: jpath}
+	q, err := p.parseRootQuery()
+	if err != nil {
+		return nil, err
+	}
+	return &Compiled{path: jpath, query: q}, nil
+}
+
+// MustCompileRFC9535 is like CompileRFC9535 but panics if jpath cannot
+// be compiled.
+func MustCompileRFC9535(jpath string) *Compiled {
+	c, err := CompileRFC9535(jpath)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// maxSafeInt is the largest integer which may be used as an index or
+// slice bound, see I-JSON (RFC 7493).
+const maxSafeInt = 1<<53 - 1
+
+// rfcQuery is a compiled RFC 9535 query.
+type rfcQuery struct {
+	// relative is true for queries starting with `@`.
+	relative bool
+	segments []rfcSegment
+}
+
+type rfcSegment struct {
+	descendant bool
+	selectors  []rfcSelector
+}
+
+type selectorKind int
+
+const (
+	selectorName selectorKind = iota
+	selectorWildcard
+	selectorIndex
+	selectorSlice
+	selectorFilter
+)
+
+type rfcSelector struct {
+	kind   selectorKind
+	name   string
+	index  int
+	slice  sliceBounds
+	filter logicalExpr
+}
+
+type sliceBounds struct {
+	start, end, step          int
+	hasStart, hasEnd, hasStep bool
+}
+
+// singular returns true if q selects at most one node.
+func (q *rfcQuery) singular() bool {
+	for _, seg := range q.segments {
+		if seg.descendant || len(seg.selectors) != 1 {
+			return false
+		}
+		if k := seg.selectors[0].kind; k != selectorName && k != selectorIndex {
+			return false
+		}
+	}
+	return true
+}
+
+func (q *rfcQuery) lookup(root *Value) *Value {
+	nodes := q.selectNodes(root, node{v: root}, false, nil)
+	a := make([]*Value, len(nodes))
+	for i, n := range nodes {
+		a[i] = n.v
+	}
+	return &Value{a: a, t: TypeArray}
+}
+
+// eval returns the values of the nodelist selected by q. cur is the node `@` refers to.
+func (q *rfcQuery) eval(root, cur *Value, lim *evalLimiter) []*Value {
+	nodes := q.selectNodes(root, node{v: cur}, false, lim)
+	if len(nodes) == 0 {
+		return nil
+	}
+	a := make([]*Value, len(nodes))
+	for i, n := range nodes {
+		a[i] = n.v
+	}
+	return a
+}
+
+// selectNodes returns the nodelist selected by q. cur is the node `@` refers to.
+//
+// Node locations are tracked only if paths is set.
+//
+// The evaluation stops when lim is exceeded. The caller must check lim.exceeded() then.
+func (q *rfcQuery) selectNodes(root *Value, cur node, paths bool, lim *evalLimiter) []node {
+	nodes := []node{{v: root}}
+	if q.relative {
+		nodes[0] = cur
+	}
+	for i := range q.segments {
+		if nodes = q.segments[i].selectNodes(nodes, root, paths, lim); len(nodes) == 0 || lim.exceeded() {
+			return nil
+		}
+	}
+	return nodes
+}
+
+// selectNodes returns the nodelist selected by seg from nodes.
+func (seg *rfcSegment) selectNodes(nodes []node, root *Value, paths bool, lim *evalLimiter) []node {
+	var res []node
+	for _, n := range nodes {
+		if seg.descendant {
+			for _, d := range walk_descendants(nil, n, paths, lim) {
+				res = seg.selectChildren(res, d, root, paths, lim)
+				if !lim.selected(seg, len(res)) {
+					return nil
+				}
+			}
+		} else {
+			res = seg.selectChildren(res, n, root, paths, lim)
+		}
+		if !lim.selected(seg, len(res)) {
+			return nil
+		}
+	}
+	return res
+}
+
+func (seg *rfcSegment) selectChildren(dst []node, n node, root *Value, paths bool, lim *evalLimiter) []node {
+	for i := range seg.selectors {
+		k := len(dst)
+		dst = seg.selectors[i].apply(dst, n, root, paths, lim)
+		if !lim.visit(len(dst) - k) {
+			break
+		}
+	}
+	return dst
+}
+
+func (sel *rfcSelector) apply(dst []node, n node, root *Value, paths bool, lim *evalLimiter) []node {
+	v := n.v
+	switch sel.kind {
+	case selectorName:
+		if v.t == TypeObject {
+			if x := v.o.Get(sel.name); x != nil {
+				dst = append(dst, n.member(sel.name, x, paths))
+			}
+		}
+	case selectorWildcard:
+		dst = append(dst, children(n, paths)...)
+	case selectorIndex:
+		if v.t == TypeArray {
+			idx := sel.index
+			if idx < 0 {
+				idx += len(v.a)
+			}
+			if idx >= 0 && idx < len(v.a) {
+				dst = append(dst, n.element(idx, paths))
+			}
+		}
+	case selectorSlice:
+		if v.t == TypeArray {
+			sel.slice.visit(len(v.a), func(i int) {
+				dst = append(dst, n.element(i, paths))
+			})
+		}
+	case selectorFilter:
+		for _, c := range children(n, paths) {
+			if !lim.visit(1) {
+				break
+			}
+			if sel.filter.evalLogical(root, c.v, lim) {
+				dst = append(dst, c)
+			}
+		}
+	}
+	return dst
+}
+
+// visit calls f for every index selected by the slice from an array
+// with the given length, in selection order.
+func (b *sliceBounds) visit(length int, f func(i int)) {
+	step := 1
+	if b.hasStep {
+		step = b.step
+	}
+	if step == 0 {
+		return
+	}
+
+	normalize := func(i int) int {
+		if i >= 0 {
+			return i
+		}
+		return length + i
+	}
+	clamp := func(i, lo, hi int) int {
+		if i < lo {
+			return lo
+		}
+		if i > hi {
+			return hi
+		}
+		return i
+	}
+
+	if step > 0 {
+		start, end := 0, length
+		if b.hasStart {
+			start = normalize(b.start)
+		}
+		if b.hasEnd {
+			end = normalize(b.end)
+		}
+		lower, upper := clamp(start, 0, length), clamp(end, 0, length)
+		for i := lower; i < upper; i += step {
+			f(i)
+		}
+		return
+	}
+
+	start, end := length-1, -length-1
+	if b.hasStart {
+		start = normalize(b.start)
+	}
+	if b.hasEnd {
+		end = normalize(b.end)
+	}
+	upper, lower := clamp(start, -1, length-1), clamp(end, -1, length-1)
+	for i := upper; lower < i; i += step {
+		f(i)
+	}
+}
+
+// logicalExpr is a filter expression producing LogicalType.
+type logicalExpr interface {
+	evalLogical(root, cur *Value, lim *evalLimiter) bool
+}
+
+// valueExpr is a filter expression producing ValueType.
+//
+// evalValue returns nil for Nothing.
+type valueExpr interface {
+	evalValue(root, cur *Value, lim *evalLimiter) *Value
+}
+
+type orExpr []logicalExpr
+
+func (e orExpr) evalLogical(root, cur *Value, lim *evalLimiter) bool {
+	for _, x := range e {
+		if x.evalLogical(root, cur, lim) {
+			return true
+		}
+	}
+	return false
+}
+
+type andExpr []logicalExpr
+
+func (e andExpr) evalLogical(root, cur *Value, lim *evalLimiter) bool {
+	for _, x := range e {
+		if !x.evalLogical(root, cur, lim) {
+			return false
+		}
+	}
+	return true
+}
+
+type notExpr struct {
+	x logicalExpr
+}
+
+func (e notExpr) evalLogical(root, cur *Value, lim *evalLimiter) bool {
+	return !e.x.evalLogical(root, cur, lim)
+}
+
+type comparisonExpr struct {
+	left, right valueExpr
+	op          string
+}
+
+func (e *comparisonExpr) evalLogical(root, cur *Value, lim *evalLimiter) bool {
+	return compareNothing(e.left.evalValue(root, cur, lim), e.right.evalValue(root, cur, lim), e.op)
+}
+
+// compareNothing compares v1 and v2 where nil stands for Nothing.
+//
+// Nothing is equal only to Nothing.
+func compareNothing(v1, v2 *Value, op string) bool {
+	if v1 == nil || v2 == nil {
+		switch op {
+		case "==", "<=", ">=":
+			return v1 == v2
+		case "!=":
+			return v1 != v2
+		default:
+			return false
+		}
+	}
+	ok, _ := cmp_any(v1, v2, op)
+	return ok
+}
+
+type literalExpr struct {
+	v *Value
+}
+
+func (e literalExpr) evalValue(root, cur *Value, lim *evalLimiter) *Value {
+	return e.v
+}
+
+// queryExpr is an embedded query. It is used as an existence test,
+// as a singular query producing a value or as a nodelist.
+type queryExpr struct {
+	q *rfcQuery
+}
+
+func (e queryExpr) evalLogical(root, cur *Value, lim *evalLimiter) bool {
+	return len(e.q.selectNodes(root, node{v: cur}, false, lim)) > 0
+}
+
+func (e queryExpr) evalValue(root, cur *Value, lim *evalLimiter) *Value {
+	nodes := e.q.selectNodes(root, node{v: cur}, false, lim)
+	if len(nodes) != 1 {
+		return nil
+	}
+	return nodes[0].v
+}
+
+// nodesExpr is a filter expression producing NodesType.
+type nodesExpr interface {
+	evalNodes(root, cur *Value, lim *evalLimiter) []*Value
+}
+
+func (e queryExpr) evalNodes(root, cur *Value, lim *evalLimiter) []*Value {
+	return e.q.eval(root, cur, lim)
+}
+
+// funcExpr is a function extension call.
+type funcExpr struct {
+	name string
+	fn   *Function
+	args []interface{}
+}
+
+func (e *funcExpr) call(root, cur *Value, lim *evalLimiter) FuncValue {
+	args := make([]FuncValue, len(e.args))
+	for i, arg := range e.args {
+		switch e.fn.Params[i] {
+		case FuncTypeValue:
+			args[i].Value = arg.(valueExpr).evalValue(root, cur, lim)
+		case FuncTypeLogical:
+			args[i].Logical = arg.(logicalExpr).evalLogical(root, cur, lim)
+		case FuncTypeNodes:
+			args[i].Nodes = arg.(nodesExpr).evalNodes(root, cur, lim)
+		}
+	}
+	return e.fn.Call(args)
+}
+
+func (e *funcExpr) evalValue(root, cur *Value, lim *evalLimiter) *Value {
+	return e.call(root, cur, lim).Value
+}
+
+func (e *funcExpr) evalLogical(root, cur *Value, lim *evalLimiter) bool {
+	res := e.call(root, cur, lim)
+	if e.fn.Result == FuncTypeNodes {
+		return len(res.Nodes) > 0
+	}
+	return res.Logical
+}
+
+func (e *funcExpr) evalNodes(root, cur *Value, lim *evalLimiter) []*Value {
+	return e.call(root, cur, lim).Nodes
+}
+
+// rfcParser parses RFC 9535 queries.
+type rfcParser struct {
+	s   string
+	pos int
+
+	// vars enables `$$name` placeholders in function arguments.
+	// It is set only for function calls in filters compiled by Compile.
+	vars *filterVars
+}
+
+func (p *rfcParser) errorf(format string, args ...interface{}) error {
+	return newPathSyntaxError(p.s, p.pos, "", fmt.Sprintf(format, args...))
+}
+
+// expected returns an error for unexpected token at the current position.
+func (p *rfcParser) expected(what string) error {
+	return newPathSyntaxError(p.s, p.pos, what, "")
+}
+
+func (p *rfcParser) eof() bool {
+	return p.pos >= len(p.s)
+}
+
+func (p *rfcParser) peek() byte {
+	if p.pos >= len(p.s) {
+		return 0
+	}
+	return p.s[p.pos]
+}
+
+func (p *rfcParser) skipBlank() {
+	for p.pos < len(p.s) {
+		switch p.s[p.pos] {
+		case ' ', '\t', '\n', '\r':
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (p *rfcParser) parseRootQuery() (*rfcQuery, error) {
+	if p.peek() != '$' {
+		return nil, p.expected("'$'")
+	}
+	p.pos++
+	q := &rfcQuery{}
+	if err := p.parseSegments(q); err != nil {
+		return nil, err
+	}
+	if !p.eof() {
+		return nil, p.expected("end of path")
+	}
+	return q, nil
+}
+
+func (p *rfcParser) parseSegments(q *rfcQuery) error {
+	for {
+		start := p.pos
+		p.skipBlank()
+		switch p.peek() {
+		case '[':
+			sels, err := p.parseBracketed()
+			if err != nil {
+				return err
+			}
+			q.segments = append(q.segments, rfcSegment{selectors: sels})
+		case '.':
+			p.pos++
+			descendant := false
+			if p.peek() == '.' {
+				p.pos++
+				descendant = true
+			}
+			var sels []rfcSelector
+			switch c := p.peek(); {
+			case c == '[' && descendant:
+				var err error
+				if sels, err = p.parseBracketed(); err != nil {
+					return err
+				}
+			case c == '*':
+				p.pos++
+				sels = []rfcSelector{{kind: selectorWildcard}}
+			default:
+				name, ok := p.parseMemberName()
+				if !ok {
+					return p.expected("member name, '*' or '[' after '.'")
+				}
+				sels = []rfcSelector{{kind: selectorName, name: name}}
+			}
+			q.segments = append(q.segments, rfcSegment{descendant: descendant, selectors: sels})
+		default:
+			// Leave the trailing blank space to the caller.
+			p.pos = start
+			return nil
+		}
+	}
+}
+
+// parseMemberName parses member-name-shorthand.
+func (p *rfcParser) parseMemberName() (string, bool) {
+	start := p.pos
+	for p.pos < len(p.s) {
+		r, size := utf8.DecodeRuneInString(p.s[p.pos:])
+		isFirst := r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') ||
+			(r >= 0x80 && r != utf8.RuneError && (r <= 0xD7FF || r >= 0xE000))
+		if !isFirst && (p.pos == start || r < '0' || r > '9') {
+			break
+		}
+		p.pos += size
+	}
+	return p.s[start:p.pos], p.pos > start
+}
+
+func (p *rfcParser) parseBracketed() ([]rfcSelector, error) {
+	// skip '['
+	p.pos++
+	var sels []rfcSelector
+	for {
+		p.skipBlank()
+		sel, err := p.parseSelector()
+		if err != nil {
+			return nil, err
+		}
+		sels = append(sels, sel)
+		p.skipBlank()
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case ']':
+			p.pos++
+			return sels, nil
+		default:
+			return nil, p.expected("',' or ']'")
+		}
+	}
+}
+
+func (p *rfcParser) parseSelector() (rfcSelector, error) {
+	switch c := p.peek(); {
+	case c == '\'' || c == '"':
+		name, err := p.parseStringLiteral()
+		if err != nil {
+			return rfcSelector{}, err
+		}
+		return rfcSelector{kind: selectorName, name: name}, nil
+	case c == '*':
+		p.pos++
+		return rfcSelector{kind: selectorWildcard}, nil
+	case c == '?':
+		p.pos++
+		p.skipBlank()
+		x, err := p.parseLogicalOr()
+		if err != nil {
+			return rfcSelector{}, err
+		}
+		return rfcSelector{kind: selectorFilter, filter: x}, nil
+	case c == '-' || c == ':' || (c >= '0' && c <= '9'):
+		return p.parseIndexOrSlice()
+	default:
+		return rfcSelector{}, p.expected("selector")
+	}
+}
+
+func (p *rfcParser) parseIndexOrSlice() (rfcSelector, error) {
+	var b sliceBounds
+	var err error
+	if p.peek() != ':' {
+		if b.start, err = p.parseInt(); err != nil {
+			return rfcSelector{}, err
+		}
+		b.hasStart = true
+		start := p.pos
+		p.skipBlank()
+		if p.peek() != ':' {
+			p.pos = start
+			return rfcSelector{kind: selectorIndex, index: b.start}, nil
+		}
+	}
+
+	// skip ':'
+	p.pos++
+	p.skipBlank()
+	if c := p.peek(); c == '-' || (c >= '0' && c <= '9') {
+		if b.end, err = p.parseInt(); err != nil {
+			return rfcSelector{}, err
+		}
+		b.hasEnd = true
+		p.skipBlank()
+	}
+	if p.peek() == ':' {
+		p.pos++
+		p.skipBlank()
+		if c := p.peek(); c == '-' || (c >= '0' && c <= '9') {
+			if b.step, err = p.parseInt(); err != nil {
+				return rfcSelector{}, err
+			}
+			b.hasStep = true
+		}
+	}
+	return rfcSelector{kind: selectorSlice, slice: b}, nil
+}
+
+// parseInt parses an integer in the I-JSON range without leading zeros.
+func (p *rfcParser) parseInt() (int, error) {
+	start := p.pos
+	if p.peek() == '-' {
+		p.pos++
+	}
+	digits := p.pos
+	for p.pos < len(p.s) && p.s[p.pos] >= '0' && p.s[p.pos] <= '9' {
+		p.pos++
+	}
+	s := p.s[start:p.pos]
+	switch {
+	case p.pos == digits:
+		return 0, p.expected("integer")
+	case p.s[digits] == '0' && (p.pos-digits > 1 || digits > start):
+		return 0, p.errorf("invalid integer %q", s)
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n > maxSafeInt || n < -maxSafeInt {
+		return 0, p.errorf("integer %s is out of range", s)
+	}
+	return int(n), nil
+}
+
+// parseStringLiteral parses a single- or double-quoted string literal
+// and returns its unescaped value.
+func (p *rfcParser) parseStringLiteral() (string, error) {
+	quote := p.s[p.pos]
+	p.pos++
+	var b []byte
+	for {
+		if p.eof() {
+			return "", p.expected(fmt.Sprintf("closing %c", quote))
+		}
+		c := p.s[p.pos]
+		switch {
+		case c == quote:
+			p.pos++
+			return string(b), nil
+		case c < 0x20:
+			return "", p.errorf("control character %q must be escaped", c)
+		case c == '\\':
+			start := p.pos
+			p.pos++
+			if p.eof() {
+				return "", p.expected("escape sequence")
+			}
+			e := p.s[p.pos]
+			p.pos++
+			switch e {
+			case 'b':
+				b = append(b, '\b')
+			case 'f':
+				b = append(b, '\f')
+			case 'n':
+				b = append(b, '\n')
+			case 'r':
+				b = append(b, '\r')
+			case 't':
+				b = append(b, '\t')
+			case '/', '\\':
+				b = append(b, e)
+			case '\'', '"':
+				if e != quote {
+					return "", p.errorfAt(start, `invalid escape sequence \%c`, e)
+				}
+				b = append(b, e)
+			case 'u':
+				r, err := p.parseUnicodeEscape()
+				if err != nil {
+					return "", err
+				}
+				var buf [utf8.UTFMax]byte
+				n := utf8.EncodeRune(buf[:], r)
+				b = append(b, buf[:n]...)
+			default:
+				return "", p.errorfAt(start, `invalid escape sequence \%c`, e)
+			}
+		case c < utf8.RuneSelf:
+			b = append(b, c)
+			p.pos++
+		default:
+			r, size := utf8.DecodeRuneInString(p.s[p.pos:])
+			if r == utf8.RuneError && size == 1 {
+				return "", p.errorf("invalid UTF-8")
+			}
+			b = append(b, p.s[p.pos:p.pos+size]...)
+			p.pos += size
+		}
+	}
+}
+
+// parseUnicodeEscape parses the hex part of \uXXXX including a possible
+// trailing low surrogate escape.
+func (p *rfcParser) parseUnicodeEscape() (rune, error) {
+	r, err := p.parseHex4()
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case r >= 0xDC00 && r <= 0xDFFF:
+		return 0, p.errorf("unexpected low surrogate")
+	case r >= 0xD800 && r <= 0xDBFF:
+		if !strings.HasPrefix(p.s[p.pos:], `\u`) {
+			return 0, p.expected(`low surrogate \uXXXX`)
+		}
+		p.pos += 2
+		r2, err := p.parseHex4()
+		if err != nil {
+			return 0, err
+		}
+		if r2 < 0xDC00 || r2 > 0xDFFF {
+			return 0, p.errorf("invalid low surrogate")
+		}
+		return 0x10000 + (r-0xD800)<<10 + (r2 - 0xDC00), nil
+	}
+	return r, nil
+}
+
+func (p *rfcParser) parseHex4() (rune, error) {
+	if len(p.s)-p.pos < 4 {
+		return 0, p.expected("4 hex digits")
+	}
+	n, err := strconv.ParseUint(p.s[p.pos:p.pos+4], 16, 32)
+	if err != nil {
+		return 0, p.expected("4 hex digits")
+	}
+	p.pos += 4
+	return rune(n), nil
+}
+
+func (p *rfcParser) parseLogicalOr() (logicalExpr, error) {
+	x, err := p.parseLogicalAnd()
+	if err != nil {
+		return nil, err
+	}
+	or := orExpr{x}
+	for {
+		start := p.pos
+		p.skipBlank()
+		if !strings.HasPrefix(p.s[p.pos:], "||") {
+			p.pos = start
+			break
+		}
+		p.pos += 2
+		p.skipBlank()
+		if x, err = p.parseLogicalAnd(); err != nil {
+			return nil, err
+		}
+		or = append(or, x)
+	}
+	if len(or) == 1 {
+		return or[0], nil
+	}
+	return or, nil
+}
+
+func (p *rfcParser) parseLogicalAnd() (logicalExpr, error) {
+	x, err := p.parseBasic()
+	if err != nil {
+		return nil, err
+	}
+	and := andExpr{x}
+	for {
+		start := p.pos
+		p.skipBlank()
+		if !strings.HasPrefix(p.s[p.pos:], "&&") {
+			p.pos = start
+			break
+		}
+		p.pos += 2
+		p.skipBlank()
+		if x, err = p.parseBasic(); err != nil {
+			return nil, err
+		}
+		and = append(and, x)
+	}
+	if len(and) == 1 {
+		return and[0], nil
+	}
+	return and, nil
+}
+
+func (p *rfcParser) parseBasic() (logicalExpr, error) {
+	switch p.peek() {
+	case '!':
+		p.pos++
+		p.skipBlank()
+		var x logicalExpr
+		var err error
+		if p.peek() == '(' {
+			x, err = p.parseParen()
+		} else {
+			x, err = p.parseTest()
+		}
+		if err != nil {
+			return nil, err
+		}
+		return notExpr{x}, nil
+	case '(':
+		return p.parseParen()
+	}
+
+	start := p.pos
+	x, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	p.skipBlank()
+	op := p.parseComparisonOp()
+	if op == "" {
+		p.pos = start
+		return p.parseTest()
+	}
+	p.skipBlank()
+	left, err := p.comparable(x, start)
+	if err != nil {
+		return nil, err
+	}
+	rightStart := p.pos
+	y, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	right, err := p.comparable(y, rightStart)
+	if err != nil {
+		return nil, err
+	}
+	return &comparisonExpr{left: left, right: right, op: op}, nil
+}
+
+func (p *rfcParser) parseParen() (logicalExpr, error) {
+	// skip '('
+	p.pos++
+	p.skipBlank()
+	x, err := p.parseLogicalOr()
+	if err != nil {
+		return nil, err
+	}
+	p.skipBlank()
+	if p.peek() != ')' {
+		return nil, p.expected("')'")
+	}
+	p.pos++
+	return x, nil
+}
+
+// parseTest parses test-expr without the leading negation.
+func (p *rfcParser) parseTest() (logicalExpr, error) {
+	x, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	switch x := x.(type) {
+	case queryExpr:
+		return x, nil
+	case *funcExpr:
+		if x.fn.Result == FuncTypeValue {
+			return nil, p.errorf("result of %s() must be compared", x.name)
+		}
+		return x, nil
+	default:
+		return nil, p.errorf("literal must be compared")
+	}
+}
+
+func (p *rfcParser) parseComparisonOp() string {
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if strings.HasPrefix(p.s[p.pos:], op) {
+			p.pos += len(op)
+			return op
+		}
+	}
+	return ""
+}
+
+// comparable checks that x may be used in a comparison.
+func (p *rfcParser) comparable(x interface{}, pos int) (valueExpr, error) {
+	switch x := x.(type) {
+	case literalExpr:
+		return x, nil
+	case queryExpr:
+		if !x.q.singular() {
+			return nil, p.errorfAt(pos, "non-singular query cannot be compared")
+		}
+		return x, nil
+	case *funcExpr:
+		if x.fn.Result != FuncTypeValue {
+			return nil, p.errorfAt(pos, "result of %s() cannot be compared", x.name)
+		}
+		return x, nil
+	default:
+		return nil, p.errorfAt(pos, "invalid comparable")
+	}
+}
+
+func (p *rfcParser) errorfAt(pos int, format string, args ...interface{}) error {
+	p.pos = pos
+	return p.errorf(format, args...)
+}
+
+// parsePrimary parses a literal, an embedded query or a function call.
+func (p *rfcParser) parsePrimary() (interface{}, error) {
+	switch c := p.peek(); {
+	case c == '$' && p.vars != nil && strings.HasPrefix(p.s[p.pos:], "$$"):
+		return p.parseVar()
+	case c == '@' || c == '$':
+		p.pos++
+		q := &rfcQuery{relative: c == '@'}
+		if err := p.parseSegments(q); err != nil {
+			return nil, err
+		}
+		return queryExpr{q}, nil
+	case c == '\'' || c == '"':
+		s, err := p.parseStringLiteral()
+		if err != nil {
+			return nil, err
+		}
+		return literalExpr{&Value{s: s, t: TypeString}}, nil
+	case c == '-' || (c >= '0' && c <= '9'):
+		return p.parseNumber()
+	case c >= 'a' && c <= 'z':
+		start := p.pos
+		for p.pos < len(p.s) && isFunctionNameChar(p.s[p.pos]) {
+			p.pos++
+		}
+		name := p.s[start:p.pos]
+		if p.peek() == '(' {
+			return p.parseFunction(name, start)
+		}
+		switch name {
+		case "true":
+			return literalExpr{valueTrue}, nil
+		case "false":
+			return literalExpr{valueFalse}, nil
+		case "null":
+			return literalExpr{valueNull}, nil
+		}
+		return nil, p.errorfAt(start, "unexpected %q", name)
+	default:
+		return nil, p.expected("filter expression")
+	}
+}
+
+func (p *rfcParser) parseNumber() (interface{}, error) {
+	start := p.pos
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		if (c < '0' || c > '9') && c != '-' && c != '+' && c != '.' && c != 'e' && c != 'E' {
+			break
+		}
+		p.pos++
+	}
+	s := p.s[start:p.pos]
+	if tail, err := validateNumber(s); err != nil || len(tail) > 0 {
+		return nil, p.errorfAt(start, "invalid number %q", s)
+	}
+	return literalExpr{&Value{s: s, t: TypeNumber}}, nil
+}
+
+func (p *rfcParser) parseFunction(name string, start int) (interface{}, error) {
+	fn := lookupFunction(name)
+	if fn == nil {
+		return nil, p.errorfAt(start, "unknown function %s()", name)
+	}
+	e := &funcExpr{name: name, fn: fn}
+
+	// skip '('
+	p.pos++
+	p.skipBlank()
+	if p.peek() == ')' {
+		p.pos++
+	} else {
+		for {
+			argStart := p.pos
+			arg, err := p.parseFunctionArg()
+			if err != nil {
+				return nil, err
+			}
+			if len(e.args) >= len(fn.Params) {
+				return nil, p.errorfAt(argStart, "too many arguments for %s()", name)
+			}
+			if arg, err = p.checkArg(arg, fn.Params[len(e.args)], argStart); err != nil {
+				return nil, err
+			}
+			e.args = append(e.args, arg)
+			p.skipBlank()
+			if p.peek() == ')' {
+				p.pos++
+				break
+			}
+			if p.peek() != ',' {
+				return nil, p.expected("',' or ')'")
+			}
+			p.pos++
+			p.skipBlank()
+		}
+	}
+	if len(e.args) != len(fn.Params) {
+		return nil, p.errorfAt(start, "%s() expects %d arguments, got %d", name, len(fn.Params), len(e.args))
+	}
+	return e, nil
+}
+
+func (p *rfcParser) parseFunctionArg() (interface{}, error) {
+	if c := p.peek(); c == '!' || c == '(' {
+		return p.parseLogicalOr()
+	}
+	start := p.pos
+	x, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	end := p.pos
+	p.skipBlank()
+	if c := p.peek(); c == ',' || c == ')' {
+		p.pos = end
+		return x, nil
+	}
+	p.pos = start
+	return p.parseLogicalOr()
+}
+
+// checkArg checks that arg is well-typed for the parameter of type t.
+func (p *rfcParser) checkArg(arg interface{}, t FuncType, pos int) (interface{}, error) {
+	switch t {
+	case FuncTypeValue:
+		return p.comparable(arg, pos)
+	case FuncTypeLogical:
+		switch x := arg.(type) {
+		case literalExpr:
+			return nil, p.errorfAt(pos, "literal cannot be used as LogicalType")
+		case *funcExpr:
+			if x.fn.Result == FuncTypeValue {
+				return nil, p.errorfAt(pos, "result of %s() cannot be used as LogicalType", x.name)
+			}
+		}
+		return arg, nil
+	case FuncTypeNodes:
+		switch x := arg.(type) {
+		case queryExpr:
+			return x, nil
+		case *funcExpr:
+			if x.fn.Result == FuncTypeNodes {
+				return x, nil
+			}
+		}
+		return nil, p.errorfAt(pos, "argument must be a query")
+	default:
+		return nil, p.errorfAt(pos, "unknown parameter type %s", t)
+	}
+}
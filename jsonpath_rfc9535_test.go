@@ -0,0 +1,109 @@
+package fastjson
+
+import (
+	"os"
+	"testing"
+)
+
+// rfc9535KnownFailures contains the names of compliance cases, which don't pass yet,
+// mapped to the reason. These cases are skipped by TestRFC9535Compliance.
+var rfc9535KnownFailures = map[string]string{}
+
+func TestRFC9535Compliance(t *testing.T) {
+	data, err := os.ReadFile("testdata/jsonpath-compliance/cts.json")
+	if err != nil {
+		t.Fatalf("cannot read compliance suite: %s", err)
+	}
+	var p Parser
+	suite, err := p.ParseBytes(data)
+	if err != nil {
+		t.Fatalf("cannot parse compliance suite: %s", err)
+	}
+	for _, tc := range suite.GetArray("tests") {
+		tc := tc
+		name := string(tc.GetStringBytes("name"))
+		t.Run(name, func(t *testing.T) {
+			if reason, ok := rfc9535KnownFailures[name]; ok {
+				t.Skipf("known failure: %s", reason)
+			}
+			testRFC9535ComplianceCase(t, tc)
+		})
+	}
+}
+
+func testRFC9535ComplianceCase(t *testing.T, tc *Value) {
+	t.Helper()
+
+	selector := string(tc.GetStringBytes("selector"))
+	c, err := CompileRFC9535(selector)
+	if tc.GetBool("invalid_selector") {
+		if err == nil {
+			t.Errorf("expecting error when compiling %q", selector)
+		}
+		return
+	}
+	if err != nil {
+		t.Errorf("unexpected error when compiling %q: %s", selector, err)
+		return
+	}
+	res, err := c.Lookup(tc.Get("document"))
+	if err != nil {
+		t.Errorf("unexpected error when evaluating %q: %s", selector, err)
+		return
+	}
+	var expected []*Value
+	if r := tc.Get("result"); r != nil {
+		expected = append(expected, r)
+	} else {
+		expected = tc.GetArray("results")
+	}
+	for _, e := range expected {
+		if equal_value(res, e) {
+			return
+		}
+	}
+	t.Errorf("unexpected result for %q; got %s; want one of %s", selector, res, expected)
+}
+
+func TestRFC9535Singular(t *testing.T) {
+	root := MustParse(`{"a":{"b":[1,2,3]},"c":null}`)
+
+	f := func(jpath, resultExpected string, exists bool) {
+		t.Helper()
+		c := MustCompileRFC9535(jpath)
+		res, err := c.Lookup(root)
+		if err != nil {
+			t.Fatalf("unexpected error when evaluating %q: %s", jpath, err)
+		}
+		if s := res.String(); s != resultExpected {
+			t.Fatalf("unexpected result for %q; got %s; want %s", jpath, s, resultExpected)
+		}
+		if c.Exists(root) != exists {
+			t.Fatalf("unexpected Exists(%q) result; want %v", jpath, exists)
+		}
+	}
+
+	f(`$.a.b[1]`, `[2]`, true)
+	f(`$.c`, `[null]`, true)
+	f(`$.a.b[5]`, `[]`, false)
+	f(`$.a.b[?@ > 1]`, `[2,3]`, true)
+	f(`$..b[-1:]`, `[3]`, true)
+}
+
+func TestRFC9535Error(t *testing.T) {
+	f := func(jpath string) {
+		t.Helper()
+		if _, err := CompileRFC9535(jpath); err == nil {
+			t.Fatalf("expecting non-nil error when compiling %q", jpath)
+		}
+	}
+
+	f(``)
+	f(`a`)
+	f(`$.`)
+	f(`$[`)
+	f(`$['a'`)
+	f(`$[?@.a == @.*]`)
+	f(`$[?length(@.*) == 1]`)
+	f(`$[?(@.a)`)
+}
@@ -0,0 +1,484 @@
+package fastjson
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// CompiledSet is a set of compiled JSONPath expressions, which are
+// evaluated together.
+//
+// The paths are merged into a trie by their common prefixes, so every
+// shared prefix is evaluated only once per document. This is much faster
+// than calling Lookup for every path when many fields must be extracted
+// from the same document.
+//
+// The zero CompiledSet is ready to use. CompiledSet cannot be modified
+// from concurrent goroutines, while it may be evaluated concurrently
+// after all the paths are added.
+type CompiledSet struct {
+	paths []*Compiled
+
+	// steps is the trie root for paths compiled with Compile.
+	steps setNode
+
+	// segments is the trie root for paths compiled with CompileRFC9535.
+	segments setNode
+
+	// rootIDs contains ids of the paths with filters, which may refer
+	// to the document root. GetPath evaluates them on the parsed data.
+	rootIDs []int
+}
+
+// SetResult is the result of a path evaluated by CompiledSet.Lookup.
+type SetResult struct {
+	// Value is the value returned by Compiled.Lookup for the path.
+	Value *Value
+
+	// Err is the error returned by Compiled.Lookup for the path.
+	Err error
+}
+
+// RawSetResult is the result of a path evaluated by CompiledSet.GetPath.
+type RawSetResult struct {
+	// Values contains the values returned by GetPath for the path.
+	Values [][]byte
+
+	// Err is the error returned by GetPath for the path.
+	Err error
+}
+
+// setNode is a trie node.
+type setNode struct {
+	// edge contains the steps leading to the node from its parent.
+	edge []step
+
+	// segment is the RFC 9535 segment leading to the node from its parent.
+	segment *rfcSegment
+
+	children []*setNode
+
+	// ids contains ids of the paths ending at the node.
+	ids []int
+
+	// needsRoot is set if the edge contains a filter, which may refer
+	// to the document root. Such filters cannot be evaluated over raw JSON.
+	needsRoot bool
+}
+
+// CompileSet compiles jpaths with Compile and returns the set holding them.
+//
+// The path id in the returned set matches its index in jpaths.
+func CompileSet(jpaths ...string) (*CompiledSet, error) {
+	var cs CompiledSet
+	for _, jpath := range jpaths {
+		c, err := Compile(jpath)
+		if err != nil {
+			return nil, err
+		}
+		cs.Add(c)
+	}
+	return &cs, nil
+}
+
+// Add adds c to cs and returns its id.
+//
+// Ids are assigned sequentially starting from 0. Results of CompiledSet.Lookup
+// and CompiledSet.GetPath are indexed by ids.
+func (cs *CompiledSet) Add(c *Compiled) int {
+	id := len(cs.paths)
+	cs.paths = append(cs.paths, c)
+	needsRoot := c.needsRoot()
+	if needsRoot {
+		cs.rootIDs = append(cs.rootIDs, id)
+	}
+
+	var n *setNode
+	if c.query != nil {
+		n = &cs.segments
+		for i := range c.query.segments {
+			n = n.segmentChild(&c.query.segments[i])
+			if needsRoot && n.hasFilter() {
+				n.needsRoot = true
+			}
+		}
+	} else {
+		n = &cs.steps
+		steps := c.steps
+		for len(steps) > 0 {
+			k := 1
+			if steps[0].op == "scan" && len(steps) > 1 {
+				// `..` is evaluated together with the next step.
+				k = 2
+			}
+			n = n.stepsChild(steps[:k])
+			if needsRoot && n.hasFilter() {
+				n.needsRoot = true
+			}
+			steps = steps[k:]
+		}
+	}
+	n.ids = append(n.ids, id)
+	return id
+}
+
+// Len returns the number of paths in cs.
+func (cs *CompiledSet) Len() int {
+	return len(cs.paths)
+}
+
+// Path returns the path with the given id.
+func (cs *CompiledSet) Path(id int) *Compiled {
+	return cs.paths[id]
+}
+
+func (n *setNode) stepsChild(edge []step) *setNode {
+	for _, child := range n.children {
+		if equalSteps(child.edge, edge) {
+			return child
+		}
+	}
+	child := &setNode{
+		edge: edge,
+	}
+	n.children = append(n.children, child)
+	return child
+}
+
+func (n *setNode) segmentChild(seg *rfcSegment) *setNode {
+	for _, child := range n.children {
+		if equalSegments(child.segment, seg) {
+			return child
+		}
+	}
+	child := &setNode{
+		segment: seg,
+	}
+	n.children = append(n.children, child)
+	return child
+}
+
+func equalSteps(a, b []step) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].op != b[i].op || a[i].key != b[i].key {
+			return false
+		}
+		if a[i].op == "filter" {
+			if !equalFilters(a[i].args.(*FilterTupleGroup), b[i].args.(*FilterTupleGroup)) {
+				return false
+			}
+			continue
+		}
+		if !reflect.DeepEqual(a[i].args, b[i].args) {
+			return false
+		}
+	}
+	return true
+}
+
+// equalFilters returns true if a and b are the same filter expression.
+//
+// Filters with placeholders are shared only by the paths with the same
+// compiled step, since the paths may be bound to distinct values.
+func equalFilters(a, b *FilterTupleGroup) bool {
+	if a == b {
+		return true
+	}
+	return a.text == b.text && !a.hasVars() && !b.hasVars()
+}
+
+func equalSegments(a, b *rfcSegment) bool {
+	if a == b {
+		return true
+	}
+	if a.descendant != b.descendant || len(a.selectors) != len(b.selectors) {
+		return false
+	}
+	for i := range a.selectors {
+		x, y := &a.selectors[i], &b.selectors[i]
+		if x.kind == selectorFilter || x.kind != y.kind || x.name != y.name || x.index != y.index || x.slice != y.slice {
+			return false
+		}
+	}
+	return true
+}
+
+// hasFilter returns true if the edge leading to n contains a filter.
+func (n *setNode) hasFilter() bool {
+	if n.segment != nil {
+		for _, sel := range n.segment.selectors {
+			if sel.kind == selectorFilter {
+				return true
+			}
+		}
+		return false
+	}
+	for _, s := range n.edge {
+		if s.op == "filter" {
+			return true
+		}
+	}
+	return false
+}
+
+// walk calls f for ids of all the paths going through n.
+func (n *setNode) walk(f func(id int)) {
+	for _, id := range n.ids {
+		f(id)
+	}
+	for _, child := range n.children {
+		child.walk(f)
+	}
+}
+
+// Lookup evaluates all the paths in cs on root.
+//
+// The result for the path with the given id is stored at the id index
+// of the returned slice. It matches the result of Compiled.Lookup for the path.
+func (cs *CompiledSet) Lookup(root *Value) []SetResult {
+	res := make([]SetResult, len(cs.paths))
+	nodes := []node{{v: root}}
+	cs.steps.lookupSteps(res, cs.paths, nodes, root, false)
+	cs.segments.selectNodes(res, nodes, root)
+	return res
+}
+
+func (n *setNode) lookupSteps(res []SetResult, paths []*Compiled, nodes []node, root *Value, multi bool) {
+	if !multi && len(nodes) == 0 {
+		// Nothing is found, so the paths return ErrPathNotFound like Compiled.Lookup does.
+		n.walk(func(id int) {
+			res[id].Err = notFoundErrorf("path not found: %s", paths[id])
+		})
+		return
+	}
+	if len(n.ids) > 0 {
+		var v *Value
+		if multi {
+			v = nodeValues(nodes)
+		} else {
+			v = nodes[0].v
+		}
+		for _, id := range n.ids {
+			res[id].Value = v
+		}
+	}
+	for _, child := range n.children {
+		ns, m, err := lookup_steps(child.edge, nodes, root, multi, false, nil)
+		if err != nil {
+			child.walk(func(id int) {
+				res[id].Err = err
+			})
+			continue
+		}
+		child.lookupSteps(res, paths, ns, root, m)
+	}
+}
+
+func (n *setNode) selectNodes(res []SetResult, nodes []node, root *Value) {
+	if len(n.ids) > 0 {
+		v := nodeValues(nodes)
+		for _, id := range n.ids {
+			res[id].Value = v
+		}
+	}
+	for _, child := range n.children {
+		child.selectNodes(res, child.segment.selectNodes(nodes, root, false, nil), root)
+	}
+}
+
+// nodeValues returns an array holding the values of nodes.
+func nodeValues(nodes []node) *Value {
+	a := make([]*Value, len(nodes))
+	for i, n := range nodes {
+		a[i] = n.v
+	}
+	return &Value{a: a, t: TypeArray}
+}
+
+// GetPath evaluates all the paths in cs on raw JSON data.
+//
+// The result for the path with the given id is stored at the id index
+// of the returned slice. It matches the result of GetPath for the path.
+// The returned values point into data, so data mustn't be modified
+// while they are in use.
+func (cs *CompiledSet) GetPath(data []byte) []RawSetResult {
+	res := make([]RawSetResult, len(cs.paths))
+	var e rawEvaluator
+	defer e.reset()
+
+	s := skipWS(b2s(data))
+	if len(s) == 0 {
+		err := fmt.Errorf("cannot parse empty string")
+		for i := range res {
+			res[i].Err = err
+		}
+	} else {
+		nodes := []string{s}
+		e.lookupSetSteps(res, &cs.steps, nodes, false)
+		e.selectSetNodes(res, &cs.segments, nodes)
+	}
+
+	if len(cs.rootIDs) > 0 {
+		p := handyPool.Get()
+		root, err := p.ParseBytes(data)
+		for _, id := range cs.rootIDs {
+			if err != nil {
+				res[id] = RawSetResult{Err: err}
+				continue
+			}
+			values, err := marshaledValues(root, cs.paths[id])
+			res[id] = RawSetResult{Values: values, Err: err}
+		}
+		handyPool.Put(p)
+	}
+	return res
+}
+
+func (e *rawEvaluator) lookupSetSteps(res []RawSetResult, n *setNode, nodes []string, multi bool) {
+	setRawResults(res, n.ids, nodes)
+	if !multi && len(nodes) == 0 {
+		n.walk(func(id int) {
+			res[id].Values = [][]byte{}
+		})
+		return
+	}
+
+	// Children selecting object members are evaluated in a single pass over
+	// every object instead of scanning the object once per child.
+	var members []*setNode
+	if rawObjects(nodes) {
+		for _, child := range n.children {
+			if _, ok := memberName(child); ok && !child.needsRoot {
+				members = append(members, child)
+			}
+		}
+		if len(members) > 1 {
+			e.lookupSetMembers(res, members, nodes, multi)
+		} else {
+			members = nil
+		}
+	}
+
+	for _, child := range n.children {
+		if _, ok := memberName(child); child.needsRoot || ok && members != nil {
+			continue
+		}
+		ns, m, err := e.lookupSteps(child.edge, nodes, multi)
+		if err != nil {
+			child.walk(func(id int) {
+				res[id].Err = err
+			})
+			continue
+		}
+		e.lookupSetSteps(res, child, ns, m)
+	}
+}
+
+// lookupSetMembers evaluates children, which select a single object member,
+// over the objects in nodes.
+func (e *rawEvaluator) lookupSetMembers(res []RawSetResult, children []*setNode, nodes []string, multi bool) {
+	names := make([]string, len(children))
+	for i, child := range children {
+		names[i], _ = memberName(child)
+	}
+	values := make([][]string, len(children))
+	errs := make([]error, len(children))
+	found := make([]bool, len(children))
+	for _, n := range nodes {
+		for i := range found {
+			found[i] = false
+		}
+		left := len(children)
+		_, err := visitRawObject(n[1:], 0, func(k, v string) (bool, error) {
+			if strings.IndexByte(k, '\\') >= 0 {
+				// k points into data, so it is unescaped into a copy.
+				k = unescapeStringBestEffort(string(s2b(k)))
+			}
+			for i, name := range names {
+				if !found[i] && k == name {
+					// The first member wins like in rawObjectMember.
+					found[i] = true
+					left--
+					values[i] = append(values[i], v)
+				}
+			}
+			return left > 0, nil
+		})
+		for i, name := range names {
+			if found[i] || errs[i] != nil {
+				continue
+			}
+			if err != nil {
+				errs[i] = err
+			} else if !multi {
+				errs[i] = notFoundErrorf("key error: %s not found in object", name)
+			}
+		}
+	}
+	for i, child := range children {
+		if err := errs[i]; err != nil {
+			child.walk(func(id int) {
+				res[id].Err = err
+			})
+			continue
+		}
+		e.lookupSetSteps(res, child, values[i], multi)
+	}
+}
+
+// memberName returns the object member name selected by the edge leading to n
+// if the edge consists of a single member name step such as `a` or `['a']`.
+func memberName(n *setNode) (string, bool) {
+	if len(n.edge) != 1 || n.edge[0].op != "key" {
+		return "", false
+	}
+	s := n.edge[0]
+	if s.args == nil {
+		return s.key, s.key != ""
+	}
+	if keys := s.args.([]string); s.key == "" && len(keys) == 1 {
+		return keys[0], true
+	}
+	return "", false
+}
+
+// rawObjects returns true if nodes contains only JSON objects.
+func rawObjects(nodes []string) bool {
+	for _, n := range nodes {
+		if rawType(n) != TypeObject {
+			return false
+		}
+	}
+	return len(nodes) > 0
+}
+
+func (e *rawEvaluator) selectSetNodes(res []RawSetResult, n *setNode, nodes []string) {
+	setRawResults(res, n.ids, nodes)
+	for _, child := range n.children {
+		if child.needsRoot {
+			continue
+		}
+		ns, err := e.selectSegment(child.segment, nodes)
+		if err != nil {
+			child.walk(func(id int) {
+				res[id].Err = err
+			})
+			continue
+		}
+		e.selectSetNodes(res, child, ns)
+	}
+}
+
+func setRawResults(res []RawSetResult, ids []int, nodes []string) {
+	if len(ids) == 0 {
+		return
+	}
+	values, err := rawValues(nodes)
+	for _, id := range ids {
+		res[id] = RawSetResult{Values: values, Err: err}
+	}
+}
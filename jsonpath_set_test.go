@@ -0,0 +1,251 @@
+package fastjson
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompiledSetLookup(t *testing.T) {
+	data := []byte(`{
+		"store": {
+			"book": [
+				{"category": "reference", "author": "Nigel Rees", "price": 8.95},
+				{"category": "fiction", "author": "Evelyn Waugh", "price": 12.99},
+				{"category": "fiction", "author": "Herman Melville", "isbn": "0-553-21311-3", "price": 8.99}
+			],
+			"bicycle": {"color": "red", "price": 19.95}
+		},
+		"expensive": 10,
+		"s": "foo"
+	}`)
+	var p Parser
+	root, err := p.ParseBytes(data)
+	if err != nil {
+		t.Fatalf("cannot parse data: %s", err)
+	}
+
+	var cs CompiledSet
+	paths := []struct {
+		path string
+		rfc  bool
+	}{
+		{`$`, false},
+		{`$.store.book[0].author`, false},
+		{`$.store.book[0].price`, false},
+		{`$.store.book[*].author`, false},
+		{`$.store.book[0].author`, false},
+		{`$.store.bicycle.color`, false},
+		{`$.store.missing.color`, false},
+		{`$.store.missing..color`, false},
+		{`$.store..price`, false},
+		{`$..author`, false},
+		{`$.s.foo`, false},
+		{`$.s.foo.bar`, false},
+		{`$.store.book[5]`, false},
+		{`$.store.book[5].author`, false},
+		{`$.store.bicycle.price`, false},
+		{`$.store['bicycle'].missing`, false},
+		{`$.store.book[*].price`, false},
+		{`$.store.book[*].isbn`, false},
+		{`$.expensive`, false},
+		{`$.store.book[?(@.price > 10)].author`, false},
+		{`$.store.bicycle[?(@.color == 'blue')]`, false},
+		{`$.store.bicycle[?(@.color == 'blue')].price`, false},
+		{`$.store.book[?(@.price < $.expensive)].author`, false},
+		{`$.store.book[0].author`, true},
+		{`$.store.book[*].price`, true},
+		{`$.store.book[?@.isbn].author`, true},
+		{`$.store.book[?@.price > $.expensive].price`, true},
+		{`$..color`, true},
+		{`$.store.missing`, true},
+	}
+	for i, x := range paths {
+		var c *Compiled
+		if x.rfc {
+			c = MustCompileRFC9535(x.path)
+		} else {
+			c = MustCompile(x.path)
+		}
+		if id := cs.Add(c); id != i {
+			t.Fatalf("unexpected id for %s; got %d; want %d", x.path, id, i)
+		}
+	}
+	if cs.Len() != len(paths) {
+		t.Fatalf("unexpected Len; got %d; want %d", cs.Len(), len(paths))
+	}
+
+	res := cs.Lookup(root)
+	if len(res) != len(paths) {
+		t.Fatalf("unexpected number of results; got %d; want %d", len(res), len(paths))
+	}
+	for id, r := range res {
+		c := cs.Path(id)
+		vExpected, errExpected := c.Lookup(root)
+		if errExpected != nil {
+			if r.Err == nil || r.Err.Error() != errExpected.Error() {
+				t.Fatalf("unexpected error for %s; got %v; want %v", c, r.Err, errExpected)
+			}
+			continue
+		}
+		if r.Err != nil {
+			t.Fatalf("unexpected error for %s: %s", c, r.Err)
+		}
+		if vExpected == nil {
+			if r.Value != nil {
+				t.Fatalf("unexpected value for %s; got %s; want nil", c, r.Value)
+			}
+			continue
+		}
+		if r.Value == nil || !equal_value(r.Value, vExpected) {
+			t.Fatalf("unexpected value for %s; got %s; want %s", c, r.Value, vExpected)
+		}
+	}
+
+	raw := cs.GetPath(data)
+	if len(raw) != len(paths) {
+		t.Fatalf("unexpected number of raw results; got %d; want %d", len(raw), len(paths))
+	}
+	for id, r := range raw {
+		c := cs.Path(id)
+		valuesExpected, errExpected := GetPath(data, c)
+		if errExpected != nil {
+			if r.Err == nil || r.Err.Error() != errExpected.Error() {
+				t.Fatalf("unexpected error for %s; got %v; want %v", c, r.Err, errExpected)
+			}
+			continue
+		}
+		if r.Err != nil {
+			t.Fatalf("unexpected error for %s: %s", c, r.Err)
+		}
+		if len(r.Values) != len(valuesExpected) {
+			t.Fatalf("unexpected number of values for %s; got %d; want %d", c, len(r.Values), len(valuesExpected))
+		}
+		for i, b := range r.Values {
+			if string(b) != string(valuesExpected[i]) {
+				t.Fatalf("unexpected value #%d for %s; got %s; want %s", i, c, b, valuesExpected[i])
+			}
+		}
+	}
+}
+
+func TestCompiledSetSharedPrefix(t *testing.T) {
+	cs, err := CompileSet(`$.a.b.c`, `$.a.b.d`, `$.a.e`, `$.a.b.c`, `$.f`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(cs.steps.children) != 2 {
+		t.Fatalf("unexpected number of root children; got %d; want 2", len(cs.steps.children))
+	}
+	a := cs.steps.children[0]
+	if len(a.children) != 2 {
+		t.Fatalf("unexpected number of children for $.a; got %d; want 2", len(a.children))
+	}
+	b := a.children[0]
+	if len(b.children) != 2 {
+		t.Fatalf("unexpected number of children for $.a.b; got %d; want 2", len(b.children))
+	}
+	if ids := b.children[0].ids; len(ids) != 2 || ids[0] != 0 || ids[1] != 3 {
+		t.Fatalf("unexpected ids for $.a.b.c; got %v; want [0 3]", ids)
+	}
+
+	res := cs.GetPath([]byte(`{"a": {"b": {"c": 1, "d": "x"}, "e": [2]}, "f": null}`))
+	expected := []string{`1`, `"x"`, `[2]`, `1`, `null`}
+	for id, r := range res {
+		if r.Err != nil {
+			t.Fatalf("unexpected error for path #%d: %s", id, r.Err)
+		}
+		if len(r.Values) != 1 || string(r.Values[0]) != expected[id] {
+			t.Fatalf("unexpected values for path #%d; got %q; want [%s]", id, r.Values, expected[id])
+		}
+	}
+}
+
+func TestCompiledSetSharedFilter(t *testing.T) {
+	cs, err := CompileSet(`$.a[?(@.b > 1)].c`, `$.a[?(@.b > 1)].d`, `$.a[?(@.b > 2)].c`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	a := cs.steps.children[0]
+	if len(a.children) != 2 {
+		t.Fatalf("unexpected number of children for $.a; got %d; want 2", len(a.children))
+	}
+
+	// Paths bound to distinct values mustn't share the filter.
+	c := MustCompile(`$.a[?(@.b > $$min)].c`)
+	var bs CompiledSet
+	for _, min := range []int{1, 2} {
+		bound, err := c.Bind(Vars{"min": min})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		bs.Add(bound)
+	}
+	res := bs.GetPath([]byte(`{"a": [{"b": 2, "c": "x"}, {"b": 3, "c": "y"}]}`))
+	expected := []string{`"x","y"`, `"y"`}
+	for id, r := range res {
+		if r.Err != nil {
+			t.Fatalf("unexpected error for path #%d: %s", id, r.Err)
+		}
+		var a []string
+		for _, b := range r.Values {
+			a = append(a, string(b))
+		}
+		if s := strings.Join(a, ","); s != expected[id] {
+			t.Fatalf("unexpected values for path #%d; got %s; want %s", id, s, expected[id])
+		}
+	}
+}
+
+func TestCompiledSetGetPathKeepsData(t *testing.T) {
+	cs, err := CompileSet(`$["a\"b"]`, `$["a\"b"].x`, `$.c`, `$.d[?(@.k == $.c)].k`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	data := []byte(`{"a\"b": {"x": "y\nz"}, "c": "\u0064", "d": [{"k": "d"}]}`)
+	orig := string(data)
+	expected := []string{`{"x": "y\nz"}`, `"y\nz"`, `"\u0064"`, `"d"`}
+	for i := 0; i < 2; i++ {
+		res := cs.GetPath(data)
+		for id, r := range res {
+			if r.Err != nil {
+				t.Fatalf("unexpected error for path #%d: %s", id, r.Err)
+			}
+			if len(r.Values) != 1 || string(r.Values[0]) != expected[id] {
+				t.Fatalf("unexpected values for path #%d; got %q; want [%s]", id, r.Values, expected[id])
+			}
+		}
+		if string(data) != orig {
+			t.Fatalf("data has been modified; got %s; want %s", data, orig)
+		}
+	}
+}
+
+func TestCompiledSetLookupError(t *testing.T) {
+	if _, err := CompileSet(`$.a`, `$.a[`); err == nil {
+		t.Fatalf("expecting non-nil error")
+	}
+
+	cs, err := CompileSet(`$.a.b`, `$.a.b.c`, `$.x`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	res := cs.GetPath([]byte(`{"x": 1, "a": {"b": [1, }`))
+	for id := 0; id < 2; id++ {
+		if res[id].Err == nil {
+			t.Fatalf("expecting non-nil error for path #%d", id)
+		}
+	}
+	if res[2].Err != nil {
+		t.Fatalf("unexpected error for path #2: %s", res[2].Err)
+	}
+	if len(res[2].Values) != 1 || string(res[2].Values[0]) != `1` {
+		t.Fatalf("unexpected values for path #2; got %q; want [1]", res[2].Values)
+	}
+
+	res = cs.GetPath([]byte(` `))
+	for id, r := range res {
+		if r.Err == nil {
+			t.Fatalf("expecting non-nil error for path #%d", id)
+		}
+	}
+}
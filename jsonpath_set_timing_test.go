@@ -0,0 +1,49 @@
+package fastjson
+
+import (
+	"fmt"
+	"testing"
+)
+
+func BenchmarkCompiledSetGetPath(b *testing.B) {
+	paths := []string{
+		`$.statuses[0].id_str`,
+		`$.statuses[0].user.screen_name`,
+		`$.statuses[0].user.followers_count`,
+		`$.statuses[0].metadata.result_type`,
+		`$.search_metadata.count`,
+		`$.search_metadata.max_id_str`,
+	}
+	cs, err := CompileSet(paths...)
+	if err != nil {
+		b.Fatalf("cannot compile paths: %s", err)
+	}
+	data := []byte(twitterFixture)
+	b.Run("CompiledSet", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(data)))
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				for id, r := range cs.GetPath(data) {
+					if r.Err != nil || len(r.Values) != 1 {
+						panic(fmt.Errorf("unexpected result for %s: %q, %v", paths[id], r.Values, r.Err))
+					}
+				}
+			}
+		})
+	})
+	b.Run("GetPath", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(data)))
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				for id := 0; id < cs.Len(); id++ {
+					a, err := GetPath(data, cs.Path(id))
+					if err != nil || len(a) != 1 {
+						panic(fmt.Errorf("unexpected result for %s: %q, %v", paths[id], a, err))
+					}
+				}
+			}
+		})
+	})
+}
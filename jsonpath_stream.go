@@ -0,0 +1,730 @@
+package fastjson
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// StreamPath reads JSON from r and calls f for each value matched by c.
+//
+// Unlike Parser, StreamPath doesn't read the whole JSON into memory.
+// Containers on the way to the matched values are scanned item by item,
+// while the subtrees, which cannot match c, are skipped. So the memory usage
+// is bounded by the size of the largest matched value, e.g. by the size
+// of a single record for `$.records[*]` or `$.records[?(@.type=='x')].id`.
+//
+// The following steps are evaluated in streaming mode: member names,
+// wildcards, non-negative indexes and slices with non-negative bounds and
+// positive step. Filters are evaluated on each array item separately.
+// The value, which cannot be streamed with the rest of c, e.g. the value
+// at `..`, is read into memory as a whole and c is evaluated on it.
+//
+// Filters referring to the document root `$` aren't supported.
+//
+// v passed to f is valid until f returns. The evaluation stops if f
+// returns an error. This error is returned from StreamPath then.
+func StreamPath(r io.Reader, c *Compiled, f func(v *Value) error) error {
+	if c.needsRoot() {
+		return fmt.Errorf("cannot stream JSONPath %q: filters referring to the document root aren't supported", c.path)
+	}
+
+	e := &streamEvaluator{
+		sr: newStreamReader(r),
+		f:  f,
+	}
+	var err error
+	if c.query != nil {
+		err = e.streamSegments(c.query.segments)
+	} else {
+		err = e.streamSteps(splitSteps(c.steps), false)
+	}
+	if err != nil {
+		return err
+	}
+	if err := e.sr.skipWS(); err != nil {
+		return err
+	}
+	if e.sr.fill() {
+		return e.sr.errorf("unexpected tail")
+	}
+	return e.sr.readErr()
+}
+
+// splitSteps splits steps with both key and op into separate key and op steps,
+// so every step may be streamed separately.
+//
+// The steps following `..` are left as is, since `..` isn't streamed.
+func splitSteps(steps []step) []step {
+	res := make([]step, 0, len(steps))
+	for i, s := range steps {
+		if s.op == "scan" {
+			return append(res, steps[i:]...)
+		}
+		if len(s.key) == 0 || s.op == "key" && s.args == nil {
+			res = append(res, s)
+			continue
+		}
+		res = append(res, step{op: "key", key: s.key}, step{op: s.op, args: s.args})
+	}
+	return res
+}
+
+// streamEvaluator evaluates JSONPath over JSON read from streamReader.
+type streamEvaluator struct {
+	sr *streamReader
+	p  Parser
+	f  func(v *Value) error
+}
+
+// streamSteps evaluates steps on the value at the current reader position.
+//
+// multi has the same meaning as for lookup_steps.
+func (e *streamEvaluator) streamSteps(steps []step, multi bool) error {
+	if len(steps) == 0 {
+		return e.fallbackSteps(steps, multi)
+	}
+	c, err := e.sr.peekValue()
+	if err != nil {
+		return err
+	}
+
+	s := steps[0]
+	switch s.op {
+	case "key":
+		key := s.key
+		if s.args != nil {
+			keys := s.args.([]string)
+			if len(keys) != 1 {
+				break
+			}
+			key = keys[0]
+		}
+		switch c {
+		case '{':
+			found, err := e.streamMember(key, func() error {
+				return e.streamSteps(steps[1:], multi)
+			})
+			if err != nil {
+				return err
+			}
+			if !found && !multi {
+				return notFoundErrorf("key error: %s not found in object", key)
+			}
+			return nil
+		case '[':
+			if s.args != nil {
+				break
+			}
+			// Project the key over array items like select_key does.
+			return e.sr.visitArray(func(i int) error {
+				c, err := e.sr.peekValue()
+				if err != nil {
+					return err
+				}
+				if c != '{' {
+					v, err := e.parseValue()
+					if err != nil {
+						return err
+					}
+					if x := v.Get(key); x != nil {
+						return e.evalSteps(x, steps[1:], true)
+					}
+					return nil
+				}
+				_, err = e.streamMember(key, func() error {
+					return e.streamSteps(steps[1:], true)
+				})
+				return err
+			})
+		}
+	case "idx":
+		idxs := s.args.([]int)
+		if c != '[' || len(idxs) == 0 || !isAscending(idxs) {
+			break
+		}
+		if len(idxs) > 1 {
+			multi = true
+		}
+		j := 0
+		n := 0
+		err := e.sr.visitArray(func(i int) error {
+			n++
+			if j < len(idxs) && i == idxs[j] {
+				j++
+				return e.streamSteps(steps[1:], multi)
+			}
+			return e.sr.skipValue(0)
+		})
+		if err != nil {
+			return err
+		}
+		if j < len(idxs) && !multi {
+			return notFoundErrorf("index out of range: len: %v, idx: %v", n, idxs[j])
+		}
+		return nil
+	case "range":
+		frm, to, stp := rangeArgs(s.args)
+		if frm == nil && to == nil && stp == nil && (c == '{' || c == '[') {
+			return e.sr.visitChildren(func() error {
+				return e.streamSteps(steps[1:], true)
+			})
+		}
+		if c != '[' {
+			break
+		}
+		start, end, step, ok := streamableRange(frm, to, stp)
+		if !ok {
+			break
+		}
+		return e.sr.visitArray(func(i int) error {
+			if i >= start && (end < 0 || i <= end) && (i-start)%step == 0 {
+				return e.streamSteps(steps[1:], true)
+			}
+			return e.sr.skipValue(0)
+		})
+	case "filter":
+		if c != '[' {
+			break
+		}
+		group := s.args.(*FilterTupleGroup)
+		return e.sr.visitArray(func(i int) error {
+			v, err := e.parseValue()
+			if err != nil {
+				return err
+			}
+			ok, err := eval_filter_group(v, nil, group, nil)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return nil
+			}
+			return e.evalSteps(v, steps[1:], true)
+		})
+	}
+	return e.fallbackSteps(steps, multi)
+}
+
+// fallbackSteps reads the value at the current reader position into memory
+// and evaluates steps on it.
+func (e *streamEvaluator) fallbackSteps(steps []step, multi bool) error {
+	v, err := e.parseValue()
+	if err != nil {
+		return err
+	}
+	return e.evalSteps(v, steps, multi)
+}
+
+func (e *streamEvaluator) evalSteps(v *Value, steps []step, multi bool) error {
+	if len(steps) == 0 {
+		return e.f(v)
+	}
+	nodes, _, err := lookup_steps(steps, []node{{v: v}}, nil, multi, false, nil)
+	if err != nil {
+		return err
+	}
+	for _, n := range nodes {
+		if err := e.f(n.v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// streamSegments evaluates RFC 9535 segments on the value at the current
+// reader position.
+func (e *streamEvaluator) streamSegments(segs []rfcSegment) error {
+	if len(segs) == 0 || segs[0].descendant || len(segs[0].selectors) != 1 {
+		return e.fallbackSegments(segs)
+	}
+	c, err := e.sr.peekValue()
+	if err != nil {
+		return err
+	}
+
+	next := func() error {
+		return e.streamSegments(segs[1:])
+	}
+	sel := &segs[0].selectors[0]
+	switch sel.kind {
+	case selectorName:
+		if c == '{' {
+			_, err := e.streamMember(sel.name, next)
+			return err
+		}
+		return e.sr.skipValue(0)
+	case selectorWildcard:
+		return e.sr.visitChildren(next)
+	case selectorIndex:
+		if c != '[' {
+			return e.sr.skipValue(0)
+		}
+		if sel.index < 0 {
+			break
+		}
+		return e.sr.visitArray(func(i int) error {
+			if i == sel.index {
+				return next()
+			}
+			return e.sr.skipValue(0)
+		})
+	case selectorSlice:
+		if c != '[' {
+			return e.sr.skipValue(0)
+		}
+		b := &sel.slice
+		if b.hasStep && b.step <= 0 || b.hasStart && b.start < 0 || b.hasEnd && b.end < 0 {
+			break
+		}
+		step := 1
+		if b.hasStep {
+			step = b.step
+		}
+		return e.sr.visitArray(func(i int) error {
+			if i >= b.start && (!b.hasEnd || i < b.end) && (i-b.start)%step == 0 {
+				return next()
+			}
+			return e.sr.skipValue(0)
+		})
+	case selectorFilter:
+		if c != '{' && c != '[' {
+			return e.sr.skipValue(0)
+		}
+		return e.sr.visitChildren(func() error {
+			v, err := e.parseValue()
+			if err != nil {
+				return err
+			}
+			if !sel.filter.evalLogical(nil, v, nil) {
+				return nil
+			}
+			return e.evalSegments(v, segs[1:])
+		})
+	}
+	return e.fallbackSegments(segs)
+}
+
+// fallbackSegments reads the value at the current reader position into memory
+// and evaluates segs on it.
+func (e *streamEvaluator) fallbackSegments(segs []rfcSegment) error {
+	v, err := e.parseValue()
+	if err != nil {
+		return err
+	}
+	return e.evalSegments(v, segs)
+}
+
+func (e *streamEvaluator) evalSegments(v *Value, segs []rfcSegment) error {
+	if len(segs) == 0 {
+		return e.f(v)
+	}
+	q := &rfcQuery{
+		relative: true,
+		segments: segs,
+	}
+	for _, n := range q.selectNodes(nil, node{v: v}, false, nil) {
+		if err := e.f(n.v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// streamMember calls f for the value of the first member with the given key
+// in the object at the current reader position and skips the rest members.
+func (e *streamEvaluator) streamMember(key string, f func() error) (bool, error) {
+	found := false
+	err := e.sr.visitObject(func(k string) error {
+		if found || k != key {
+			return e.sr.skipValue(0)
+		}
+		found = true
+		return f()
+	})
+	return found, err
+}
+
+// parseValue reads the value at the current reader position and parses it.
+//
+// The returned value is valid until the next call to parseValue.
+func (e *streamEvaluator) parseValue() (*Value, error) {
+	b, err := e.sr.captureValue()
+	if err != nil {
+		return nil, err
+	}
+	return e.p.ParseBytes(b)
+}
+
+func isAscending(a []int) bool {
+	for i, n := range a {
+		if n < 0 || i > 0 && n <= a[i-1] {
+			return false
+		}
+	}
+	return true
+}
+
+func rangeArgs(args interface{}) (frm, to, stp interface{}) {
+	switch argsv := args.(type) {
+	case [2]interface{}:
+		return argsv[0], argsv[1], nil
+	case [3]interface{}:
+		return argsv[0], argsv[1], argsv[2]
+	}
+	return nil, nil, nil
+}
+
+// streamableRange returns the bounds of [frm:to:stp] range if it may be
+// evaluated without knowing the array length.
+//
+// end is negative if the range isn't bounded. Unlike RFC 9535 slices,
+// the end is inclusive.
+func streamableRange(frm, to, stp interface{}) (start, end, step int, ok bool) {
+	start, end, step = 0, -1, 1
+	if n, isInt := frm.(int); isInt {
+		if n < 0 {
+			return 0, 0, 0, false
+		}
+		start = n
+	}
+	if n, isInt := to.(int); isInt {
+		if n < 0 {
+			return 0, 0, 0, false
+		}
+		end = n
+	}
+	if n, isInt := stp.(int); isInt {
+		if n <= 0 {
+			return 0, 0, 0, false
+		}
+		step = n
+	}
+	return start, end, step, true
+}
+
+const streamBufSize = 64 * 1024
+
+// streamReader scans JSON read from io.Reader.
+type streamReader struct {
+	r   io.Reader
+	buf []byte
+	pos int
+	n   int
+
+	// err is the error returned from r.
+	err error
+
+	// offset is the offset of buf in the stream.
+	offset int64
+
+	// key holds the last object key read by visitObject.
+	key []byte
+
+	// capturing is set while the bytes of a single value are captured.
+	capturing bool
+	capStart  int
+	captured  []byte
+}
+
+func newStreamReader(r io.Reader) *streamReader {
+	return &streamReader{
+		r:   r,
+		buf: make([]byte, streamBufSize),
+	}
+}
+
+// fill makes sure buf contains unread bytes. It returns false at the end
+// of the stream or on read error.
+func (sr *streamReader) fill() bool {
+	if sr.pos < sr.n {
+		return true
+	}
+	if sr.err != nil {
+		return false
+	}
+	if sr.capturing {
+		sr.captured = append(sr.captured, sr.buf[sr.capStart:sr.n]...)
+		sr.capStart = 0
+	}
+	sr.offset += int64(sr.n)
+	sr.pos, sr.n = 0, 0
+	for i := 0; sr.n == 0 && sr.err == nil; i++ {
+		if i >= 100 {
+			sr.err = io.ErrNoProgress
+			break
+		}
+		sr.n, sr.err = sr.r.Read(sr.buf)
+	}
+	return sr.n > 0
+}
+
+// readErr returns the error for the unexpected end of the stream.
+func (sr *streamReader) readErr() error {
+	if sr.err == nil || sr.err == io.EOF {
+		return nil
+	}
+	return fmt.Errorf("cannot read JSON: %w", sr.err)
+}
+
+func (sr *streamReader) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("cannot parse JSON at offset %d: %s", sr.offset+int64(sr.pos), fmt.Sprintf(format, args...))
+}
+
+func (sr *streamReader) unexpectedEnd() error {
+	if err := sr.readErr(); err != nil {
+		return err
+	}
+	return sr.errorf("unexpected end of JSON")
+}
+
+func (sr *streamReader) skipWS() error {
+	for sr.fill() {
+		switch sr.buf[sr.pos] {
+		case ' ', '\t', '\n', '\r':
+			sr.pos++
+		default:
+			return nil
+		}
+	}
+	return sr.readErr()
+}
+
+// peekValue skips whitespace and returns the first byte of the next value.
+func (sr *streamReader) peekValue() (byte, error) {
+	if err := sr.skipWS(); err != nil {
+		return 0, err
+	}
+	if !sr.fill() {
+		return 0, sr.unexpectedEnd()
+	}
+	return sr.buf[sr.pos], nil
+}
+
+// expect skips whitespace and reads the byte c.
+func (sr *streamReader) expect(c byte) error {
+	if err := sr.skipWS(); err != nil {
+		return err
+	}
+	if !sr.fill() {
+		return sr.unexpectedEnd()
+	}
+	if sr.buf[sr.pos] != c {
+		return sr.errorf("expecting %q, found %q", c, sr.buf[sr.pos])
+	}
+	sr.pos++
+	return nil
+}
+
+// visitObject calls f for each member of the object at the current position.
+//
+// f must read the member value.
+func (sr *streamReader) visitObject(f func(key string) error) error {
+	if err := sr.expect('{'); err != nil {
+		return err
+	}
+	c, err := sr.peekValue()
+	if err != nil {
+		return err
+	}
+	if c == '}' {
+		sr.pos++
+		return nil
+	}
+	for {
+		if err := sr.expect('"'); err != nil {
+			return err
+		}
+		if err := sr.readString(true); err != nil {
+			return err
+		}
+		key := b2s(sr.key)
+		if strings.IndexByte(key, '\\') >= 0 {
+			key = unescapeStringBestEffort(string(sr.key))
+		}
+		if err := sr.expect(':'); err != nil {
+			return err
+		}
+		if _, err := sr.peekValue(); err != nil {
+			return err
+		}
+		if err := f(key); err != nil {
+			return err
+		}
+		if done, err := sr.nextItem('}'); done || err != nil {
+			return err
+		}
+	}
+}
+
+// visitArray calls f for each item of the array at the current position.
+//
+// f must read the item.
+func (sr *streamReader) visitArray(f func(i int) error) error {
+	if err := sr.expect('['); err != nil {
+		return err
+	}
+	c, err := sr.peekValue()
+	if err != nil {
+		return err
+	}
+	if c == ']' {
+		sr.pos++
+		return nil
+	}
+	for i := 0; ; i++ {
+		if _, err := sr.peekValue(); err != nil {
+			return err
+		}
+		if err := f(i); err != nil {
+			return err
+		}
+		if done, err := sr.nextItem(']'); done || err != nil {
+			return err
+		}
+	}
+}
+
+// visitChildren calls f for each member value or item of the object or array
+// at the current position. Other values are skipped.
+func (sr *streamReader) visitChildren(f func() error) error {
+	c, err := sr.peekValue()
+	if err != nil {
+		return err
+	}
+	switch c {
+	case '{':
+		return sr.visitObject(func(key string) error {
+			return f()
+		})
+	case '[':
+		return sr.visitArray(func(i int) error {
+			return f()
+		})
+	default:
+		return sr.skipValue(0)
+	}
+}
+
+// nextItem reads the delimiter after object member or array item.
+//
+// It returns true if the closing delimiter end has been read.
+func (sr *streamReader) nextItem(end byte) (bool, error) {
+	if err := sr.skipWS(); err != nil {
+		return false, err
+	}
+	if !sr.fill() {
+		return false, sr.unexpectedEnd()
+	}
+	switch sr.buf[sr.pos] {
+	case ',':
+		sr.pos++
+		return false, nil
+	case end:
+		sr.pos++
+		return true, nil
+	default:
+		return false, sr.errorf("missing ',' or %q", end)
+	}
+}
+
+// readString reads the string after the opening quote.
+//
+// The raw string contents is stored into sr.key if saveKey is set.
+func (sr *streamReader) readString(saveKey bool) error {
+	if saveKey {
+		sr.key = sr.key[:0]
+	}
+	for {
+		if !sr.fill() {
+			return sr.unexpectedEnd()
+		}
+		start := sr.pos
+		for sr.pos < sr.n {
+			c := sr.buf[sr.pos]
+			if c == '"' {
+				if saveKey {
+					sr.key = append(sr.key, sr.buf[start:sr.pos]...)
+				}
+				sr.pos++
+				return nil
+			}
+			sr.pos++
+			if c != '\\' {
+				continue
+			}
+			if saveKey {
+				sr.key = append(sr.key, sr.buf[start:sr.pos]...)
+			}
+			if !sr.fill() {
+				return sr.unexpectedEnd()
+			}
+			// sr.fill may refill buf, so start anew after the escaped char.
+			if saveKey {
+				sr.key = append(sr.key, sr.buf[sr.pos])
+			}
+			sr.pos++
+			start = sr.pos
+		}
+		if saveKey {
+			sr.key = append(sr.key, sr.buf[start:sr.pos]...)
+		}
+	}
+}
+
+// skipValue skips the value at the current position.
+func (sr *streamReader) skipValue(depth int) error {
+	c, err := sr.peekValue()
+	if err != nil {
+		return err
+	}
+	depth++
+	if depth > MaxDepth {
+		return sr.errorf("too big depth for the nested JSON; it exceeds %d", MaxDepth)
+	}
+	switch c {
+	case '{':
+		return sr.visitObject(func(key string) error {
+			return sr.skipValue(depth)
+		})
+	case '[':
+		return sr.visitArray(func(i int) error {
+			return sr.skipValue(depth)
+		})
+	case '"':
+		sr.pos++
+		return sr.readString(false)
+	}
+
+	// Numbers, true, false, null and NaN. They are validated by Parser
+	// when captured.
+	n := 0
+	for sr.fill() {
+		c := sr.buf[sr.pos]
+		if (c < '0' || c > '9') && (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && c != '-' && c != '+' && c != '.' {
+			break
+		}
+		sr.pos++
+		n++
+	}
+	if n == 0 {
+		return sr.errorf("unexpected char %q", c)
+	}
+	return sr.readErr()
+}
+
+// captureValue reads the value at the current position and returns its bytes.
+//
+// The returned bytes are valid until the next call to captureValue.
+func (sr *streamReader) captureValue() ([]byte, error) {
+	if _, err := sr.peekValue(); err != nil {
+		return nil, err
+	}
+	sr.captured = sr.captured[:0]
+	sr.capturing = true
+	sr.capStart = sr.pos
+	err := sr.skipValue(0)
+	sr.captured = append(sr.captured, sr.buf[sr.capStart:sr.pos]...)
+	sr.capturing = false
+	return sr.captured, err
+}
@@ -0,0 +1,251 @@
+package fastjson
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// checkStreamPath verifies StreamPath returns the same values as LookupNodes.
+func checkStreamPath(t *testing.T, data string, c *Compiled) {
+	t.Helper()
+	root, err := Parse(data)
+	if err != nil {
+		t.Fatalf("cannot parse %q: %s", data, err)
+	}
+	nodes, errExpected := c.LookupNodes(root)
+
+	for _, wrap := range []string{"plain", "onebyte", "halfreader"} {
+		var got []string
+		f := func(v *Value) error {
+			got = append(got, v.String())
+			return nil
+		}
+		var err error
+		switch wrap {
+		case "plain":
+			err = StreamPath(strings.NewReader(data), c, f)
+		case "onebyte":
+			err = StreamPath(iotest.OneByteReader(strings.NewReader(data)), c, f)
+		case "halfreader":
+			err = StreamPath(iotest.HalfReader(strings.NewReader(data)), c, f)
+		}
+		if errExpected != nil {
+			if err == nil || err.Error() != errExpected.Error() {
+				t.Fatalf("unexpected error for %s with %s reader; got %v; want %v", c, wrap, err, errExpected)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error for %s with %s reader: %s", c, wrap, err)
+		}
+		var want []string
+		for _, n := range nodes {
+			want = append(want, n.Value.String())
+		}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Fatalf("unexpected values for %s with %s reader; got %q; want %q", c, wrap, got, want)
+		}
+	}
+}
+
+func TestStreamPath(t *testing.T) {
+	data := `{
+		"meta": {"count": 4, "x\"y": 1},
+		"records": [
+			{"type": "x", "id": 1, "tags": ["a", "b"]},
+			{"type": "y", "id": 2, "nested": {"deep": [1, [2, {"k": "\\\"}"}]]}},
+			{"type": "x", "id": 3, "tags": []},
+			[1, 2],
+			"str",
+			{"type": "x"}
+		],
+		"empty": [],
+		"n": 12.5
+	}`
+
+	for _, path := range []string{
+		`$`,
+		`$.meta`,
+		`$.meta.count`,
+		`$.meta['x"y']`,
+		`$.records[*]`,
+		`$.records.*.id`,
+		`$.records[?(@.type == 'x')].id`,
+		`$.records[?(@.type=='x')].id`,
+		`$.records[?(@.id>1)].id`,
+		`$.records[?(@.type == 'x')]`,
+		`$.records[1].nested.deep[1][1].k`,
+		`$.records[0,2].id`,
+		`$.records[2,0].id`,
+		`$.records[1:3].type`,
+		`$.records[::2]`,
+		`$.records[-1]`,
+		`$.records[-2:]`,
+		`$.records.id`,
+		`$.records.1`,
+		`$.records[0].tags[*]`,
+		`$.meta.*`,
+		`$..id`,
+		`$.records..k`,
+		`$.empty[*]`,
+		`$.meta[?(@.count > 1)]`,
+
+		// errors in the strict mode
+		`$.missing`,
+		`$.meta.missing`,
+		`$.records[10]`,
+		`$.n.x`,
+		`$.n[0]`,
+	} {
+		checkStreamPath(t, data, MustCompile(path))
+	}
+
+	for _, path := range []string{
+		`$`,
+		`$.records[*].id`,
+		`$.records[?@.type == 'x'].id`,
+		`$.records[?@.type == 'x']`,
+		`$.records[1].nested.deep[1][1].k`,
+		`$.records[0, 2].id`,
+		`$.records[1:3].type`,
+		`$.records[::2]`,
+		`$.records[::-1].id`,
+		`$.records[-1]`,
+		`$.meta.*`,
+		`$..id`,
+		`$.missing`,
+		`$.n.x`,
+		`$.records[?length(@.tags) > 0].id`,
+	} {
+		checkStreamPath(t, data, MustCompileRFC9535(path))
+	}
+}
+
+func TestStreamPathRFC9535Compliance(t *testing.T) {
+	data, err := os.ReadFile("testdata/jsonpath-compliance/cts.json")
+	if err != nil {
+		t.Fatalf("cannot read compliance suite: %s", err)
+	}
+	suite, err := ParseBytes(data)
+	if err != nil {
+		t.Fatalf("cannot parse compliance suite: %s", err)
+	}
+	for _, tc := range suite.GetArray("tests") {
+		c, err := CompileRFC9535(string(tc.GetStringBytes("selector")))
+		if err != nil || c.needsRoot() {
+			continue
+		}
+		checkStreamPath(t, tc.Get("document").String(), c)
+	}
+}
+
+func TestStreamPathDocExample(t *testing.T) {
+	data := `{"records": [{"type": "x", "id": 1}, {"type": "y", "id": 2}, {"type": "x", "id": 3}]}`
+	var ids []string
+	err := StreamPath(strings.NewReader(data), MustCompile(`$.records[?(@.type=='x')].id`), func(v *Value) error {
+		ids = append(ids, v.String())
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if s := strings.Join(ids, ","); s != "1,3" {
+		t.Fatalf("unexpected ids; got %s; want 1,3", s)
+	}
+}
+
+func TestStreamPathCallbackError(t *testing.T) {
+	errStop := errors.New("stop")
+	n := 0
+	err := StreamPath(strings.NewReader(`[1, 2, 3, 4]`), MustCompile(`$[*]`), func(v *Value) error {
+		n++
+		if n == 2 {
+			return errStop
+		}
+		return nil
+	})
+	if err != errStop {
+		t.Fatalf("unexpected error; got %v; want %v", err, errStop)
+	}
+	if n != 2 {
+		t.Fatalf("unexpected number of callbacks; got %d; want 2", n)
+	}
+}
+
+func TestStreamPathError(t *testing.T) {
+	f := func(data, path string) {
+		t.Helper()
+		err := StreamPath(strings.NewReader(data), MustCompile(path), func(v *Value) error {
+			return nil
+		})
+		if err == nil {
+			t.Fatalf("expecting non-nil error for %q at %q", path, data)
+		}
+	}
+
+	f(``, `$`)
+	f(`{"a": 1`, `$.a`)
+	f(`{"a": 1} x`, `$.a`)
+	f(`{"a" 1}`, `$.a`)
+	f(`{"a": [1, 2}`, `$.a[*]`)
+	f(`{"b": "xx, "a": 1}`, `$.a`)
+	f(`{"a": [{"b": tru}]}`, `$.a[?(@.b)]`)
+	f(`{"a": 1}`, `$.a[?(@.b == $.c)]`)
+
+	err := StreamPath(iotest.TimeoutReader(strings.NewReader(`{"a": [1, 2, 3]}`)), MustCompile(`$.a[2]`), func(v *Value) error {
+		return nil
+	})
+	if !errors.Is(err, iotest.ErrTimeout) {
+		t.Fatalf("unexpected error; got %v; want %v", err, iotest.ErrTimeout)
+	}
+}
+
+func TestStreamPathBoundedMemory(t *testing.T) {
+	// Build a document with many records and make sure only a single record
+	// is captured at a time.
+	var bb bytes.Buffer
+	bb.WriteString(`{"meta": {"skip": [`)
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&bb, `{"i": %d, "pad": "%s"},`, i, strings.Repeat("x", 100))
+	}
+	bb.WriteString(`0]}, "records": [`)
+	for i := 0; i < 1000; i++ {
+		if i > 0 {
+			bb.WriteString(",")
+		}
+		fmt.Fprintf(&bb, `{"type": "%c", "id": %d}`, 'a'+i%3, i)
+	}
+	bb.WriteString(`]}`)
+
+	sr := newStreamReader(&bb)
+	e := &streamEvaluator{
+		sr: sr,
+	}
+	sum := 0
+	maxCaptured := 0
+	e.f = func(v *Value) error {
+		sum += v.GetInt()
+		if len(sr.captured) > maxCaptured {
+			maxCaptured = len(sr.captured)
+		}
+		return nil
+	}
+	if err := e.streamSteps(splitSteps(MustCompile(`$.records[?(@.type == 'b')].id`).steps), false); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	sumExpected := 0
+	for i := 1; i < 1000; i += 3 {
+		sumExpected += i
+	}
+	if sum != sumExpected {
+		t.Fatalf("unexpected sum; got %d; want %d", sum, sumExpected)
+	}
+	if maxCaptured > 64 {
+		t.Fatalf("too big captured value: %d bytes", maxCaptured)
+	}
+}
@@ -2,8 +2,6 @@ package fastjson
 
 import (
 	"fmt"
-	"go/token"
-	"go/types"
 	"reflect"
 	"regexp"
 	"testing"
@@ -229,7 +227,7 @@ var token_cases = []map[string]interface{}{
 	},
 	map[string]interface{}{
 		"query":  "$.store.*",
-		"tokens": []string{"$", "store", "*"},
+		"tokens": []string{"$", "store", "[*]"},
 	},
 	map[string]interface{}{
 		"query":  "$.store..price",
@@ -279,6 +277,14 @@ var token_cases = []map[string]interface{}{
 		"query":  "$..*",
 		"tokens": []string{"$", "*"},
 	},
+	map[string]interface{}{
+		"query":  "$.tenants.*.plan",
+		"tokens": []string{"$", "tenants", "[*]", "plan"},
+	},
+	map[string]interface{}{
+		"query":  "$.tenants.*[?(@.plan == 'pro')]",
+		"tokens": []string{"$", "tenants", "[*]", "[?(@.plan == 'pro')]"},
+	},
 	map[string]interface{}{
 		"query":  "$....author",
 		"tokens": []string{"$", "*", "author"},
@@ -714,12 +720,6 @@ func Test_jsonpath_get_range(t *testing.T) {
 	}
 }
 
-func Test_jsonpath_types_eval(t *testing.T) {
-	fset := token.NewFileSet()
-	res, err := types.Eval(fset, nil, 0, "1 < 2")
-	fmt.Println(err, res, res.Type, res.Value, res.IsValue())
-}
-
 var tcase_parse_filter = []map[string]interface{}{
 	// 0
 	map[string]interface{}{
@@ -761,6 +761,22 @@ var tcase_parse_filter = []map[string]interface{}{
 		"exp_op": "==",
 		"exp_rp": "Nigel Rees",
 	},
+
+	// 5
+	{
+		"filter": "@.price * @.qty > 100",
+		"exp_lp": "@.price * @.qty",
+		"exp_op": ">",
+		"exp_rp": "100",
+	},
+
+	// 6
+	{
+		"filter": "@.end - @.start >= $.minDuration",
+		"exp_lp": "@.end - @.start",
+		"exp_op": ">=",
+		"exp_rp": "$.minDuration",
+	},
 }
 
 func Test_jsonpath_parse_filter(t *testing.T) {
@@ -919,7 +935,7 @@ func Test_jsonpath_eval_filter(t *testing.T) {
 		rp := tcase["rp"].(string)
 		exp := tcase["exp"].(bool)
 		t.Logf("idx: %v, lp: %v, op: %v, rp: %v, exp: %v", idx, lp, op, rp, exp)
-		got, err := eval_filter(obj, root, FilterTuple{lp: Param{p: lp}, op: op, rp: Param{p: rp}})
+		got, err := eval_filter(obj, root, FilterTuple{lp: Param{p: lp}, op: op, rp: Param{p: rp}}, nil)
 
 		if err != nil {
 			t.Errorf("idx: %v, failed to eval: %v", idx, err)
@@ -997,6 +1013,78 @@ var tcase_cmp_any = []map[string]interface{}{
 		"op":   ">",
 		"exp":  false,
 		"err":  nil,
+	}, {
+		"obj1": &Value{s: "1e2", t: TypeNumber},
+		"obj2": &Value{s: "100", t: TypeNumber},
+		"op":   "==",
+		"exp":  true,
+		"err":  nil,
+	}, {
+		"obj1": &Value{s: "20", t: TypeString},
+		"obj2": &Value{s: "100", t: TypeString},
+		"op":   ">",
+		"exp":  true,
+		"err":  nil,
+	}, {
+		"obj1": &Value{s: `a"b\c`, t: TypeString},
+		"obj2": &Value{s: `a"b\c`, t: TypeString},
+		"op":   "==",
+		"exp":  true,
+		"err":  nil,
+	}, {
+		"obj1": &Value{s: "é", t: TypeString},
+		"obj2": &Value{s: "z", t: TypeString},
+		"op":   ">",
+		"exp":  true,
+		"err":  nil,
+	}, {
+		"obj1": &Value{s: "1", t: TypeNumber},
+		"obj2": &Value{s: "1", t: TypeString},
+		"op":   "==",
+		"exp":  false,
+		"err":  nil,
+	}, {
+		"obj1": &Value{s: "1", t: TypeNumber},
+		"obj2": &Value{s: "1", t: TypeString},
+		"op":   "!=",
+		"exp":  true,
+		"err":  nil,
+	}, {
+		"obj1": &Value{s: "1", t: TypeNumber},
+		"obj2": &Value{s: "abc", t: TypeString},
+		"op":   "<",
+		"exp":  false,
+		"err":  nil,
+	}, {
+		"obj1": valueTrue,
+		"obj2": valueTrue,
+		"op":   "==",
+		"exp":  true,
+		"err":  nil,
+	}, {
+		"obj1": valueTrue,
+		"obj2": valueFalse,
+		"op":   "<",
+		"exp":  false,
+		"err":  nil,
+	}, {
+		"obj1": valueNull,
+		"obj2": valueNull,
+		"op":   "==",
+		"exp":  true,
+		"err":  nil,
+	}, {
+		"obj1": valueNull,
+		"obj2": valueFalse,
+		"op":   "==",
+		"exp":  false,
+		"err":  nil,
+	}, {
+		"obj1": MustParse(`{"a": [1, {"b": null}]}`),
+		"obj2": MustParse(`{"a": [1.0, {"b": null}]}`),
+		"op":   "==",
+		"exp":  true,
+		"err":  nil,
 	},
 }
 
@@ -1350,3 +1438,504 @@ func Test_jsonpath_rootnode_is_nested_array_range(t *testing.T) {
 		t.Fatalf("idx: 0, should be 3.1, got: %v", ares[1])
 	}
 }
+
+func Test_jsonpath_recursive_descent(t *testing.T) {
+	tcases := []struct {
+		query string
+		exp   string
+	}{
+		{"$..author", `["Nigel Rees","Evelyn Waugh","Herman Melville","J. R. R. Tolkien"]`},
+		{"$.store..price", `[8.95,12.99,8.99,22.99,19.95]`},
+		{"$..book[0]", `[{"category":"reference","author":"Nigel Rees","title":"Sayings of the Century","price":8.95}]`},
+		{"$..book[-1].title", `["The Lord of the Rings"]`},
+		{"$..book[0,1].price", `[8.95,12.99]`},
+		{"$..book[:1].price", `[8.95,12.99]`},
+		{"$..book[?(@.isbn)].isbn", `["0-553-21311-3","0-395-19395-8"]`},
+		{"$..[?(@.price > 19)]", `[{"color":"red","price":19.95},{"category":"fiction","author":"J. R. R. Tolkien","title":"The Lord of the Rings","isbn":"0-395-19395-8","price":22.99}]`},
+		{"$..nothing", `[]`},
+	}
+
+	for idx, tcase := range tcases {
+		res, err := JsonPathLookup(json_data, tcase.query)
+		if err != nil {
+			t.Fatalf("idx: %d, query: %s, err: %v", idx, tcase.query, err)
+		}
+		if res.String() != tcase.exp {
+			t.Fatalf("idx: %d, query: %s, got: %s, exp: %s", idx, tcase.query, res, tcase.exp)
+		}
+	}
+
+	j := MustParse(`{"a": {"b": [1, {"c": 2}]}, "d": [3]}`)
+	res, err := JsonPathLookup(j, "$..*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.String() != `[{"b":[1,{"c":2}]},[3],[1,{"c":2}],1,{"c":2},2,3]` {
+		t.Fatalf("unexpected $..* result: %s", res)
+	}
+
+	res, err = JsonPathLookup(j, "$..c")
+	if err != nil || res.String() != `[2]` {
+		t.Fatalf("unexpected $..c result: %v, err: %v", res, err)
+	}
+
+	if !JsonPathExists(j, "$..c") || JsonPathExists(j, "$..e") {
+		t.Fatalf("unexpected exists result for recursive descent")
+	}
+}
+
+func Test_jsonpath_recursive_descent_filter_nested_arrays(t *testing.T) {
+	j := MustParse(`{"logs": [{"error": "e1", "tags": ["t1", "t2"]}, [3], [], {"ok": [[{"error": "e2"}]]}], "n": [[1, 2], {"error": null}]}`)
+	tcases := []struct {
+		query string
+		exp   string
+	}{
+		{"$..[?(@.error)]", `[{"error":"e1","tags":["t1","t2"]},{"error":"e2"},{"error":null}]`},
+		{"$..[?(@.error == 'e2')]", `[{"error":"e2"}]`},
+		{"$..[?(!@.error)]", `[[{"error":"e1","tags":["t1","t2"]},[3],[],{"ok":[[{"error":"e2"}]]}],[[1,2],{"error":null}],[3],[],{"ok":[[{"error":"e2"}]]},"e1",["t1","t2"],"t1","t2",3,[[{"error":"e2"}]],[{"error":"e2"}],"e2",[1,2],1,2,null]`},
+		{"$.n[?(@.error)]", `[{"error":null}]`},
+		{"$.n[?(@[0] == 1)]", `[[1,2]]`},
+	}
+
+	for idx, tcase := range tcases {
+		res, err := JsonPathLookup(j, tcase.query)
+		if err != nil {
+			t.Fatalf("idx: %d, query: %s, err: %v", idx, tcase.query, err)
+		}
+		if res.String() != tcase.exp {
+			t.Fatalf("idx: %d, query: %s, got: %s, exp: %s", idx, tcase.query, res, tcase.exp)
+		}
+	}
+}
+
+func Test_jsonpath_compile_filter(t *testing.T) {
+	c, err := Compile("$.store.book[?(@.author =~ /.*Rees/)].title")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filterGroup, ok := c.steps[1].args.(*FilterTupleGroup)
+	if !ok {
+		t.Fatalf("filter should be compiled, got: %v", reflect.TypeOf(c.steps[1].args))
+	}
+	if filterGroup.tuples[0].reg == nil || filterGroup.tuples[0].reg.String() != ".*Rees" {
+		t.Fatalf("regexp should be precompiled, got: %v", filterGroup.tuples[0].reg)
+	}
+
+	c, err = Compile("$.store.book[?(@.category == 'reference' && @.price < $.expensive)].title")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filterGroup = c.steps[1].args.(*FilterTupleGroup)
+	if !filterGroup.tuples[1].rp.isField || !filterGroup.tuples[1].rp.fromRoot || len(filterGroup.tuples[1].rp.steps) != 1 {
+		t.Fatalf("field path should be precompiled, got: %+v", filterGroup.tuples[1].rp)
+	}
+
+	for i := 0; i < 2; i++ {
+		res, err := c.Lookup(json_data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.String() != `["Sayings of the Century"]` {
+			t.Fatalf("unexpected result: %s", res)
+		}
+	}
+
+	invalid := []string{
+		"$.store.book[?(@.author =~ /(/)]",
+		"$.store.book[?(@.author =~ 'Rees')]",
+		"$.store.book[?(@.price ~~ 10)]",
+		"$.store.book[?@.price]",
+		"$.store.book[?(@.price ==)]",
+		"$.store.book[?(@.price > )]",
+		"$.store.book[?(@.price >= && @.isbn)]",
+		"$.store.book[?(@.isbn || @.price in)]",
+		"$.store.book[?(..isbn)]",
+		"$.store.book[?(..price == 1)]",
+	}
+	for _, jpath := range invalid {
+		if _, err := Compile(jpath); err == nil {
+			t.Fatalf("expect compile error for %s", jpath)
+		}
+		if JsonPathExists(json_data, jpath) {
+			t.Fatalf("expect JsonPathExists to return false for %s", jpath)
+		}
+	}
+}
+
+func Test_jsonpath_typed_filter(t *testing.T) {
+	j := MustParse(`{"items": [
+		{"id": 1, "name": "a\"b", "ok": true, "v": null},
+		{"id": "1", "name": "c\\d", "ok": false, "v": 0},
+		{"id": 10, "name": "O'Brien", "ok": true, "v": "null"}
+	]}`)
+
+	tcases := []struct {
+		query string
+		exp   string
+	}{
+		{`$.items[?(@.id == 1)].name`, `["a\"b"]`},
+		{`$.items[?(@.id == '1')].name`, `["c\\d"]`},
+		{`$.items[?(@.id > 2)].name`, `["O'Brien"]`},
+		{`$.items[?(@.name == 'a"b')].id`, `[1]`},
+		{`$.items[?(@.name == "c\\d")].id`, `["1"]`},
+		{`$.items[?(@.name == 'c\\d')].id`, `["1"]`},
+		{`$.items[?(@.name == 'a\"b')].id`, `[1]`},
+		{`$.items[?(@.name == 'O\'Brien')].id`, `[10]`},
+		{`$.items[?(@.name == 'O\u0027Brien')].id`, `[10]`},
+		{`$.items[?(@.name in ['c\\d', 'x'])].id`, `["1"]`},
+		{`$.items[?(@.ok == true)].id`, `[1,10]`},
+		{`$.items[?(@.ok != true)].id`, `["1"]`},
+		{`$.items[?(@.v == null)].id`, `[1]`},
+		{`$.items[?(@.v < 1)].id`, `["1"]`},
+	}
+	for idx, tcase := range tcases {
+		res, err := JsonPathLookup(j, tcase.query)
+		if err != nil {
+			t.Fatalf("idx: %d, query: %s, err: %v", idx, tcase.query, err)
+		}
+		if res.String() != tcase.exp {
+			t.Fatalf("idx: %d, query: %s, got: %s, exp: %s", idx, tcase.query, res, tcase.exp)
+		}
+	}
+}
+
+func Test_jsonpath_filter_functions(t *testing.T) {
+	j := MustParse(`{"items": [
+		{"id": "abc", "tags": ["x", "y", "z"], "sub": {"x": 1, "y": {"x": 2}}},
+		{"id": "A-1", "tags": ["x"], "sub": {"x": 3}},
+		{"id": "b|c", "tags": [], "sub": {}}
+	]}`)
+
+	tcases := []struct {
+		query string
+		exp   string
+	}{
+		{`$.items[?(length(@.tags) > 2)].id`, `["abc"]`},
+		{`$.items[?(length(@.id) == 3)].id`, `["abc","A-1","b|c"]`},
+		{`$.items[?(count(@..x) == 2)].id`, `["abc"]`},
+		{`$.items[?(count(@.tags[*]) >= 1)].id`, `["abc","A-1"]`},
+		{`$.items[?(match(@.id, '[a-z]+'))].id`, `["abc"]`},
+		{`$.items[?(search(@.id, '[0-9]'))].id`, `["A-1"]`},
+		{`$.items[?(search(@.id, 'b|c') && length(@.tags) == 0)].id`, `["b|c"]`},
+		{`$.items[?(value(@.sub.x) == 3)].id`, `["A-1"]`},
+		{`$.items[?(@.sub.x < length(@.tags))].id`, `["abc"]`},
+	}
+	for idx, tcase := range tcases {
+		res, err := JsonPathLookup(j, tcase.query)
+		if err != nil {
+			t.Fatalf("idx: %d, query: %s, err: %v", idx, tcase.query, err)
+		}
+		if res.String() != tcase.exp {
+			t.Fatalf("idx: %d, query: %s, got: %s, exp: %s", idx, tcase.query, res, tcase.exp)
+		}
+	}
+
+	for idx, query := range []string{
+		`$.items[?(length(@.tags))]`,
+		`$.items[?(match(@.id, 'a') == true)]`,
+		`$.items[?(count(@.tags) > 'a' && count(1) > 2)]`,
+		`$.items[?(length(@.tags, @.id) > 2)]`,
+		`$.items[?(unknown(@.tags) > 2)]`,
+	} {
+		if _, err := Compile(query); err == nil {
+			t.Fatalf("idx: %d, query: %s, expecting error", idx, query)
+		}
+	}
+}
+
+func Test_jsonpath_filter_expression(t *testing.T) {
+	j := MustParse(`[
+		{"id": 1, "a": "xyz", "b": true, "c": 1},
+		{"id": 2, "a": "abc", "c": 5},
+		{"id": 3, "a": "abc", "b": false},
+		{"id": 4, "c": 4},
+		{"id": 5, "a": "a|b", "b": 1, "c": 2}
+	]`)
+
+	tcases := []struct {
+		query string
+		exp   string
+	}{
+		{`$[?(!(@.a =~ /x/) && (@.b || @.c > 3))].id`, `[2,3,4,5]`},
+		{`$[?(@.id == 1 || @.id == 2 && @.c == 1)].id`, `[1]`},
+		{`$[?((@.id == 1 || @.id == 2) && @.c == 1)].id`, `[1]`},
+		{`$[?((@.id == 1 || @.id == 2) && @.c == 5)].id`, `[2]`},
+		{`$[?(@.id == 2 && @.c == 5 || @.id == 4)].id`, `[2,4]`},
+		{`$[?(!@.b)].id`, `[2,4]`},
+		{`$[?(!!@.b)].id`, `[1,3,5]`},
+		{`$[?(! ( @.c ))].id`, `[3]`},
+		{`$[?(@.a =~ /^a/ && @.a =~ /c$/)].id`, `[2,3]`},
+		{`$[?(@.a =~ /a|x/ && !(@.a =~ /\|/))].id`, `[1,2,3]`},
+		{`$[?(@.a =~ /(b|y)/ || @.c)].id`, `[1,2,3,4,5]`},
+		{`$[?(@.a && @.b && @.c)].id`, `[1,5]`},
+		{`$[?(@.a == 'a|b' || @.a == "x&&y")].id`, `[5]`},
+		{`$[?(@.b == true || (@.c >= 2 && (@.c <= 4 && !(@.id == 5))))].id`, `[1,4]`},
+	}
+	for idx, tcase := range tcases {
+		res, err := JsonPathLookup(j, tcase.query)
+		if err != nil {
+			t.Fatalf("idx: %d, query: %s, err: %v", idx, tcase.query, err)
+		}
+		if res.String() != tcase.exp {
+			t.Fatalf("idx: %d, query: %s, got: %s, exp: %s", idx, tcase.query, res, tcase.exp)
+		}
+	}
+
+	for idx, query := range []string{
+		`$[?((@.a == 1)]`,
+		`$[?(@.a == 1))]`,
+		`$[?(@.a == 1 &&)]`,
+		`$[?(|| @.a)]`,
+		`$[?(!)]`,
+		`$[?(@.a == 1 && ())]`,
+	} {
+		if _, err := Compile(query); err == nil {
+			t.Fatalf("idx: %d, query: %s, expecting error", idx, query)
+		}
+	}
+}
+
+func Test_jsonpath_range_step(t *testing.T) {
+	j := MustParse(`{"a": [0, 1, 2, 3, 4, 5, 6, 7, 8, 9], "e": []}`)
+
+	tcases := []struct {
+		query string
+		exp   string
+	}{
+		{`$.a[::2]`, `[0,2,4,6,8]`},
+		{`$.a[1::3]`, `[1,4,7]`},
+		{`$.a[::-1]`, `[9,8,7,6,5,4,3,2,1,0]`},
+		{`$.a[::-3]`, `[9,6,3,0]`},
+		{`$.a[-1:-3:-1]`, `[9,8,7]`},
+		{`$.a[2:6:2]`, `[2,4,6]`},
+		{`$.a[6:2:-2]`, `[6,4,2]`},
+		{`$.a[2:6:-1]`, `[]`},
+		{`$.a[0:100]`, `[0,1,2,3,4,5,6,7,8,9]`},
+		{`$.a[-100:1]`, `[0,1]`},
+		{`$.a[100:]`, `[]`},
+		{`$.a[-100:-90]`, `[]`},
+		{`$.a[100:-100:-4]`, `[9,5,1]`},
+		{`$.a[1:9:9223372036854775807]`, `[1]`},
+		{`$.a[8::-9223372036854775808]`, `[8]`},
+		{`$.e[::-1]`, `[]`},
+		{`$.e[0:5]`, `[]`},
+	}
+	for idx, tcase := range tcases {
+		res, err := JsonPathLookup(j, tcase.query)
+		if err != nil {
+			t.Fatalf("idx: %d, query: %s, err: %v", idx, tcase.query, err)
+		}
+		if res.String() != tcase.exp {
+			t.Fatalf("idx: %d, query: %s, got: %s, exp: %s", idx, tcase.query, res, tcase.exp)
+		}
+	}
+
+	op, key, args, err := parse_token("a[1:-1:-2]")
+	if err != nil || op != "range" || key != "a" || !reflect.DeepEqual(args, [3]interface{}{1, -1, -2}) {
+		t.Fatalf("unexpected parse_token result: %v, %v, %v, %v", op, key, args, err)
+	}
+
+	for idx, query := range []string{
+		`$.a[::0]`,
+		`$.a[1:2:3:4]`,
+		`$.a[::x]`,
+	} {
+		if _, err := Compile(query); err == nil {
+			t.Fatalf("idx: %d, query: %s, expecting error", idx, query)
+		}
+	}
+}
+
+func Test_jsonpath_collection_filter(t *testing.T) {
+	j := MustParse(`{"allowed": ["new", "paid"], "items": [
+		{"id": 1, "status": "new", "tags": ["x", "y"], "name": "alpha"},
+		{"id": 2, "status": "paid", "tags": ["y"], "name": "beta"},
+		{"id": 3, "status": "done", "tags": [], "name": ""},
+		{"id": 4, "status": 1, "tags": ["x", 1, {"a": [2]}], "name": "x y"}
+	]}`)
+
+	tcases := []struct {
+		query string
+		exp   string
+	}{
+		{`$.items[?(@.status in ['new', 'paid'])].id`, `[1,2]`},
+		{`$.items[?(@.status in ["new","done"])].id`, `[1,3]`},
+		{`$.items[?(@.status in [1, 'x'])].id`, `[4]`},
+		{`$.items[?(@.status in $.allowed)].id`, `[1,2]`},
+		{`$.items[?(@.status nin ['new', 'paid'])].id`, `[3,4]`},
+		{`$.items[?(@.status nin $.allowed)].id`, `[3,4]`},
+		{`$.items[?(@.tags contains 'x')].id`, `[1,4]`},
+		{`$.items[?(@.tags contains 1)].id`, `[4]`},
+		{`$.items[?(@.name contains 'ph')].id`, `[1]`},
+		{`$.items[?(@.name contains 'x y')].id`, `[4]`},
+		{`$.items[?(@.tags subsetof ['x', 'y'])].id`, `[1,2,3]`},
+		{`$.items[?(@.tags anyof ['x', 'z'])].id`, `[1,4]`},
+		{`$.items[?(@.tags noneof ['x', 'z'])].id`, `[2,3]`},
+		{`$.items[?(@.tags size 2)].id`, `[1]`},
+		{`$.items[?(@.name size 4)].id`, `[2]`},
+		{`$.items[?(@.tags empty true)].id`, `[3]`},
+		{`$.items[?(@.name empty false && @.tags empty false)].id`, `[1,2,4]`},
+		{`$.items[?(@.missing in ['x'] || @.missing nin ['x'])].id`, `[]`},
+		{`$.items[?(@.status in ['a]', 'it\'s', "q\"q", 'new'])].id`, `[1]`},
+	}
+	for idx, tcase := range tcases {
+		res, err := JsonPathLookup(j, tcase.query)
+		if err != nil {
+			t.Fatalf("idx: %d, query: %s, err: %v", idx, tcase.query, err)
+		}
+		if res.String() != tcase.exp {
+			t.Fatalf("idx: %d, query: %s, got: %s, exp: %s", idx, tcase.query, res, tcase.exp)
+		}
+	}
+
+	for idx, query := range []string{
+		`$.items[?(@.status in 'new')]`,
+		`$.items[?(@.status in ['new')]`,
+		`$.items[?(@.tags subsetof 1)]`,
+		`$.items[?(@.tags size 'a')]`,
+		`$.items[?(@.tags empty 1)]`,
+		`$.items[?(@.tags among ['x'])]`,
+	} {
+		if _, err := Compile(query); err == nil {
+			t.Fatalf("idx: %d, query: %s, expecting error", idx, query)
+		}
+	}
+}
+
+func Test_jsonpath_cmp_collection(t *testing.T) {
+	tcases := []struct {
+		obj1 string
+		op   string
+		obj2 string
+		exp  bool
+	}{
+		{`1`, "in", `[1.0, 2]`, true},
+		{`[1]`, "in", `[[1], 2]`, true},
+		{`3`, "in", `[1, 2]`, false},
+		{`3`, "in", `3`, false},
+		{`3`, "nin", `[1, 2]`, true},
+		{`3`, "nin", `3`, false},
+		{`[1, "a"]`, "contains", `"a"`, true},
+		{`"abc"`, "contains", `"bc"`, true},
+		{`"abc"`, "contains", `1`, false},
+		{`1`, "contains", `1`, false},
+		{`[]`, "subsetof", `[1]`, true},
+		{`[1, 2]`, "subsetof", `[2, 1]`, true},
+		{`[1, 3]`, "subsetof", `[2, 1]`, false},
+		{`[]`, "anyof", `[1]`, false},
+		{`[3, 1]`, "anyof", `[1]`, true},
+		{`[]`, "noneof", `[1]`, true},
+		{`[3, 1]`, "noneof", `[1]`, false},
+		{`{"a": 1}`, "size", `1`, true},
+		{`"ж"`, "size", `1`, true},
+		{`1`, "size", `1`, false},
+		{`{}`, "empty", `true`, true},
+		{`""`, "empty", `false`, false},
+		{`null`, "empty", `true`, false},
+	}
+	for idx, tcase := range tcases {
+		res := cmp_collection(MustParse(tcase.obj1), MustParse(tcase.obj2), tcase.op)
+		if res != tcase.exp {
+			t.Fatalf("idx: %d, %s %s %s, got: %v, exp: %v", idx, tcase.obj1, tcase.op, tcase.obj2, res, tcase.exp)
+		}
+	}
+}
+
+func Test_jsonpath_wildcard(t *testing.T) {
+	j := MustParse(`{"tenants": {"t1": {"plan": "free", "seats": [1, 2]}, "t2": {"plan": "pro"}, "t3": {"plan": "pro", "seats": [3]}}, "a": [1, {"b": 2}], "s": "x"}`)
+
+	tcases := []struct {
+		query string
+		exp   string
+	}{
+		{`$.tenants.*`, `[{"plan":"free","seats":[1,2]},{"plan":"pro"},{"plan":"pro","seats":[3]}]`},
+		{`$.tenants[*]`, `[{"plan":"free","seats":[1,2]},{"plan":"pro"},{"plan":"pro","seats":[3]}]`},
+		{`$['tenants'][*]`, `[{"plan":"free","seats":[1,2]},{"plan":"pro"},{"plan":"pro","seats":[3]}]`},
+		{`$.tenants.*.plan`, `["free","pro","pro"]`},
+		{`$.tenants[*].plan`, `["free","pro","pro"]`},
+		{`$.tenants.*.seats[0]`, `[1,3]`},
+		{`$.tenants.*.seats.*`, `[1,2,3]`},
+		{`$.tenants.*[?(@.plan == 'pro')].seats`, `[[3]]`},
+		{`$.a.*`, `[1,{"b":2}]`},
+		{`$.a[*]`, `[1,{"b":2}]`},
+		{`$.*.t2.plan`, `["pro"]`},
+		{`$.*.*`, `[{"plan":"free","seats":[1,2]},{"plan":"pro"},{"plan":"pro","seats":[3]},1,{"b":2}]`},
+		{`$.tenants.t2.*`, `["pro"]`},
+		{`$..seats.*`, `[1,2,3]`},
+	}
+	for idx, tcase := range tcases {
+		res, err := JsonPathLookup(j, tcase.query)
+		if err != nil {
+			t.Fatalf("idx: %d, query: %s, err: %v", idx, tcase.query, err)
+		}
+		if res.String() != tcase.exp {
+			t.Fatalf("idx: %d, query: %s, got: %s, exp: %s", idx, tcase.query, res, tcase.exp)
+		}
+	}
+
+	nodes, err := MustCompile(`$.tenants.*.plan`).LookupNodes(j)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var paths []string
+	for _, n := range nodes {
+		paths = append(paths, n.NormalizedPath())
+	}
+	exp := []string{`$['tenants']['t1']['plan']`, `$['tenants']['t2']['plan']`, `$['tenants']['t3']['plan']`}
+	if !reflect.DeepEqual(paths, exp) {
+		t.Fatalf("unexpected paths: %q, exp: %q", paths, exp)
+	}
+}
+
+func Test_jsonpath_quoted_keys(t *testing.T) {
+	j := MustParse(`{"a.b": 1, "x-y": {"user name": "bob"}, "ключ": [10, 20], "it's": 2, "q\"k": 3, "c:d?": 4, "a[0]": 5, "": 6,
+		"users": [{"first name": "ann", "a.b": 1}, {"first name": "bob", "a.b": 2}]}`)
+
+	tcases := []struct {
+		query string
+		exp   string
+	}{
+		{`$['a.b']`, `1`},
+		{`$["a.b"]`, `1`},
+		{`$['x-y']["user name"]`, `"bob"`},
+		{`$["x-y"].user name`, `"bob"`},
+		{`$['ключ'][1]`, `20`},
+		{`$['\u043a\u043b\u044e\u0447'][0]`, `10`},
+		{`$['it\'s']`, `2`},
+		{`$["it's"]`, `2`},
+		{`$["q\"k"]`, `3`},
+		{`$['c:d?']`, `4`},
+		{`$['a[0]']`, `5`},
+		{`$['']`, `6`},
+		{`$['a.b', "it's"]`, `[1,2]`},
+		{`$.users[?(@['first name'] == 'bob')]['a.b']`, `[2]`},
+		{`$.users[?(@["a.b"] < 2)]["first name"]`, `["ann"]`},
+		{`$.users[?(@['first name'] =~ /^a/)]['a.b']`, `[1]`},
+	}
+	for idx, tcase := range tcases {
+		res, err := JsonPathLookup(j, tcase.query)
+		if err != nil {
+			t.Fatalf("idx: %d, query: %s, err: %v", idx, tcase.query, err)
+		}
+		if res.String() != tcase.exp {
+			t.Fatalf("idx: %d, query: %s, got: %s, exp: %s", idx, tcase.query, res, tcase.exp)
+		}
+	}
+
+	v, err := filter_get_from_explicit_path(j, `@['x-y']['user name']`)
+	if err != nil || v.String() != `"bob"` {
+		t.Fatalf("unexpected filter_get_from_explicit_path result: %v, %v", v, err)
+	}
+
+	for idx, query := range []string{
+		`$['a.b`,
+		`$['a\x']`,
+		`$['a' 'b']`,
+		`$['a', 1]`,
+		`$.users[?(@['a', 'b'] == 1)]`,
+	} {
+		if _, err := Compile(query); err == nil {
+			t.Fatalf("idx: %d, query: %s, expecting error", idx, query)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package fastjson
+
+import (
+	"sort"
+)
+
+// Set replaces every node matched by c in the document starting from root
+// with the given value.
+//
+// Only the existing nodes are replaced - Set doesn't create missing
+// object members or array items. The root node is replaced by copying
+// value contents into root.
+//
+// The value must be unchanged during root lifetime.
+func (c *Compiled) Set(root, value *Value) error {
+	return c.Apply(root, func(v *Value) *Value {
+		return value
+	})
+}
+
+// Apply replaces every node matched by c in the document starting from root
+// with the value returned by f for that node.
+//
+// Nodes are visited in the order they are returned by LookupNodes.
+// nil returned by f is stored as null.
+//
+// The values returned by f must be unchanged during root lifetime.
+func (c *Compiled) Apply(root *Value, f func(v *Value) *Value) error {
+	nodes, err := c.selectNodes(root)
+	if err != nil {
+		return err
+	}
+	for _, n := range nodes {
+		v := f(n.v)
+		if v == nil {
+			v = valueNull
+		}
+
+		loc := n.loc
+		switch {
+		case loc == nil:
+			if v != root {
+				*root = *v
+			}
+		case loc.idx < 0:
+			loc.container.o.Set(loc.key, v)
+		default:
+			loc.container.a[loc.idx] = v
+		}
+	}
+	return nil
+}
+
+// Delete removes every object member and array item matched by c
+// in the document starting from root.
+//
+// The root node cannot be deleted, so it is left untouched if matched.
+func (c *Compiled) Delete(root *Value) error {
+	nodes, err := c.selectNodes(root)
+	if err != nil {
+		return err
+	}
+
+	// Array items are removed after all the matches are collected,
+	// since removing an item shifts indexes of the subsequent items.
+	var arrays map[*Value][]int
+	for _, n := range nodes {
+		loc := n.loc
+		switch {
+		case loc == nil:
+		case loc.idx < 0:
+			loc.container.o.Del(loc.key)
+		default:
+			if arrays == nil {
+				arrays = make(map[*Value][]int)
+			}
+			arrays[loc.container] = append(arrays[loc.container], loc.idx)
+		}
+	}
+	for a, idxs := range arrays {
+		deleteArrayItems(a, idxs)
+	}
+	return nil
+}
+
+// deleteArrayItems removes items with the given indexes from a.
+//
+// idxs may contain duplicates.
+func deleteArrayItems(a *Value, idxs []int) {
+	sort.Ints(idxs)
+	items := a.a[:0]
+	j := 0
+	for i, v := range a.a {
+		if j < len(idxs) && idxs[j] == i {
+			for j < len(idxs) && idxs[j] == i {
+				j++
+			}
+			continue
+		}
+		items = append(items, v)
+	}
+	a.a = items
+}
@@ -0,0 +1,126 @@
+package fastjson
+
+import (
+	"testing"
+)
+
+func TestCompiledSet(t *testing.T) {
+	f := func(c *Compiled, s, value, resultExpected string) {
+		t.Helper()
+		root := MustParse(s)
+		if err := c.Set(root, MustParse(value)); err != nil {
+			t.Fatalf("unexpected error for %s: %s", c, err)
+		}
+		if result := root.String(); result != resultExpected {
+			t.Fatalf("unexpected result for %s; got %s; want %s", c, result, resultExpected)
+		}
+	}
+
+	f(MustCompile(`$.a.b`), `{"a":{"b":1,"c":2}}`, `"x"`, `{"a":{"b":"x","c":2}}`)
+	f(MustCompile(`$.a[1]`), `{"a":[1,2,3]}`, `null`, `{"a":[1,null,3]}`)
+	f(MustCompile(`$.a[0:1]`), `{"a":[1,2,3]}`, `0`, `{"a":[0,0,3]}`)
+	f(MustCompile(`$.a.b`), `{"a":[{"b":1},{"c":2},{"b":3}]}`, `true`, `{"a":[{"b":true},{"c":2},{"b":true}]}`)
+	f(MustCompile(`$.a[?(@.b > 1)]`), `{"a":[{"b":1},{"b":2}]}`, `{}`, `{"a":[{"b":1},{}]}`)
+	f(MustCompile(`$..b`), `{"a":{"b":1},"b":2}`, `3`, `{"a":{"b":3},"b":3}`)
+	f(MustCompile(`$`), `{"a":1}`, `[1]`, `[1]`)
+
+	f(MustCompileRFC9535(`$.*`), `{"a":1,"b":2}`, `"x"`, `{"a":"x","b":"x"}`)
+	f(MustCompileRFC9535(`$[::2]`), `[1,2,3,4,5]`, `0`, `[0,2,0,4,0]`)
+	f(MustCompileRFC9535(`$[?@.a == 1].b`), `[{"a":1,"b":1},{"a":2,"b":2}]`, `5`, `[{"a":1,"b":5},{"a":2,"b":2}]`)
+	f(MustCompileRFC9535(`$.nonexisting`), `{"a":1}`, `2`, `{"a":1}`)
+	f(MustCompileRFC9535(`$["x\\y"]`), `{"x\\y":1}`, `2`, `{"x\\y":2}`)
+}
+
+func TestCompiledSetError(t *testing.T) {
+	root := MustParse(`{"a":1}`)
+	if err := MustCompile(`$.b.c`).Set(root, MustParse(`1`)); err == nil {
+		t.Fatalf("expecting non-nil error")
+	}
+	if s := root.String(); s != `{"a":1}` {
+		t.Fatalf("unexpected document modification: %s", s)
+	}
+}
+
+func TestCompiledDelete(t *testing.T) {
+	f := func(c *Compiled, s, resultExpected string) {
+		t.Helper()
+		root := MustParse(s)
+		if err := c.Delete(root); err != nil {
+			t.Fatalf("unexpected error for %s: %s", c, err)
+		}
+		if result := root.String(); result != resultExpected {
+			t.Fatalf("unexpected result for %s; got %s; want %s", c, result, resultExpected)
+		}
+	}
+
+	f(MustCompile(`$.a`), `{"a":1,"b":2}`, `{"b":2}`)
+	f(MustCompile(`$.a[-1]`), `{"a":[1,2,3]}`, `{"a":[1,2]}`)
+	f(MustCompile(`$.a[0:1]`), `{"a":[1,2,3]}`, `{"a":[3]}`)
+	f(MustCompile(`$.items[?(@.expired == true)]`),
+		`{"items":[{"id":1,"expired":true},{"id":2,"expired":false},{"id":3,"expired":true}]}`,
+		`{"items":[{"id":2,"expired":false}]}`)
+	f(MustCompile(`$..b`), `{"a":{"b":1,"c":2},"b":2}`, `{"a":{"c":2}}`)
+	f(MustCompile(`$`), `{"a":1}`, `{"a":1}`)
+
+	f(MustCompileRFC9535(`$[0,0,2]`), `[1,2,3,4]`, `[2,4]`)
+	f(MustCompileRFC9535(`$[::-1]`), `[1,2,3]`, `[]`)
+	f(MustCompileRFC9535(`$.*`), `{"a":1,"b":2}`, `{}`)
+	f(MustCompileRFC9535(`$..[?@ > 1]`), `{"a":[1,2,{"b":3,"c":1}],"d":5}`, `{"a":[1,{"c":1}]}`)
+	f(MustCompileRFC9535(`$..*`), `{"a":[1,[2]],"b":{"c":3}}`, `{}`)
+}
+
+func TestCompiledApply(t *testing.T) {
+	f := func(c *Compiled, s, resultExpected string) {
+		t.Helper()
+		root := MustParse(s)
+		err := c.Apply(root, func(v *Value) *Value {
+			if v.Type() != TypeNumber {
+				return nil
+			}
+			return MustParse(string(v.MarshalTo([]byte("1"))))
+		})
+		if err != nil {
+			t.Fatalf("unexpected error for %s: %s", c, err)
+		}
+		if result := root.String(); result != resultExpected {
+			t.Fatalf("unexpected result for %s; got %s; want %s", c, result, resultExpected)
+		}
+	}
+
+	f(MustCompile(`$.a[0:1]`), `{"a":[1,2,3]}`, `{"a":[11,12,3]}`)
+	f(MustCompile(`$.a.b`), `{"a":[{"b":1},{"b":"x"}]}`, `{"a":[{"b":11},{"b":null}]}`)
+	f(MustCompileRFC9535(`$..[?@ > 1]`), `{"a":[1,2],"b":3}`, `{"a":[1,12],"b":13}`)
+	f(MustCompileRFC9535(`$`), `5`, `15`)
+}
+
+func TestCompiledUpdateFilterNestedArrays(t *testing.T) {
+	f := func(update func(c *Compiled, root *Value) error, path, s, resultExpected string) {
+		t.Helper()
+		root := MustParse(s)
+		if err := update(MustCompile(path), root); err != nil {
+			t.Fatalf("unexpected error for %s: %s", path, err)
+		}
+		if result := root.String(); result != resultExpected {
+			t.Fatalf("unexpected result for %s; got %s; want %s", path, result, resultExpected)
+		}
+	}
+	del := func(c *Compiled, root *Value) error {
+		return c.Delete(root)
+	}
+	set := func(c *Compiled, root *Value) error {
+		return c.Set(root, MustParse(`"x"`))
+	}
+	apply := func(c *Compiled, root *Value) error {
+		return c.Apply(root, func(v *Value) *Value {
+			return MustParse(`0`)
+		})
+	}
+
+	// Array items have no members, so @.x doesn't exist for them.
+	f(del, `$.a[?(@.x)]`, `{"a":[[1,2],[3,4]]}`, `{"a":[[1,2],[3,4]]}`)
+	f(del, `$.a[?(@.x)]`, `{"a":[[1,2],{"x":1},[]]}`, `{"a":[[1,2],[]]}`)
+	f(del, `$..[?(@.x == 1)]`, `{"a":[[{"x":1}],[3]],"b":{"x":1}}`, `{"a":[[],[3]]}`)
+	f(set, `$.a[?(@.x)]`, `{"a":[[1,2],{"x":1}]}`, `{"a":[[1,2],"x"]}`)
+	f(set, `$..[?(@.x)]`, `{"a":[["t1"],[],{"x":[1]}]}`, `{"a":[["t1"],[],"x"]}`)
+	f(apply, `$.a[?(!@.x)]`, `{"a":[[1],{"x":1},{"y":2}]}`, `{"a":[0,{"x":1},0]}`)
+}
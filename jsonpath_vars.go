@@ -0,0 +1,335 @@
+package fastjson
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+)
+
+// Vars contains values for `$$name` placeholders in filters,
+// i.e. `$.users[?(@.id == $$id && @.age > $$minAge)]`.
+//
+// Placeholders may be used as comparison operands and as function arguments,
+// i.e. `$.users[?(match(@.name, $$pattern))]`. A placeholder cannot be used
+// as a condition on its own, since its value doesn't depend on the node.
+//
+// Values may be *Value, nil, bool, string, integer and floating-point
+// numbers, slices and arrays of these types and maps with string keys.
+type Vars map[string]interface{}
+
+// LookupWith is like Lookup, but binds `$$name` placeholders in filters
+// to vars.
+//
+// This allows passing user input to precompiled paths without formatting
+// it into the path.
+func (c *Compiled) LookupWith(root *Value, vars Vars) (*Value, error) {
+	bound, err := c.Bind(vars)
+	if err != nil {
+		return nil, err
+	}
+	return bound.Lookup(root)
+}
+
+// Bind returns a copy of c with `$$name` placeholders in filters bound to vars.
+//
+// The returned path may be evaluated with any method of Compiled
+// and with GetPath, StreamPath or CompiledSet. c is returned if it has
+// no placeholders.
+//
+// Paths with unbound placeholders return an error on evaluation.
+func (c *Compiled) Bind(vars Vars) (*Compiled, error) {
+	var steps []step
+	for i, s := range c.steps {
+		if s.op != "filter" {
+			continue
+		}
+		group := s.args.(*FilterTupleGroup)
+		if !group.hasVars() {
+			continue
+		}
+		bound, err := group.bind(vars)
+		if err != nil {
+			return nil, fmt.Errorf("cannot bind %s: %s", c, err)
+		}
+		if steps == nil {
+			steps = append([]step(nil), c.steps...)
+		}
+		steps[i].args = bound
+	}
+	if steps == nil {
+		return c, nil
+	}
+	bound := *c
+	bound.steps = steps
+	return &bound, nil
+}
+
+func (g *FilterTupleGroup) hasVars() bool {
+	for i := range g.tuples {
+		if g.tuples[i].lp.hasVars() || g.tuples[i].rp.hasVars() {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *FilterTupleGroup) bind(vars Vars) (*FilterTupleGroup, error) {
+	tuples := make([]FilterTuple, len(g.tuples))
+	for i, t := range g.tuples {
+		var err error
+		if t.lp, err = t.lp.bind(vars); err != nil {
+			return nil, err
+		}
+		if t.rp, err = t.rp.bind(vars); err != nil {
+			return nil, err
+		}
+		tuples[i] = t
+	}
+	return &FilterTupleGroup{
+		tuples: tuples,
+		expr:   g.expr,
+		text:   g.text,
+	}, nil
+}
+
+func (p *Param) hasVars() bool {
+	if p.arith != nil {
+		return p.arith.hasVars()
+	}
+	return p.name != "" || len(p.fnVars) > 0
+}
+
+// unboundFuncVar returns an error if p.fn has unbound placeholders.
+func (p *Param) unboundFuncVar() error {
+	if len(p.fnVars) > 0 && !p.fnBound {
+		return &unboundVarError{name: p.fnVars[0]}
+	}
+	return nil
+}
+
+func (p Param) bind(vars Vars) (Param, error) {
+	if p.arith != nil {
+		if p.arith.hasVars() {
+			x, err := p.arith.bind(vars)
+			if err != nil {
+				return p, err
+			}
+			p.arith = x
+		}
+		return p, nil
+	}
+	if len(p.fnVars) > 0 {
+		// The function is compiled again with the placeholders replaced
+		// by the values, so the bound copy doesn't share args with p.
+		values := make(map[string]*Value, len(p.fnVars))
+		for _, name := range p.fnVars {
+			v, err := bindVar(vars, name)
+			if err != nil {
+				return p, err
+			}
+			values[name] = v
+		}
+		fn, _, err := compile_func_call(p.p, values)
+		if err != nil {
+			return p, err
+		}
+		p.fn = fn
+		p.fnBound = true
+		return p, nil
+	}
+	if p.name == "" {
+		return p, nil
+	}
+	v, err := bindVar(vars, p.name)
+	if err != nil {
+		return p, err
+	}
+	p.v = v
+	return p, nil
+}
+
+// bindVar returns the value for `$$name` placeholder from vars.
+func bindVar(vars Vars, name string) (*Value, error) {
+	x, ok := vars[name]
+	if !ok {
+		return nil, fmt.Errorf("missing value for $$%s", name)
+	}
+	v, err := varValue(x, 0)
+	if err != nil {
+		return nil, fmt.Errorf("cannot use the value for $$%s: %s", name, err)
+	}
+	return v, nil
+}
+
+func (x *arithExpr) hasVars() bool {
+	if x.op == 0 {
+		return x.p.hasVars()
+	}
+	return x.x.hasVars() || x.y.hasVars()
+}
+
+func (x *arithExpr) bind(vars Vars) (*arithExpr, error) {
+	bound := *x
+	var err error
+	if x.op == 0 {
+		bound.p, err = x.p.bind(vars)
+		return &bound, err
+	}
+	if bound.x, err = x.x.bind(vars); err != nil {
+		return nil, err
+	}
+	if bound.y, err = x.y.bind(vars); err != nil {
+		return nil, err
+	}
+	return &bound, nil
+}
+
+// varValue converts Go value x to Value.
+func varValue(x interface{}, depth int) (*Value, error) {
+	if depth > MaxDepth {
+		return nil, fmt.Errorf("too big depth for the nested value; it exceeds %d", MaxDepth)
+	}
+	switch t := x.(type) {
+	case *Value:
+		if t == nil {
+			return valueNull, nil
+		}
+		return t, nil
+	case nil:
+		return valueNull, nil
+	case bool:
+		if t {
+			return valueTrue, nil
+		}
+		return valueFalse, nil
+	case string:
+		return &Value{s: t, t: TypeString}, nil
+	case int:
+		return &Value{s: strconv.FormatInt(int64(t), 10), t: TypeNumber}, nil
+	case int64:
+		return &Value{s: strconv.FormatInt(t, 10), t: TypeNumber}, nil
+	case float64:
+		return floatValue(t)
+	}
+
+	rv := reflect.ValueOf(x)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Value{s: strconv.FormatInt(rv.Int(), 10), t: TypeNumber}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return &Value{s: strconv.FormatUint(rv.Uint(), 10), t: TypeNumber}, nil
+	case reflect.Float32, reflect.Float64:
+		return floatValue(rv.Float())
+	case reflect.String:
+		return &Value{s: rv.String(), t: TypeString}, nil
+	case reflect.Bool:
+		return varValue(rv.Bool(), depth)
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			return valueNull, nil
+		}
+		a := make([]*Value, rv.Len())
+		for i := range a {
+			v, err := varValue(rv.Index(i).Interface(), depth+1)
+			if err != nil {
+				return nil, err
+			}
+			a[i] = v
+		}
+		return &Value{a: a, t: TypeArray}, nil
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("unsupported map key type %s; want string", rv.Type().Key())
+		}
+		if rv.IsNil() {
+			return valueNull, nil
+		}
+		o := Object{
+			kvs:           make([]kv, 0, rv.Len()),
+			keysUnescaped: true,
+		}
+		iter := rv.MapRange()
+		for iter.Next() {
+			v, err := varValue(iter.Value().Interface(), depth+1)
+			if err != nil {
+				return nil, err
+			}
+			o.kvs = append(o.kvs, kv{k: iter.Key().String(), v: v})
+		}
+		return &Value{o: o, t: TypeObject}, nil
+	default:
+		return nil, fmt.Errorf("unsupported type %T", x)
+	}
+}
+
+func floatValue(f float64) (*Value, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil, fmt.Errorf("cannot represent %v as JSON number", f)
+	}
+	return &Value{s: strconv.FormatFloat(f, 'g', -1, 64), t: TypeNumber}, nil
+}
+
+// filterVars collects `$$name` placeholders passed to functions in filters.
+type filterVars struct {
+	// names contains placeholder names in the order of appearance.
+	names []string
+
+	// values contains the bound values. It is nil for unbound placeholders.
+	values map[string]*Value
+}
+
+// parseVar parses `$$name` placeholder in function arguments.
+//
+// The placeholder is parsed as a literal holding the bound value.
+// The literal is Nothing until the placeholder is bound, while Param
+// reports unbound placeholders on evaluation.
+func (p *rfcParser) parseVar() (interface{}, error) {
+	start := p.pos
+	p.pos += len("$$")
+	for p.pos < len(p.s) && isVarNameChar(p.s[p.pos]) {
+		p.pos++
+	}
+	name, err := parseVarName(p.s[start:p.pos])
+	if err != nil {
+		return nil, p.errorfAt(start, "%s", err)
+	}
+	p.vars.names = append(p.vars.names, name)
+	return literalExpr{p.vars.values[name]}, nil
+}
+
+func isVarNameChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// parseVarName returns the name of `$$name` placeholder.
+func parseVarName(s string) (string, error) {
+	name := s[len("$$"):]
+	if len(name) == 0 {
+		return "", fmt.Errorf("missing variable name after $$")
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if isVarNameChar(c) && (i > 0 || c < '0' || c > '9') {
+			continue
+		}
+		return "", fmt.Errorf("invalid variable name %q; it must contain only letters, digits and underscores and mustn't start with digit", name)
+	}
+	return name, nil
+}
+
+// unboundVarError is returned when `$$name` placeholder is evaluated
+// without binding it to a value.
+type unboundVarError struct {
+	name string
+}
+
+// Error implements error interface.
+func (e *unboundVarError) Error() string {
+	return fmt.Sprintf("unbound variable $$%s; use Compiled.LookupWith or Compiled.Bind", e.name)
+}
+
+func isUnboundVar(err error) bool {
+	_, ok := err.(*unboundVarError)
+	return ok
+}
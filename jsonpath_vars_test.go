@@ -0,0 +1,145 @@
+package fastjson
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCompiledLookupWith(t *testing.T) {
+	root := MustParse(`{"minAge": 18, "users": [
+		{"id": 1, "name": "alice", "age": 30, "role": "admin", "tags": ["a", "b"]},
+		{"id": 2, "name": "bob", "age": 17, "role": "user", "tags": []},
+		{"id": 3, "name": "carol", "age": 25, "role": "user", "tags": ["b"]},
+		{"id": 4, "name": "x' || @.id > 0 || 'y", "age": 40, "role": "guest"}
+	]}`)
+
+	f := func(path string, vars Vars, resultExpected string) {
+		t.Helper()
+		c, err := Compile(path)
+		if err != nil {
+			t.Fatalf("cannot compile %s: %s", path, err)
+		}
+		v, err := c.LookupWith(root, vars)
+		if err != nil {
+			t.Fatalf("unexpected error for %s: %s", path, err)
+		}
+		if result := v.String(); result != resultExpected {
+			t.Fatalf("unexpected result for %s; got %s; want %s", path, result, resultExpected)
+		}
+	}
+
+	f(`$.users[?(@.id == $$id)].name`, Vars{"id": 3}, `["carol"]`)
+	f(`$.users[?(@.id == $$id && @.age > $$minAge)].name`, Vars{"id": 2, "minAge": 18}, `[]`)
+	f(`$.users[?(@.age > $$minAge)].id`, Vars{"minAge": uint8(20)}, `[1,3,4]`)
+	f(`$.users[?(@.age > $$minAge)].id`, Vars{"minAge": 24.5}, `[1,3,4]`)
+	f(`$.users[?(@.age > $$minAge)].id`, Vars{"minAge": MustParse(`29`)}, `[1,4]`)
+	f(`$.users[?($$minAge < @.age)].id`, Vars{"minAge": int64(29)}, `[1,4]`)
+	f(`$.users[?(@.role in $$roles)].id`, Vars{"roles": []string{"admin", "guest"}}, `[1,4]`)
+	f(`$.users[?(@.tags contains $$tag)].id`, Vars{"tag": "b"}, `[1,3]`)
+	f(`$.users[?(@.age * 2 > $$limit + 10)].id`, Vars{"limit": 40}, `[1,4]`)
+	f(`$.users[?(@.role == $$role)]`, Vars{"role": nil}, `[]`)
+	f(`$.users[?(@.tags == $$tags)].id`, Vars{"tags": []interface{}{"a", "b"}}, `[1]`)
+	f(`$.users[?(@.age >= $.minAge && @.role != $$role)].id`, Vars{"role": "user"}, `[1,4]`)
+
+	f(`$.users[?(match(@.name, $$pat))].id`, Vars{"pat": "[ab].*"}, `[1,2]`)
+	f(`$.users[?(search(@.name, $$pat) && @.age > $$minAge)].id`, Vars{"pat": "o", "minAge": 18}, `[3]`)
+	f(`$.users[?(length(@.tags) == length($$tags))].id`, Vars{"tags": []string{"x"}}, `[3]`)
+	f(`$.users[?(@.age > length($$s) * 10)].id`, Vars{"s": "ab"}, `[1,3,4]`)
+
+	// Values are never interpreted as a part of the path.
+	f(`$.users[?(@.name == $$name)].id`, Vars{"name": "x' || @.id > 0 || 'y"}, `[4]`)
+	f(`$.users[?(@.name == $$name)].id`, Vars{"name": "alice' || 'y"}, `[]`)
+
+	// The same compiled path may be used with distinct vars.
+	c := MustCompile(`$.users[?(@.role == $$role)].id`)
+	for role, resultExpected := range map[string]string{"admin": `[1]`, "user": `[2,3]`, "none": `[]`} {
+		v, err := c.LookupWith(root, Vars{"role": role})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if v.String() != resultExpected {
+			t.Fatalf("unexpected result for role=%q; got %s; want %s", role, v, resultExpected)
+		}
+	}
+
+	// Paths without placeholders aren't copied.
+	c = MustCompile(`$.users[?(@.age > 18)]`)
+	if bound, err := c.Bind(nil); err != nil || bound != c {
+		t.Fatalf("unexpected Bind result for path without placeholders: %p, %v", bound, err)
+	}
+}
+
+func TestCompiledBind(t *testing.T) {
+	data := []byte(`{"users": [{"id": 1, "age": 30}, {"id": 2, "age": 17}]}`)
+	c, err := MustCompile(`$.users[?(@.age > $$minAge)].id`).Bind(Vars{"minAge": 18})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	a, err := GetPath(data, c)
+	if err != nil {
+		t.Fatalf("unexpected GetPath error: %s", err)
+	}
+	if len(a) != 1 || string(a[0]) != `1` {
+		t.Fatalf("unexpected GetPath result: %q", a)
+	}
+
+	var ids []string
+	err = StreamPath(bytes.NewReader(data), c, func(v *Value) error {
+		ids = append(ids, v.String())
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected StreamPath error: %s", err)
+	}
+	if len(ids) != 1 || ids[0] != `1` {
+		t.Fatalf("unexpected StreamPath result: %q", ids)
+	}
+}
+
+func TestCompiledBindError(t *testing.T) {
+	root := MustParse(`[{"a": 1}]`)
+	c := MustCompile(`$[?(@.a == $$a)]`)
+
+	_, err := c.Lookup(root)
+	if err == nil || !strings.Contains(err.Error(), "unbound variable $$a") {
+		t.Fatalf("unexpected error for unbound variable: %v", err)
+	}
+	_, err = MustCompile(`$[?(@.a + $$a > 1)]`).Lookup(root)
+	if err == nil || !strings.Contains(err.Error(), "unbound variable $$a") {
+		t.Fatalf("unexpected error for unbound variable in arithmetic expression: %v", err)
+	}
+	_, err = MustCompile(`$[?(match(@.a, $$a))]`).Lookup(root)
+	if err == nil || !strings.Contains(err.Error(), "unbound variable $$a") {
+		t.Fatalf("unexpected error for unbound variable in function argument: %v", err)
+	}
+	_, err = MustCompile(`$[?(match(@.a, $$a))]`).LookupWith(root, Vars{"b": 1})
+	if err == nil || !strings.Contains(err.Error(), "missing value for $$a") {
+		t.Fatalf("unexpected error for missing variable in function argument: %v", err)
+	}
+	if _, err := c.LookupWith(root, Vars{"b": 1}); err == nil || !strings.Contains(err.Error(), "missing value for $$a") {
+		t.Fatalf("unexpected error for missing variable: %v", err)
+	}
+	if _, err := c.LookupWith(root, Vars{"a": struct{}{}}); err == nil {
+		t.Fatalf("expecting non-nil error for unsupported type")
+	}
+	if _, err := c.LookupWith(root, Vars{"a": map[int]int{}}); err == nil {
+		t.Fatalf("expecting non-nil error for unsupported map key type")
+	}
+
+	for _, path := range []string{
+		`$[?(@.a == $$)]`,
+		`$[?(@.a == $$1a)]`,
+		`$[?(@.a == $$a.b)]`,
+		`$[?($$a)]`,
+		`$[?(!$$a)]`,
+		`$[?(@.a > 1 || $$a)]`,
+		`$[?(match(@.a, $$))]`,
+		`$[?(count($$a) > 1)]`,
+	} {
+		if _, err := Compile(path); err == nil {
+			t.Fatalf("expecting non-nil error for %s", path)
+		}
+	}
+}